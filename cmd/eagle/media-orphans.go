@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"go.hacdias.com/eagle/core"
+	"go.hacdias.com/eagle/services/media"
+)
+
+func init() {
+	mediaOrphansCmd.Flags().Bool("delete", false, "delete the orphaned files")
+	rootCmd.AddCommand(mediaOrphansCmd)
+}
+
+var mediaOrphansCmd = &cobra.Command{
+	Use:   "media-orphans",
+	Short: "List the indexed media files that are not used by any entry",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		shouldDelete, err := cmd.Flags().GetBool("delete")
+		if err != nil {
+			return err
+		}
+
+		c, err := core.ParseConfig("")
+		if err != nil {
+			return err
+		}
+
+		co, err := core.NewCore(c)
+		if err != nil {
+			return err
+		}
+
+		m := media.NewMedia(&c.Media, co.DB())
+
+		ee, err := co.GetEntries(false)
+		if err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		orphans, err := m.Orphans(ctx, ee)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range orphans {
+			fmt.Println(file.Reference)
+
+			if shouldDelete {
+				err = m.DeleteMedia(ctx, file.ID)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	},
+}
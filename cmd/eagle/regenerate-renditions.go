@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"go.hacdias.com/eagle/core"
+	"go.hacdias.com/eagle/services/media"
+)
+
+func init() {
+	rootCmd.AddCommand(regenerateRenditionsCmd)
+}
+
+var regenerateRenditionsCmd = &cobra.Command{
+	Use:   "regenerate-renditions",
+	Short: "Regenerate the renditions of the photos with the configured formats and widths",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := core.ParseConfig("")
+		if err != nil {
+			return err
+		}
+
+		co, err := core.NewCore(c)
+		if err != nil {
+			return err
+		}
+
+		m := media.NewMedia(&c.Media, co.DB())
+
+		ee, err := co.GetEntries(false)
+		if err != nil {
+			return err
+		}
+
+		regenerated := map[string]*core.Renditions{}
+
+		for _, e := range ee {
+			changed := false
+
+			for i, p := range e.Photos {
+				if !strings.HasPrefix(p.URL, "image:") {
+					continue
+				}
+
+				renditions, ok := regenerated[p.URL]
+				if !ok {
+					renditions, err = m.RegenerateRenditions(p.URL)
+					if err != nil {
+						return fmt.Errorf("failed to regenerate %s: %w", p.URL, err)
+					}
+					regenerated[p.URL] = renditions
+					fmt.Println(p.URL)
+				}
+
+				if !sameRenditions(p.Renditions, renditions) {
+					e.Photos[i].Renditions = renditions
+					changed = true
+				}
+			}
+
+			if changed {
+				err = co.SaveEntry(e)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	},
+}
+
+func sameRenditions(a, b *core.Renditions) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return slices.Equal(a.Formats, b.Formats) && slices.Equal(a.Widths, b.Widths)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"strings"
+
+	"github.com/boombuler/barcode/qr"
+	"github.com/pquerna/otp/totp"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	totpCmd.Flags().String("issuer", "Eagle", "issuer shown by the authenticator app")
+	rootCmd.AddCommand(totpCmd)
+}
+
+var totpCmd = &cobra.Command{
+	Use:   "totp [username]",
+	Short: "Generate a TOTP secret to use on the configuration",
+	Long: `Generate a TOTP secret to use on the configuration as login.totp, and print
+a QR code to enrol it in an authenticator app.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		issuer, err := cmd.Flags().GetString("issuer")
+		if err != nil {
+			return err
+		}
+
+		key, err := totp.Generate(totp.GenerateOpts{
+			Issuer:      issuer,
+			AccountName: args[0],
+		})
+		if err != nil {
+			return err
+		}
+
+		code, err := qr.Encode(key.URL(), qr.M, qr.Auto)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(renderQR(code))
+		fmt.Println(key.URL())
+		fmt.Println()
+		fmt.Println(key.Secret())
+		return nil
+	},
+}
+
+// renderQR renders the QR code for the terminal, with two modules per
+// character, and the quiet zone around it.
+func renderQR(code image.Image) string {
+	const quiet = 2
+	size := code.Bounds().Dx()
+	dark := func(x, y int) bool {
+		x, y = x-quiet, y-quiet
+		if x < 0 || y < 0 || x >= size || y >= size {
+			return false
+		}
+		r, _, _, _ := code.At(x, y).RGBA()
+		return r < 0x8000
+	}
+
+	var sb strings.Builder
+	for y := 0; y < size+quiet*2; y += 2 {
+		for x := 0; x < size+quiet*2; x++ {
+			// Light modules are drawn, so that the code is readable on dark
+			// terminal backgrounds.
+			top, bottom := !dark(x, y), !dark(x, y+1)
+			switch {
+			case top && bottom:
+				sb.WriteRune('█')
+			case top:
+				sb.WriteRune('▀')
+			case bottom:
+				sb.WriteRune('▄')
+			default:
+				sb.WriteRune(' ')
+			}
+		}
+		sb.WriteRune('\n')
+	}
+	return sb.String()
+}
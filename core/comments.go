@@ -0,0 +1,99 @@
+package core
+
+import (
+	"context"
+	urlpkg "net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// CommentEmail is the email address left with a comment, which is notified of
+// the replies to the comment once verified. It is never published.
+type CommentEmail struct {
+	MentionID string `gorm:"primaryKey"`
+	Email     string `gorm:"index"`
+	Token     string `gorm:"uniqueIndex"`
+	Verified  bool
+	Created   time.Time
+	// Requested is when the verification link was sent, from which it expires.
+	Requested time.Time
+}
+
+// SpamFilter scores incoming mentions, and learns from the moderation
+// decisions.
+type SpamFilter interface {
+	// Score returns the probability, between 0 and 1, of the mention being
+	// spam.
+	Score(ctx context.Context, m *Mention) (float64, error)
+
+	// Train records whether the mention was spam.
+	Train(ctx context.Context, m *Mention, spam bool) error
+}
+
+// SpamToken holds how many spam and legitimate mentions contained a token.
+type SpamToken struct {
+	Token string `gorm:"primaryKey"`
+	Spam  int
+	Ham   int
+}
+
+// SpamTotalToken is the [SpamToken] holding the total number of spam and
+// legitimate mentions.
+const SpamTotalToken = ""
+
+var spamURLReg = regexp.MustCompile(`https?://[^\s"'<>]+`)
+
+// SpamTokens returns the distinct tokens of a mention used for spam filtering:
+// the words in its content and author name, the hosts of its links, and some
+// heuristic features, such as the number of links.
+func SpamTokens(m *Mention) []string {
+	tokens := map[string]bool{}
+
+	words := strings.FieldsFunc(strings.ToLower(m.Author+" "+m.Content), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, word := range words {
+		if l := len(word); l >= 2 && l <= 30 {
+			tokens[word] = true
+		}
+	}
+
+	links := spamURLReg.FindAllString(m.Content, -1)
+	if m.AuthorURL != "" {
+		tokens["feature:author-url"] = true
+	}
+
+	for _, link := range append(links, m.AuthorURL) {
+		if u, err := urlpkg.Parse(link); err == nil && u.Hostname() != "" {
+			tokens["host:"+strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")] = true
+		}
+	}
+
+	switch n := len(links); {
+	case n == 0:
+		tokens["feature:links:0"] = true
+	case n <= 2:
+		tokens["feature:links:few"] = true
+	default:
+		tokens["feature:links:many"] = true
+	}
+
+	switch n := len(m.Content); {
+	case n < 40:
+		tokens["feature:length:short"] = true
+	case n > 600:
+		tokens["feature:length:long"] = true
+	}
+
+	if m.ParentID != "" {
+		tokens["feature:reply"] = true
+	}
+
+	list := make([]string, 0, len(tokens))
+	for token := range tokens {
+		list = append(list, token)
+	}
+	return list
+}
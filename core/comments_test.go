@@ -0,0 +1,77 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.hacdias.com/eagle/xray"
+)
+
+func TestSpamTokens(t *testing.T) {
+	tokens := SpamTokens(&Mention{
+		Post: xray.Post{
+			Author:    "Cheap Pills",
+			AuthorURL: "https://www.pills.example/buy",
+			Content:   "Buy now at https://pills.example/a and https://spam.example/b and http://x.example!",
+		},
+	})
+
+	assert.Subset(t, tokens, []string{"cheap", "pills", "buy", "now", "host:pills.example", "host:spam.example", "feature:author-url", "feature:links:many"})
+	assert.NotContains(t, tokens, "a")
+
+	tokens = SpamTokens(&Mention{Post: xray.Post{Author: "Jane", Content: "Nice!"}, ParentID: "1"})
+	assert.ElementsMatch(t, []string{"jane", "nice", "feature:links:0", "feature:length:short", "feature:reply"}, tokens)
+}
+
+func TestSpamTokensDatabase(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+
+	require.NoError(t, db.TrainSpamTokens(ctx, true, "pills", SpamTotalToken))
+	require.NoError(t, db.TrainSpamTokens(ctx, true, "pills", "buy", SpamTotalToken))
+	require.NoError(t, db.TrainSpamTokens(ctx, false, "pills", "hello", SpamTotalToken))
+
+	tokens, err := db.GetSpamTokens(ctx, "pills", "hello", "missing", SpamTotalToken)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]*SpamToken{
+		"pills":        {Token: "pills", Spam: 2, Ham: 1},
+		"hello":        {Token: "hello", Ham: 1},
+		SpamTotalToken: {Token: SpamTotalToken, Spam: 2, Ham: 1},
+	}, tokens)
+}
+
+func TestCommentEmails(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	require.NoError(t, db.CreateCommentEmail(ctx, &CommentEmail{MentionID: "1", Email: "jane@example.org", Token: "a", Created: now}))
+	require.NoError(t, db.CreateCommentEmail(ctx, &CommentEmail{MentionID: "2", Email: "jane@example.org", Token: "b", Created: now}))
+
+	verified, err := db.IsCommentEmailVerified(ctx, "jane@example.org", now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.False(t, verified)
+
+	email, err := db.GetCommentEmailByToken(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, "2", email.MentionID)
+
+	email.Verified = true
+	require.NoError(t, db.UpdateCommentEmail(ctx, email))
+
+	verified, err = db.IsCommentEmailVerified(ctx, "jane@example.org", now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.True(t, verified)
+
+	// Old verifications are not trusted.
+	verified, err = db.IsCommentEmailVerified(ctx, "jane@example.org", now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, verified)
+
+	require.NoError(t, db.DeleteCommentEmail(ctx, "2"))
+	_, err = db.GetCommentEmail(ctx, "2")
+	assert.Error(t, err)
+}
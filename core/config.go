@@ -1,11 +1,13 @@
 package core
 
 import (
+	"encoding/base32"
 	"errors"
 	"fmt"
 	"net/url"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -58,8 +60,21 @@ type ServerConfig struct {
 	DataDirectory   string
 	Port            int
 	TokensSecret    string
+	// JWTAccessTokens issues IndieAuth access tokens as JWTs signed with the
+	// TokensSecret, which are verified without the database.
+	JWTAccessTokens bool
 	WebhookSecret   string
 	Tor             bool
+	// TLS serves the website over HTTPS, with certificates from an ACME
+	// certificate authority. Port is then used for the HTTP-01 challenges and
+	// to redirect to HTTPS. If nil, the website is served over HTTP.
+	TLS *TLS
+
+	// TrustProxy takes the client IP address from the X-Forwarded-For or
+	// X-Real-IP headers, which must only be used behind a reverse proxy. Behind
+	// one, it is required, as all clients would otherwise share the limits
+	// per IP address.
+	TrustProxy bool
 
 	Login         Login
 	Comments      Comments
@@ -67,6 +82,8 @@ type ServerConfig struct {
 	Notifications Notifications
 	Media         Media
 	Meilisearch   *Meilisearch
+	Search        Search
+	Headers       Headers
 	Plugins       map[string]map[string]any
 }
 
@@ -130,17 +147,45 @@ func (c *ServerConfig) validate() error {
 		return err
 	}
 
+	err = c.Webmentions.validate()
+	if err != nil {
+		return err
+	}
+
 	err = c.Media.validate()
 	if err != nil {
 		return err
 	}
 
+	err = c.Search.validate(c)
+	if err != nil {
+		return err
+	}
+
+	err = c.Headers.validate()
+	if err != nil {
+		return err
+	}
+
+	if c.TLS != nil {
+		err = c.TLS.validate()
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 type Login struct {
 	Username string
+	// Password is the bcrypt hash of the password. If empty, the password
+	// login is disabled, and only the registered passkeys can be used.
 	Password string
+	// TOTP is the base32-encoded secret of the time-based one-time passwords
+	// required after the password. Use 'eagle totp' to generate it. If empty,
+	// the second factor is disabled.
+	TOTP string
 }
 
 func (u *Login) validate() error {
@@ -148,25 +193,98 @@ func (u *Login) validate() error {
 		return errors.New("config: Login.Username is empty")
 	}
 
-	if u.Password == "" {
-		return errors.New("config: Login.Password is empty")
+	if u.TOTP != "" {
+		_, err := decodeTOTPSecret(u.TOTP)
+		if err != nil {
+			return fmt.Errorf("config: Login.TOTP is invalid: %w", err)
+		}
 	}
 
 	return nil
 }
 
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	return base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+}
+
 type Comments struct {
 	Redirect string
 	Captcha  string
+
+	// Honeypot is the name of a form field hidden from humans. Comments that
+	// fill it in are discarded.
+	Honeypot string
+
+	RateLimit RateLimit
+
+	// SpamThreshold is the spam score, between 0 and 1, from which comments
+	// are discarded instead of waiting for moderation. Zero disables it.
+	SpamThreshold float64
+
+	// SMTP is used to verify the optional email addresses of the commenters
+	// and notify them of replies. If empty, email addresses are ignored.
+	SMTP *SMTP
 }
 
 func (c *Comments) validate() error {
 	c.Captcha = strings.ToLower(c.Captcha)
+
+	if c.SpamThreshold < 0 || c.SpamThreshold > 1 {
+		return errors.New("config: Comments.SpamThreshold must be between 0 and 1")
+	}
+
+	if c.SMTP != nil {
+		err := c.SMTP.validate("Comments.SMTP")
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.RateLimit.validate("Comments.RateLimit")
+}
+
+type SMTP struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTP) validate(name string) error {
+	if s.Host == "" {
+		return fmt.Errorf("config: %s.Host is empty", name)
+	}
+
+	if s.From == "" {
+		return fmt.Errorf("config: %s.From is empty", name)
+	}
+
+	if s.Port == 0 {
+		s.Port = 587
+	}
+
 	return nil
 }
 
 type Webmentions struct {
 	Secret string
+
+	// Pingback enables receiving pingbacks, which are moderated like the
+	// webmentions. Pingbacks are always sent to the targets that do not
+	// support webmentions.
+	Pingback bool
+	// PingbackRateLimit limits the pingbacks per IP address, as each one makes
+	// the server fetch the source. Defaults to 10 per hour.
+	PingbackRateLimit RateLimit
+}
+
+func (w *Webmentions) validate() error {
+	if w.PingbackRateLimit.Requests == 0 {
+		w.PingbackRateLimit = RateLimit{Requests: 10, Window: time.Hour}
+	}
+
+	return w.PingbackRateLimit.validate("Webmentions.PingbackRateLimit")
 }
 
 type Telegram struct {
@@ -189,33 +307,198 @@ type Bunny struct {
 	Base string
 }
 
+type S3 struct {
+	// Endpoint of the S3-compatible API, such as https://s3.amazonaws.com.
+	Endpoint string
+	Bucket   string
+	Region   string
+
+	// PathStyle addresses the bucket in the path instead of the host name.
+	// Required by MinIO and some other S3-compatible services.
+	PathStyle bool
+
+	AccessKey string
+	SecretKey string
+
+	// Base is the public URL of the bucket. If empty, it is derived from the
+	// endpoint and the bucket.
+	Base string
+}
+
+const (
+	StorageFileSystem = "filesystem"
+	StorageBunny      = "bunny"
+	StorageS3         = "s3"
+)
+
+// MediaStorage is the storage backend of the media. Type selects which of the
+// backends is used. If empty, it is inferred when only one is configured.
+type MediaStorage struct {
+	Type       string
+	FileSystem *FileSystem
+	Bunny      *Bunny
+	S3         *S3
+}
+
+func (s *MediaStorage) configured() map[string]bool {
+	return map[string]bool{
+		StorageFileSystem: s.FileSystem != nil,
+		StorageBunny:      s.Bunny != nil,
+		StorageS3:         s.S3 != nil,
+	}
+}
+
+// StorageType returns the type of the storage backend, which is Type if set,
+// or the only configured backend otherwise. It is empty if the type cannot be
+// inferred.
+func (s *MediaStorage) StorageType() string {
+	if s.Type != "" {
+		return s.Type
+	}
+
+	typ := ""
+	for t, ok := range s.configured() {
+		if !ok {
+			continue
+		}
+
+		if typ != "" {
+			return ""
+		}
+
+		typ = t
+	}
+
+	return typ
+}
+
+func (s *MediaStorage) validate() error {
+	configured := s.configured()
+
+	typ := s.StorageType()
+	if typ == "" {
+		for _, ok := range configured {
+			if ok {
+				return errors.New("config: Media.Storage.Type is required when more than one storage is configured")
+			}
+		}
+
+		return errors.New("config: Media.Storage must have one of FileSystem, Bunny or S3")
+	}
+
+	ok, known := configured[typ]
+	if !known {
+		return fmt.Errorf("config: Media.Storage.Type %q is not supported", typ)
+	}
+
+	if !ok {
+		return fmt.Errorf("config: Media.Storage.Type is %q, but it is not configured", typ)
+	}
+
+	if typ == StorageS3 && (s.S3.Endpoint == "" || s.S3.Bucket == "") {
+		return errors.New("config: Media.Storage.S3 must have Endpoint and Bucket")
+	}
+
+	return nil
+}
+
+type FFmpeg struct {
+	// Path is the path of the ffmpeg binary. Defaults to "ffmpeg".
+	Path string
+	// ProbePath is the path of the ffprobe binary. Defaults to "ffprobe".
+	ProbePath string
+}
+
 type ImgProxy struct {
 	Directory string
 	Endpoint  string
 }
 
 type Media struct {
-	Storage struct {
-		Bunny      *Bunny
-		FileSystem *FileSystem
-	}
+	// KeepGPS keeps the GPS coordinates in the uploaded originals and in
+	// the EXIF metadata of the photos. By default, they are stripped, and the
+	// XMP metadata, which may repeat them, is dropped.
+	KeepGPS bool
+
+	// Formats of the image renditions: webp, jpeg or avif. By default, webp
+	// and jpeg with ImgProxy, and only jpeg otherwise, as the in-process WebP
+	// encoder is lossless. Encoding avif requires ImgProxy.
+	Formats []string
+
+	// Widths of the image renditions. By default, 600, 900 and 1800.
+	Widths []int
 
+	Storage MediaStorage
+
+	// Transformer used to resize and convert the images. If none is set,
+	// images are transformed in-process.
 	Transformer struct {
 		ImgProxy *ImgProxy
 	}
+
+	// Transcoder used to convert videos and audio to web-friendly formats, and
+	// to extract the video posters. If none is set, they are stored as is.
+	Transcoder struct {
+		FFmpeg *FFmpeg
+	}
 }
 
 func (m *Media) validate() error {
-	if m.Storage.Bunny != nil && m.Storage.FileSystem != nil {
-		return errors.New("config: Media.Storage can only have one of Bunny or FileSystem")
+	err := m.Storage.validate()
+	if err != nil {
+		return err
+	}
+
+	for _, format := range m.Formats {
+		switch format {
+		case "webp", "jpeg":
+		case "avif":
+			if m.Transformer.ImgProxy == nil {
+				return errors.New("config: Media.Formats avif requires Media.Transformer.ImgProxy")
+			}
+		default:
+			return fmt.Errorf("config: Media.Formats has unsupported format %q", format)
+		}
+	}
+
+	for _, width := range m.Widths {
+		if width <= 0 {
+			return fmt.Errorf("config: Media.Widths has invalid width %d", width)
+		}
 	}
 
-	if m.Storage.Bunny == nil && m.Storage.FileSystem == nil {
-		return errors.New("config: Media.Storage must have one of Bunny or FileSystem")
+	return nil
+}
+
+// TLS configures the certificates obtained via ACME for the host of the
+// website, with either the HTTP-01 or the TLS-ALPN-01 challenges.
+type TLS struct {
+	// Port to serve HTTPS on, which defaults to 443.
+	Port int
+	// Email is the optional contact of the ACME account.
+	Email string
+	// DirectoryURL is the ACME directory, which defaults to Let's Encrypt.
+	DirectoryURL string
+	// CACertificate is the path of an additional PEM certificate to trust when
+	// connecting to the ACME directory, such as the one of a test server.
+	CACertificate string
+}
+
+func (t *TLS) validate() error {
+	if t.Port == 0 {
+		t.Port = 443
 	}
 
-	if m.Transformer.ImgProxy == nil {
-		return errors.New("config: Media.Transformer.ImgProxy is required")
+	if t.Port < 0 {
+		return errors.New("config: TLS.Port should be a positive number")
+	}
+
+	if t.CACertificate != "" {
+		var err error
+		t.CACertificate, err = filepath.Abs(t.CACertificate)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -226,6 +509,132 @@ type Meilisearch struct {
 	Key      string
 }
 
+const (
+	SearchMeilisearch = "meilisearch"
+	SearchSQLite      = "sqlite"
+)
+
+// Search configures the website search. The backend is either Meilisearch,
+// which is used by default if configured, or the embedded SQLite full-text
+// search, which requires no external service.
+type Search struct {
+	Backend string
+	API     SearchAPI
+}
+
+// SearchAPI configures the JSON search endpoint.
+type SearchAPI struct {
+	// AllowedOrigins are the origins allowed to make cross-origin requests,
+	// or "*" for any origin. If empty, cross-origin requests are not allowed.
+	AllowedOrigins []string
+	RateLimit      RateLimit
+}
+
+// RateLimit limits how many requests each IP address can make per window of
+// time. A zero number of requests disables it.
+type RateLimit struct {
+	Requests int
+	Window   time.Duration
+}
+
+func (r *RateLimit) validate(name string) error {
+	if r.Requests < 0 {
+		return fmt.Errorf("config: %s.Requests should be positive or 0", name)
+	}
+
+	if r.Requests > 0 && r.Window <= 0 {
+		return fmt.Errorf("config: %s.Window should be positive", name)
+	}
+
+	return nil
+}
+
+func (s *Search) validate(c *ServerConfig) error {
+	if s.Backend == "" && c.Meilisearch != nil {
+		s.Backend = SearchMeilisearch
+	}
+
+	switch s.Backend {
+	case "", SearchSQLite:
+	case SearchMeilisearch:
+		if c.Meilisearch == nil {
+			return fmt.Errorf("config: Search.Backend is %q, but Meilisearch is not configured", s.Backend)
+		}
+	default:
+		return fmt.Errorf("config: Search.Backend has invalid value %q", s.Backend)
+	}
+
+	return s.API.RateLimit.validate("Search.API.RateLimit")
+}
+
+// Headers configures the security headers of the responses. The panel always
+// uses its own strict, nonce-based, Content-Security-Policy.
+type Headers struct {
+	// ContentSecurityPolicy of the public pages. If empty, it is not sent.
+	ContentSecurityPolicy string
+	// ReferrerPolicy defaults to "no-referrer".
+	ReferrerPolicy string
+	// FrameOptions is the X-Frame-Options header, which defaults to
+	// "SAMEORIGIN".
+	FrameOptions string
+	// PermissionsPolicy is the Permissions-Policy header. If empty, it is not
+	// sent.
+	PermissionsPolicy string
+	// CrossOriginOpenerPolicy defaults to "same-origin".
+	CrossOriginOpenerPolicy string
+	// CrossOriginResourcePolicy is not sent if empty, such that other websites
+	// can still embed the images.
+	CrossOriginResourcePolicy string
+	HSTS                      HSTS
+	// Overrides replace the headers of the paths that start with the given
+	// prefix. They are applied in order, and an empty value removes the header.
+	// They do not apply to the panel, whose headers are always replaced.
+	Overrides []HeadersOverride
+}
+
+// HSTS configures the Strict-Transport-Security header, which is only sent if
+// MaxAge is positive. Only enable it if the website is always served over HTTPS.
+type HSTS struct {
+	MaxAge            time.Duration
+	IncludeSubdomains bool
+	Preload           bool
+}
+
+type HeadersOverride struct {
+	Path    string
+	Headers map[string]string
+}
+
+func (h *Headers) validate() error {
+	if h.ReferrerPolicy == "" {
+		h.ReferrerPolicy = "no-referrer"
+	}
+
+	if h.FrameOptions == "" {
+		h.FrameOptions = "SAMEORIGIN"
+	}
+
+	if h.CrossOriginOpenerPolicy == "" {
+		h.CrossOriginOpenerPolicy = "same-origin"
+	}
+
+	if h.HSTS.MaxAge < 0 {
+		return errors.New("config: Headers.HSTS.MaxAge should be positive or 0")
+	}
+
+	if h.HSTS.Preload && (h.HSTS.MaxAge < time.Hour*24*365 || !h.HSTS.IncludeSubdomains) {
+		return errors.New("config: Headers.HSTS.Preload requires a MaxAge of at least one year and IncludeSubdomains")
+	}
+
+	for i, o := range h.Overrides {
+		if !strings.HasPrefix(o.Path, "/") {
+			return fmt.Errorf("config: Headers.Overrides[%d].Path must start with /", i)
+		}
+	}
+
+	return nil
+}
+
 type SiteConfig struct {
 	BaseURL    string
 	Title      string
@@ -0,0 +1,26 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMediaStorageType(t *testing.T) {
+	s := &MediaStorage{Bunny: &Bunny{}}
+	require.NoError(t, s.validate())
+	assert.Equal(t, "", s.Type)
+	assert.Equal(t, StorageBunny, s.StorageType())
+
+	s = &MediaStorage{Bunny: &Bunny{}, FileSystem: &FileSystem{}}
+	assert.Error(t, s.validate())
+	assert.Equal(t, "", s.StorageType())
+
+	s.Type = StorageFileSystem
+	require.NoError(t, s.validate())
+	assert.Equal(t, StorageFileSystem, s.StorageType())
+
+	s = &MediaStorage{}
+	assert.Error(t, s.validate())
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/spf13/afero"
+	"go.hacdias.com/eagle/pingback"
 	"willnorris.com/go/webmention"
 )
 
@@ -18,6 +19,7 @@ type Core struct {
 	db       *Database
 	queue    *Queue
 	wmClient *webmention.Client
+	pbClient *pingback.Client
 
 	// Source
 	sourceFS   *afero.Afero
@@ -36,13 +38,16 @@ func NewCore(cfg *Config) (*Core, error) {
 		return nil, err
 	}
 
+	httpClient := &http.Client{
+		Timeout: time.Minute,
+	}
+
 	co := &Core{
-		cfg:   cfg,
-		db:    db,
-		queue: newQueue(db),
-		wmClient: webmention.New(&http.Client{
-			Timeout: time.Minute,
-		}),
+		cfg:      cfg,
+		db:       db,
+		queue:    newQueue(db),
+		wmClient: webmention.New(httpClient),
+		pbClient: pingback.New(httpClient),
 
 		// Source
 		sourceFS: &afero.Afero{
@@ -61,6 +66,8 @@ func NewCore(cfg *Config) (*Core, error) {
 	}
 	co.baseURL = baseURL
 
+	co.queue.Register(webmentionQueueItemType, co.handleWebmentionQueueItem)
+
 	if cfg.Development {
 		co.sourceSync = &noopGit{}
 	} else {
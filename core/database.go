@@ -2,11 +2,16 @@ package core
 
 import (
 	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"go.hacdias.com/eagle/log"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Database struct {
@@ -21,12 +26,18 @@ func newDatabase(path string) (*Database, error) {
 		return nil, err
 	}
 
-	err = db.AutoMigrate(&Token{}, &Mention{}, &QueueItem{})
+	err = db.AutoMigrate(&Token{}, &Mention{}, &QueueItem{}, &MediaFile{}, &SearchIndexState{}, &CommentEmail{}, &SpamToken{}, &MentionRule{}, &ApprovedAuthor{}, &WebmentionAttempt{}, &Passkey{}, &DeniedToken{}, &User{})
 	if err != nil {
 		return nil, err
 	}
 
-	return &Database{db: db}, nil
+	d := &Database{db: db}
+	err = d.migrateTokenHashes()
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
 }
 
 func (d *Database) Close() error {
@@ -49,24 +60,140 @@ func (d *Database) GetToken(ctx context.Context, id string, tokenType TokenType)
 	return &token, err
 }
 
-func (d *Database) GetTokensByType(ctx context.Context, tokenType TokenType) ([]*Token, error) {
+func (d *Database) GetTokenByID(ctx context.Context, id string) (*Token, error) {
+	var token Token
+	err := d.db.WithContext(ctx).First(&token, "id = ?", id).Error
+	return &token, err
+}
+
+// GetTokensByType returns the tokens of the given type of any of the given
+// users.
+func (d *Database) GetTokensByType(ctx context.Context, tokenType TokenType, usernames ...string) ([]*Token, error) {
 	var tokens []*Token
-	err := d.db.WithContext(ctx).Where("type = ?", tokenType).Order("created asc").Find(&tokens).Error
+	err := d.db.WithContext(ctx).Where("type = ? AND username IN ?", tokenType, usernames).Order("created asc").Find(&tokens).Error
 	return tokens, err
 }
 
+func (d *Database) UpdateToken(ctx context.Context, token *Token) error {
+	return d.db.WithContext(ctx).Save(token).Error
+}
+
 func (d *Database) DeleteToken(ctx context.Context, id string) error {
 	return d.db.WithContext(ctx).Delete(&Token{}, "id = ?", id).Error
 }
 
 func (d *Database) DeleteExpiredTokens(ctx context.Context) error {
-	return d.db.WithContext(ctx).
-		Where("expiry != ? AND expiry < ?", time.Time{}, time.Now()).
-		Delete(&Token{}).Error
+	return errors.Join(
+		d.db.WithContext(ctx).
+			Where("expiry != ? AND expiry < ?", time.Time{}, time.Now()).
+			Delete(&Token{}).Error,
+		d.db.WithContext(ctx).
+			Where("expiry != ? AND expiry < ?", time.Time{}, time.Now()).
+			Delete(&DeniedToken{}).Error,
+	)
 }
 
-func (d *Database) DeleteAllTokensByType(ctx context.Context, tokenType TokenType) error {
-	return d.db.WithContext(ctx).Where("type = ?", tokenType).Delete(&Token{}).Error
+// DeleteAllTokensByType deletes all tokens of the given type of any of the
+// given users.
+func (d *Database) DeleteAllTokensByType(ctx context.Context, tokenType TokenType, usernames ...string) error {
+	return d.db.WithContext(ctx).Where("type = ? AND username IN ?", tokenType, usernames).Delete(&Token{}).Error
+}
+
+// DeleteOtherTokensByType deletes all tokens of the given type of any of the
+// given users, except the one with the given ID.
+func (d *Database) DeleteOtherTokensByType(ctx context.Context, tokenType TokenType, id string, usernames ...string) error {
+	return d.db.WithContext(ctx).Where("type = ? AND id != ? AND username IN ?", tokenType, id, usernames).Delete(&Token{}).Error
+}
+
+// migrateTokenHashes replaces the IDs of the tokens stored in plain text, by
+// earlier versions, with their hashes. JWT access tokens are stored by their
+// JWT ID, which is not a secret.
+func (d *Database) migrateTokenHashes() error {
+	var tokens []*Token
+	err := d.db.Where("jwt = ? AND length(id) != ?", false, sha256.Size*2).Find(&tokens).Error
+	if err != nil {
+		return err
+	}
+
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		for _, token := range tokens {
+			err := tx.Model(&Token{}).Where("id = ?", token.ID).Update("id", HashToken(token.ID)).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (d *Database) DenyToken(ctx context.Context, token *DeniedToken) error {
+	return d.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(token).Error
+}
+
+func (d *Database) GetDeniedTokens(ctx context.Context) ([]*DeniedToken, error) {
+	var tokens []*DeniedToken
+	err := d.db.WithContext(ctx).Find(&tokens).Error
+	return tokens, err
+}
+
+// User methods
+
+func (d *Database) CreateUser(ctx context.Context, user *User) error {
+	return d.db.WithContext(ctx).Create(user).Error
+}
+
+func (d *Database) GetUser(ctx context.Context, username string) (*User, error) {
+	var user User
+	err := d.db.WithContext(ctx).First(&user, "username = ?", username).Error
+	return &user, err
+}
+
+func (d *Database) GetUsers(ctx context.Context) ([]*User, error) {
+	var users []*User
+	err := d.db.WithContext(ctx).Order("created asc").Find(&users).Error
+	return users, err
+}
+
+func (d *Database) UpdateUser(ctx context.Context, user *User) error {
+	return d.db.WithContext(ctx).Save(user).Error
+}
+
+// DeleteUser deletes the user, as well as their tokens and passkeys.
+func (d *Database) DeleteUser(ctx context.Context, username string) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return errors.Join(
+			tx.Delete(&Token{}, "username = ?", username).Error,
+			tx.Delete(&Passkey{}, "username = ?", username).Error,
+			tx.Delete(&User{}, "username = ?", username).Error,
+		)
+	})
+}
+
+// Passkey methods
+
+func (d *Database) CreatePasskey(ctx context.Context, passkey *Passkey) error {
+	return d.db.WithContext(ctx).Create(passkey).Error
+}
+
+func (d *Database) GetPasskeys(ctx context.Context) ([]*Passkey, error) {
+	var passkeys []*Passkey
+	err := d.db.WithContext(ctx).Order("created asc").Find(&passkeys).Error
+	return passkeys, err
+}
+
+// GetPasskeysByUsername returns the passkeys of any of the given users.
+func (d *Database) GetPasskeysByUsername(ctx context.Context, usernames ...string) ([]*Passkey, error) {
+	var passkeys []*Passkey
+	err := d.db.WithContext(ctx).Where("username IN ?", usernames).Order("created asc").Find(&passkeys).Error
+	return passkeys, err
+}
+
+func (d *Database) UpdatePasskey(ctx context.Context, passkey *Passkey) error {
+	return d.db.WithContext(ctx).Save(passkey).Error
+}
+
+func (d *Database) DeletePasskey(ctx context.Context, id string) error {
+	return d.db.WithContext(ctx).Delete(&Passkey{}, "id = ?", id).Error
 }
 
 // Mention methods
@@ -87,10 +214,142 @@ func (d *Database) GetMentions(ctx context.Context) ([]*Mention, error) {
 	return mentions, err
 }
 
+// IsMentionPending returns whether a mention of the entry from the URL is
+// waiting for approval.
+func (d *Database) IsMentionPending(ctx context.Context, entryID, url string) (bool, error) {
+	var count int64
+	err := d.db.WithContext(ctx).Model(&Mention{}).Where("entry_id = ? AND url = ?", entryID, url).Count(&count).Error
+	return count > 0, err
+}
+
 func (d *Database) DeleteMention(ctx context.Context, id string) error {
 	return d.db.WithContext(ctx).Delete(&Mention{}, "id = ?", id).Error
 }
 
+// Webmention attempt methods
+
+func (d *Database) CreateWebmentionAttempt(ctx context.Context, attempt *WebmentionAttempt) error {
+	return d.db.WithContext(ctx).Create(attempt).Error
+}
+
+// GetWebmentionAttempts returns the attempts to send webmentions from the
+// source, or from all sources if empty, newest first.
+func (d *Database) GetWebmentionAttempts(ctx context.Context, source string) ([]*WebmentionAttempt, error) {
+	var attempts []*WebmentionAttempt
+	tx := d.db.WithContext(ctx)
+	if source != "" {
+		tx = tx.Where("source = ?", source)
+	}
+	err := tx.Order("created desc").Find(&attempts).Error
+	return attempts, err
+}
+
+// Mention rule methods
+
+func (d *Database) CreateMentionRule(ctx context.Context, rule *MentionRule) error {
+	return d.db.WithContext(ctx).Create(rule).Error
+}
+
+func (d *Database) GetMentionRules(ctx context.Context) (MentionRules, error) {
+	var rules MentionRules
+	err := d.db.WithContext(ctx).Order("type asc, value asc").Find(&rules).Error
+	return rules, err
+}
+
+func (d *Database) DeleteMentionRule(ctx context.Context, id string) error {
+	return d.db.WithContext(ctx).Delete(&MentionRule{}, "id = ?", id).Error
+}
+
+func (d *Database) SaveApprovedAuthor(ctx context.Context, author *ApprovedAuthor) error {
+	return d.db.WithContext(ctx).Save(author).Error
+}
+
+func (d *Database) IsApprovedAuthor(ctx context.Context, url string) (bool, error) {
+	var count int64
+	err := d.db.WithContext(ctx).Model(&ApprovedAuthor{}).Where("url = ?", url).Count(&count).Error
+	return count > 0, err
+}
+
+// Comment email methods
+
+func (d *Database) CreateCommentEmail(ctx context.Context, email *CommentEmail) error {
+	return d.db.WithContext(ctx).Create(email).Error
+}
+
+func (d *Database) GetCommentEmail(ctx context.Context, mentionID string) (*CommentEmail, error) {
+	var email CommentEmail
+	err := d.db.WithContext(ctx).First(&email, "mention_id = ?", mentionID).Error
+	return &email, err
+}
+
+func (d *Database) GetCommentEmailByToken(ctx context.Context, token string) (*CommentEmail, error) {
+	var email CommentEmail
+	err := d.db.WithContext(ctx).First(&email, "token = ?", token).Error
+	return &email, err
+}
+
+// IsCommentEmailVerified returns whether the address was verified with any
+// comment created since the given time.
+func (d *Database) IsCommentEmailVerified(ctx context.Context, email string, since time.Time) (bool, error) {
+	var count int64
+	err := d.db.WithContext(ctx).Model(&CommentEmail{}).Where("email = ? AND verified = ? AND created >= ?", email, true, since).Count(&count).Error
+	return count > 0, err
+}
+
+func (d *Database) UpdateCommentEmail(ctx context.Context, email *CommentEmail) error {
+	return d.db.WithContext(ctx).Save(email).Error
+}
+
+func (d *Database) DeleteCommentEmail(ctx context.Context, mentionID string) error {
+	return d.db.WithContext(ctx).Delete(&CommentEmail{}, "mention_id = ?", mentionID).Error
+}
+
+// Spam methods
+
+// GetSpamTokens returns the counts of the given tokens, which are missing if
+// they were never seen.
+func (d *Database) GetSpamTokens(ctx context.Context, tokens ...string) (map[string]*SpamToken, error) {
+	var rows []*SpamToken
+	err := d.db.WithContext(ctx).Where("token IN ?", tokens).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[string]*SpamToken{}
+	for _, row := range rows {
+		counts[row.Token] = row
+	}
+	return counts, nil
+}
+
+// TrainSpamTokens increments the spam or ham count of each token.
+func (d *Database) TrainSpamTokens(ctx context.Context, spam bool, tokens ...string) error {
+	column := "ham"
+	if spam {
+		column = "spam"
+	}
+
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, token := range tokens {
+			row := &SpamToken{Token: token}
+			if spam {
+				row.Spam = 1
+			} else {
+				row.Ham = 1
+			}
+
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "token"}},
+				DoUpdates: clause.Assignments(map[string]any{column: gorm.Expr(column + " + 1")}),
+			}).Create(row).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 // Queue methods
 
 func (d *Database) CreateQueueItem(ctx context.Context, item *QueueItem) error {
@@ -130,3 +389,347 @@ func (d *Database) GetActiveQueueItems(ctx context.Context) ([]*QueueItem, error
 func (d *Database) DeleteFailedQueueItems(ctx context.Context) error {
 	return d.db.WithContext(ctx).Where("attempts >= ?", 3).Delete(&QueueItem{}).Error
 }
+
+// Media methods
+
+func (d *Database) SaveMediaFile(ctx context.Context, file *MediaFile) error {
+	return d.db.WithContext(ctx).Save(file).Error
+}
+
+func (d *Database) GetMediaFile(ctx context.Context, id string) (*MediaFile, error) {
+	var file MediaFile
+	err := d.db.WithContext(ctx).First(&file, "id = ?", id).Error
+	return &file, err
+}
+
+// GetMediaFiles returns the media files, newest first, whose filename or
+// reference contain the query. An empty query matches all files.
+func (d *Database) GetMediaFiles(ctx context.Context, query string, limit int) ([]*MediaFile, error) {
+	var files []*MediaFile
+	tx := d.db.WithContext(ctx).Order("created desc")
+	if query != "" {
+		like := "%" + query + "%"
+		tx = tx.Where("id LIKE ? OR reference LIKE ?", like, like)
+	}
+	if limit > 0 {
+		tx = tx.Limit(limit)
+	}
+	err := tx.Find(&files).Error
+	return files, err
+}
+
+func (d *Database) DeleteMediaFile(ctx context.Context, id string) error {
+	return d.db.WithContext(ctx).Delete(&MediaFile{}, "id = ?", id).Error
+}
+
+// Search methods
+
+// searchVersion is the version of the schema of the embedded search index.
+// Bump it whenever the columns, their weights or the tokenizer change, such
+// that the index is rebuilt.
+const searchVersion = 1
+
+// SearchSupported returns an error if SQLite was built without FTS5, which is
+// enabled with the sqlite_fts5 build tag.
+func (d *Database) SearchSupported(ctx context.Context) error {
+	var supported bool
+	err := d.db.WithContext(ctx).Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&supported).Error
+	if err != nil {
+		return err
+	}
+	if !supported {
+		return errors.New("embedded search requires SQLite with FTS5: build with -tags sqlite_fts5")
+	}
+	return nil
+}
+
+// SearchIndexOutdated returns whether the embedded search index was never
+// built, or was built with a previous version of the schema.
+func (d *Database) SearchIndexOutdated(ctx context.Context) (bool, error) {
+	state, err := getSearchIndexState(d.db.WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	return state.Generation == 0 || state.Version != searchVersion, nil
+}
+
+// RebuildSearchIndex builds a new generation of the embedded search index
+// with the documents. Once complete, it atomically becomes the active one,
+// and the previous one is dropped.
+func (d *Database) RebuildSearchIndex(ctx context.Context, docs ...*SearchDocument) error {
+	db := d.db.WithContext(ctx)
+	state, err := getSearchIndexState(db)
+	if err != nil {
+		return err
+	}
+
+	generation := state.Generation + 1
+	documents, attributes := searchTables(generation)
+
+	// Leftovers from an interrupted rebuild.
+	err = dropSearchTables(db, generation)
+	if err != nil {
+		return err
+	}
+
+	err = db.Exec(fmt.Sprintf(`CREATE VIRTUAL TABLE %s USING fts5(
+		id UNINDEXED,
+		hash UNINDEXED,
+		title,
+		tags,
+		content,
+		tokenize = 'porter unicode61 remove_diacritics 2'
+	)`, documents)).Error
+	if err != nil {
+		return err
+	}
+
+	for _, stmt := range []string{
+		"CREATE TABLE %[1]s (document_id TEXT NOT NULL, name TEXT NOT NULL, value TEXT NOT NULL)",
+		"CREATE INDEX %[1]s_document_id ON %[1]s (document_id)",
+		"CREATE INDEX %[1]s_name_value ON %[1]s (name, value)",
+	} {
+		err = db.Exec(fmt.Sprintf(stmt, attributes)).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return insertSearchDocuments(tx, generation, docs...)
+	})
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Save(&SearchIndexState{ID: 1, Version: searchVersion, Generation: generation}).Error
+		if err != nil {
+			return err
+		}
+
+		if state.Generation != 0 {
+			err = dropSearchTables(tx, state.Generation)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Tables from before the index had generations.
+		err = tx.Exec("DROP TABLE IF EXISTS search_documents").Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec("DROP TABLE IF EXISTS search_attributes").Error
+	})
+}
+
+// SaveSearchDocuments adds or replaces the documents in the active search
+// index. If there is none, it does nothing, as the documents are added when
+// the index is first built.
+func (d *Database) SaveSearchDocuments(ctx context.Context, docs ...*SearchDocument) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		state, err := getSearchIndexState(tx)
+		if err != nil || state.Generation == 0 {
+			return err
+		}
+
+		for _, doc := range docs {
+			err = deleteSearchDocuments(tx, state.Generation, doc.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		return insertSearchDocuments(tx, state.Generation, docs...)
+	})
+}
+
+func (d *Database) DeleteSearchDocuments(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		state, err := getSearchIndexState(tx)
+		if err != nil || state.Generation == 0 {
+			return err
+		}
+		return deleteSearchDocuments(tx, state.Generation, ids...)
+	})
+}
+
+// GetSearchHashes returns the hash of each document in the active search
+// index, by ID.
+func (d *Database) GetSearchHashes(ctx context.Context) (map[string]string, error) {
+	db := d.db.WithContext(ctx)
+	state, err := getSearchIndexState(db)
+	if err != nil || state.Generation == 0 {
+		return map[string]string{}, err
+	}
+
+	documents, _ := searchTables(state.Generation)
+
+	var rows []struct {
+		ID   string
+		Hash string
+	}
+	err = db.Table(documents).Select("id, hash").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := map[string]string{}
+	for _, row := range rows {
+		hashes[row.ID] = row.Hash
+	}
+	return hashes, nil
+}
+
+// SearchDocuments returns the page of documents matching the FTS5 query and
+// the filters of q, and the total number of matches. An empty FTS5 query
+// matches all documents. Unless sorted by
+// date, matches in the title weigh more than in the tags, which weigh more
+// than in the content. The snippets are excerpts of the content with the
+// matches delimited by [SnippetMarkStart] and [SnippetMarkEnd].
+func (d *Database) SearchDocuments(ctx context.Context, match string, q *SearchQuery) ([]*SearchHit, int, error) {
+	db := d.db.WithContext(ctx)
+	state, err := getSearchIndexState(db)
+	if err != nil || state.Generation == 0 {
+		return nil, 0, err
+	}
+
+	var total int64
+	err = searchDocuments(db, state.Generation, match, q).Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	documents, attributes := searchTables(state.Generation)
+	tx := searchDocuments(db, state.Generation, match, q)
+	if match != "" {
+		tx = tx.Select(fmt.Sprintf("id, snippet(%s, 4, ?, ?, '…', 32) AS snippet", documents), SnippetMarkStart, SnippetMarkEnd)
+	} else {
+		tx = tx.Select("id")
+	}
+
+	date := fmt.Sprintf("(SELECT value FROM %s WHERE document_id = %s.id AND name = '%s')", attributes, documents, searchAttributeDate)
+	switch {
+	case q.Sort == SearchSortOldest:
+		tx = tx.Order(date + " ASC")
+	case q.Sort == SearchSortNewest || match == "":
+		tx = tx.Order(date + " DESC")
+	default:
+		tx = tx.Order(fmt.Sprintf("bm25(%s, 0.0, 0.0, 10.0, 5.0, 1.0)", documents))
+	}
+
+	var hits []*SearchHit
+	err = tx.Limit(q.Limit).Offset(q.Page * q.Limit).Scan(&hits).Error
+	return hits, int(total), err
+}
+
+// SearchFacetCounts returns how many of the documents matching the FTS5 query
+// and the filters of q have each value, by facet.
+func (d *Database) SearchFacetCounts(ctx context.Context, match string, q *SearchQuery) (map[string]map[string]int, error) {
+	db := d.db.WithContext(ctx)
+	state, err := getSearchIndexState(db)
+	if err != nil || state.Generation == 0 {
+		return map[string]map[string]int{}, err
+	}
+
+	_, attributes := searchTables(state.Generation)
+
+	var rows []struct {
+		Name  string
+		Value string
+		Count int
+	}
+
+	err = db.
+		Table(attributes).
+		Select("name, value, COUNT(*) AS count").
+		Where("name IN ?", SearchFacets).
+		Where("document_id IN (?)", searchDocuments(db, state.Generation, match, q).Select("id")).
+		Group("name, value").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[string]map[string]int{}
+	for _, row := range rows {
+		if counts[row.Name] == nil {
+			counts[row.Name] = map[string]int{}
+		}
+		counts[row.Name][row.Value] = row.Count
+	}
+	return counts, nil
+}
+
+func getSearchIndexState(tx *gorm.DB) (*SearchIndexState, error) {
+	var state SearchIndexState
+	err := tx.Limit(1).Find(&state).Error
+	return &state, err
+}
+
+func searchTables(generation int) (documents, attributes string) {
+	return fmt.Sprintf("search_documents_%d", generation), fmt.Sprintf("search_attributes_%d", generation)
+}
+
+func dropSearchTables(tx *gorm.DB, generation int) error {
+	documents, attributes := searchTables(generation)
+	err := tx.Exec("DROP TABLE IF EXISTS " + documents).Error
+	if err != nil {
+		return err
+	}
+	return tx.Exec("DROP TABLE IF EXISTS " + attributes).Error
+}
+
+func insertSearchDocuments(tx *gorm.DB, generation int, docs ...*SearchDocument) error {
+	documents, attributes := searchTables(generation)
+	for _, doc := range docs {
+		err := tx.Exec(
+			fmt.Sprintf("INSERT INTO %s (id, hash, title, tags, content) VALUES (?, ?, ?, ?, ?)", documents),
+			doc.ID, doc.Hash(), doc.Title, strings.Join(doc.Tags, " "), doc.Content,
+		).Error
+		if err != nil {
+			return err
+		}
+
+		if attrs := doc.attributes(); len(attrs) > 0 {
+			err = tx.Table(attributes).Create(attrs).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func deleteSearchDocuments(tx *gorm.DB, generation int, ids ...string) error {
+	documents, attributes := searchTables(generation)
+	err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE id IN ?", documents), ids).Error
+	if err != nil {
+		return err
+	}
+	return tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE document_id IN ?", attributes), ids).Error
+}
+
+func searchDocuments(tx *gorm.DB, generation int, match string, q *SearchQuery) *gorm.DB {
+	documents, attributes := searchTables(generation)
+	tx = tx.Table(documents)
+	if match != "" {
+		tx = tx.Where(documents+" MATCH ?", match)
+	}
+
+	hasAttribute := "id IN (SELECT document_id FROM " + attributes + " WHERE name = ? AND value %s ?)"
+	for facet, value := range q.Filters() {
+		tx = tx.Where(fmt.Sprintf(hasAttribute, "="), facet, value)
+	}
+	if !q.From.IsZero() {
+		tx = tx.Where(fmt.Sprintf(hasAttribute, ">="), searchAttributeDate, q.From.UTC().Format(searchDateFormat))
+	}
+	if !q.To.IsZero() {
+		tx = tx.Where(fmt.Sprintf(hasAttribute, "<="), searchAttributeDate, q.To.UTC().Format(searchDateFormat))
+	}
+	return tx
+}
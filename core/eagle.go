@@ -3,3 +3,7 @@ package core
 type Notifier interface {
 	Notify(msg string)
 }
+
+type Mailer interface {
+	Mail(to, subject, body string) error
+}
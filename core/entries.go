@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"math/big"
 	urlpkg "net/url"
 	"os"
 	"path/filepath"
@@ -36,20 +37,81 @@ type Photo struct {
 	Alt    string `yaml:"alt,omitempty"`
 	Width  int    `yaml:"width,omitempty"`
 	Height int    `yaml:"height,omitempty"`
+	Exif   *Exif  `yaml:"exif,omitempty"`
+
+	Renditions *Renditions `yaml:"renditions,omitempty"`
+}
+
+// Renditions is the manifest of the resized versions of an "image:" [Photo].
+// Each format is available in each of the widths. If there are no formats, or
+// no widths, only the original exists.
+type Renditions struct {
+	Formats []string `yaml:"formats,omitempty" json:"formats"`
+	Widths  []int    `yaml:"widths,omitempty" json:"widths"`
+}
+
+// Exif is the subset of the EXIF metadata of a [Photo] that is worth keeping
+// around for display purposes.
+type Exif struct {
+	Make            string    `yaml:"make,omitempty"`
+	Model           string    `yaml:"model,omitempty"`
+	LensMake        string    `yaml:"lensMake,omitempty"`
+	LensModel       string    `yaml:"lensModel,omitempty"`
+	FocalLength     float64   `yaml:"focalLength,omitempty"`     // In millimeters.
+	FocalLength35mm int       `yaml:"focalLength35mm,omitempty"` // In millimeters.
+	Aperture        float64   `yaml:"aperture,omitempty"`        // The f-number.
+	ExposureTime    string    `yaml:"exposureTime,omitempty"`    // In seconds, e.g. 1/250.
+	ISO             int       `yaml:"iso,omitempty"`
+	TakenAt         time.Time `yaml:"takenAt,omitempty"`
+	Latitude        float64   `yaml:"latitude,omitempty"`
+	Longitude       float64   `yaml:"longitude,omitempty"`
+}
+
+// ExposureSeconds returns the exposure time in seconds, or 0 if unknown.
+func (e *Exif) ExposureSeconds() float64 {
+	r, ok := new(big.Rat).SetString(e.ExposureTime)
+	if !ok {
+		return 0
+	}
+	f, _ := r.Float64()
+	return f
+}
+
+// Video is a video uploaded to the media storage.
+type Video struct {
+	URL      string  `yaml:"url,omitempty"` // Web-friendly rendition, if transcoded, or the original.
+	Title    string  `yaml:"title,omitempty"`
+	MimeType string  `yaml:"mimeType,omitempty"`
+	Poster   string  `yaml:"poster,omitempty"` // An "image:" photo.
+	Width    int     `yaml:"width,omitempty"`
+	Height   int     `yaml:"height,omitempty"`
+	Duration float64 `yaml:"duration,omitempty"` // In seconds.
+}
+
+// Audio is an audio file uploaded to the media storage.
+type Audio struct {
+	URL      string  `yaml:"url,omitempty"` // Web-friendly rendition, if transcoded, or the original.
+	Title    string  `yaml:"title,omitempty"`
+	MimeType string  `yaml:"mimeType,omitempty"`
+	Duration float64 `yaml:"duration,omitempty"` // In seconds.
 }
 
 type FrontMatter struct {
-	Title        string         `yaml:"title,omitempty"`
-	Description  string         `yaml:"description,omitempty"`
-	Draft        bool           `yaml:"draft,omitempty"`
-	Date         time.Time      `yaml:"date,omitempty"`
-	LastMod      time.Time      `yaml:"lastmod,omitempty"`
-	ExpiryDate   time.Time      `yaml:"expiryDate,omitempty"`
-	NoIndex      bool           `yaml:"noIndex,omitempty"`
-	Photos       []Photo        `yaml:"photos,omitempty"`
-	Location     *maze.Location `yaml:"location,omitempty"`
-	Categories   []string       `yaml:"categories,omitempty"`
-	Tags         []string       `yaml:"tags,omitempty"`
+	Title       string         `yaml:"title,omitempty"`
+	Description string         `yaml:"description,omitempty"`
+	Draft       bool           `yaml:"draft,omitempty"`
+	Date        time.Time      `yaml:"date,omitempty"`
+	LastMod     time.Time      `yaml:"lastmod,omitempty"`
+	ExpiryDate  time.Time      `yaml:"expiryDate,omitempty"`
+	NoIndex     bool           `yaml:"noIndex,omitempty"`
+	Photos      []Photo        `yaml:"photos,omitempty"`
+	Videos      []Video        `yaml:"videos,omitempty"`
+	Audio       []Audio        `yaml:"audio,omitempty"`
+	Location    *maze.Location `yaml:"location,omitempty"`
+	Categories  []string       `yaml:"categories,omitempty"`
+	Tags        []string       `yaml:"tags,omitempty"`
+	// Author is the username of the user who created the entry.
+	Author       string         `yaml:"author,omitempty"`
 	Syndications []string       `yaml:"syndication,omitempty"`
 	Other        map[string]any `yaml:",inline"`
 }
@@ -156,6 +218,38 @@ func (e *Entry) IsPost() bool {
 	return strings.HasPrefix(e.ID, "/"+PostsSection+"/")
 }
 
+// Section returns the top-level section of the entry, such as "posts", or an
+// empty string for the home page.
+func (e *Entry) Section() string {
+	section, _, _ := strings.Cut(strings.Trim(e.ID, "/"), "/")
+	return section
+}
+
+const (
+	KindArticle = "article"
+	KindNote    = "note"
+	KindPhoto   = "photo"
+	KindVideo   = "video"
+	KindAudio   = "audio"
+)
+
+// Kind returns the kind of the entry, inferred from its contents in the
+// spirit of the IndieWeb post type discovery algorithm.
+func (e *Entry) Kind() string {
+	switch {
+	case len(e.Videos) > 0:
+		return KindVideo
+	case len(e.Audio) > 0:
+		return KindAudio
+	case len(e.Photos) > 0:
+		return KindPhoto
+	case e.Title != "":
+		return KindArticle
+	default:
+		return KindNote
+	}
+}
+
 type Entries []*Entry
 
 func NewPostID(slug string, t time.Time) string {
@@ -306,6 +400,11 @@ func (co *Core) GetEntries(includeList bool) (Entries, error) {
 }
 
 func (co *Core) SaveEntry(e *Entry) error {
+	return co.SaveEntryAs(nil, e)
+}
+
+// SaveEntryAs saves the entry, which is committed by the given author.
+func (co *Core) SaveEntryAs(author *CommitAuthor, e *Entry) error {
 	if e.NoFileSystem {
 		return nil
 	}
@@ -321,7 +420,7 @@ func (co *Core) SaveEntry(e *Entry) error {
 		return err
 	}
 
-	err = co.WriteFile(filename, []byte(str), "entry: update "+e.ID)
+	err = co.WriteFileAs(author, filename, []byte(str), "entry: update "+e.ID)
 	if err != nil {
 		return fmt.Errorf("could not save entry: %w", err)
 	}
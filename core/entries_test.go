@@ -123,3 +123,15 @@ func TestEntryIsPost(t *testing.T) {
 		ID:          "/about/",
 	}).IsPost())
 }
+
+func TestEntrySectionAndKind(t *testing.T) {
+	assert.Equal(t, "posts", (&Entry{ID: "/posts/2026/01/01/test-entry/"}).Section())
+	assert.Equal(t, "about", (&Entry{ID: "/about/"}).Section())
+	assert.Equal(t, "", (&Entry{ID: "/"}).Section())
+
+	assert.Equal(t, KindNote, (&Entry{}).Kind())
+	assert.Equal(t, KindArticle, (&Entry{FrontMatter: FrontMatter{Title: "Hello"}}).Kind())
+	assert.Equal(t, KindPhoto, (&Entry{FrontMatter: FrontMatter{Title: "Hello", Photos: []Photo{{}}}}).Kind())
+	assert.Equal(t, KindVideo, (&Entry{FrontMatter: FrontMatter{Photos: []Photo{{}}, Videos: []Video{{}}}}).Kind())
+	assert.Equal(t, KindAudio, (&Entry{FrontMatter: FrontMatter{Audio: []Audio{{}}}}).Kind())
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -15,6 +16,19 @@ const (
 	GoneFile      = "gone"
 )
 
+// IsHiddenPath returns whether any element of the path starts with a dot, such
+// as the ".git" directory. Hidden files must not be read nor written on behalf
+// of the users: the git configuration, for example, can run arbitrary commands.
+func IsHiddenPath(filename string) bool {
+	for _, part := range strings.Split(filepath.ToSlash(filename), "/") {
+		if strings.HasPrefix(part, ".") && part != "." {
+			return true
+		}
+	}
+
+	return false
+}
+
 type ModifiedFile struct {
 	Filename string
 	Content  string
@@ -25,12 +39,17 @@ func (co *Core) Sync() ([]ModifiedFile, error) {
 }
 
 func (co *Core) WriteFile(filename string, data []byte, message string) error {
+	return co.WriteFileAs(nil, filename, data, message)
+}
+
+// WriteFileAs writes the file, which is committed by the given author.
+func (co *Core) WriteFileAs(author *CommitAuthor, filename string, data []byte, message string) error {
 	err := co.sourceFS.WriteFile(filename, data, 0644)
 	if err != nil {
 		return err
 	}
 
-	return co.sourceSync.Persist(message, filename)
+	return co.sourceSync.Persist(author, message, filename)
 }
 
 func (co *Core) WriteFiles(filesAndData map[string][]byte, message string) error {
@@ -44,7 +63,7 @@ func (co *Core) WriteFiles(filesAndData map[string][]byte, message string) error
 		filenames = append(filenames, filename)
 	}
 
-	return co.sourceSync.Persist(message, filenames...)
+	return co.sourceSync.Persist(nil, message, filenames...)
 }
 
 func (co *Core) ReadFile(filename string) ([]byte, error) {
@@ -0,0 +1,23 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsHiddenPath(t *testing.T) {
+	for filename, hidden := range map[string]bool{
+		"/":                         false,
+		"/content/posts/index.md":   false,
+		"/content/my.post/index.md": false,
+		"/.git":                     true,
+		"/.git/config":              true,
+		"/.github/workflows/ci.yml": true,
+		"/content/.hidden/index.md": true,
+		"/.gitattributes":           true,
+		".git/hooks/pre-commit":     true,
+	} {
+		assert.Equal(t, hidden, IsHiddenPath(filename), filename)
+	}
+}
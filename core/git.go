@@ -10,14 +10,25 @@ import (
 	"github.com/samber/lo"
 )
 
+// CommitAuthor is the author of the commits. If nil, the git identity of the
+// source repository is used.
+type CommitAuthor struct {
+	Name  string
+	Email string
+}
+
+func (a *CommitAuthor) String() string {
+	return fmt.Sprintf("%s <%s>", a.Name, a.Email)
+}
+
 type fsSync interface {
 	Sync() (modified []ModifiedFile, err error)
-	Persist(message string, filename ...string) error
+	Persist(author *CommitAuthor, message string, filename ...string) error
 }
 
 type noopGit struct{}
 
-func (g *noopGit) Persist(message string, file ...string) error {
+func (g *noopGit) Persist(author *CommitAuthor, message string, file ...string) error {
 	return nil
 }
 
@@ -32,20 +43,39 @@ type git struct {
 	dir      string
 	mu       sync.Mutex
 	messages []string
+	// author is the author of the staged changes.
+	author *CommitAuthor
 }
 
 func newGit(path string) fsSync {
 	return &git{dir: path}
 }
 
-func (g *git) Persist(message string, filenames ...string) error {
+func (g *git) Persist(author *CommitAuthor, message string, filenames ...string) error {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
+	// Changes from different authors are never committed together, so the
+	// staged changes are committed first.
+	if len(g.messages) > 0 && !sameAuthor(g.author, author) {
+		err := g.commitStaged()
+		if err != nil {
+			return err
+		}
+	}
+
+	g.author = author
 	g.messages = append(g.messages, message)
 	return g.add(filenames...)
 }
 
+func sameAuthor(a, b *CommitAuthor) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
 func (g *git) add(filenames ...string) error {
 	filenames = lo.Map(filenames, func(v string, _ int) string {
 		return strings.TrimPrefix(v, "/")
@@ -61,7 +91,11 @@ func (g *git) add(filenames ...string) error {
 }
 
 func (g *git) commit(message string) error {
-	args := []string{"commit", "-m", message, "--"}
+	args := []string{"commit", "-m", message}
+	if g.author != nil {
+		args = append(args, "--author", g.author.String())
+	}
+	args = append(args, "--")
 	cmd := exec.Command("git", args...)
 	cmd.Dir = g.dir
 	out, err := cmd.CombinedOutput()
@@ -83,22 +117,9 @@ func (g *git) Sync() ([]ModifiedFile, error) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
-	if g.hasStaged() {
-		g.messages = lo.Uniq(g.messages)
-		var message string
-
-		if len(g.messages) == 1 {
-			message = g.messages[0]
-		} else {
-			message = strings.Join(g.messages, "\n")
-			message = "eagle: add staged changes \n\n" + message
-		}
-
-		err := g.commit(message)
-		if err != nil {
-			return nil, fmt.Errorf("failed to commit staged: %w", err)
-		}
-		g.messages = nil
+	err := g.commitStaged()
+	if err != nil {
+		return nil, err
 	}
 
 	oldCommit, err := g.currentCommit()
@@ -124,6 +145,29 @@ func (g *git) Sync() ([]ModifiedFile, error) {
 	return changedFiles, nil
 }
 
+func (g *git) commitStaged() error {
+	if g.hasStaged() {
+		g.messages = lo.Uniq(g.messages)
+		var message string
+
+		if len(g.messages) == 1 {
+			message = g.messages[0]
+		} else {
+			message = strings.Join(g.messages, "\n")
+			message = "eagle: add staged changes \n\n" + message
+		}
+
+		err := g.commit(message)
+		if err != nil {
+			return fmt.Errorf("failed to commit staged: %w", err)
+		}
+	}
+
+	g.messages = nil
+	g.author = nil
+	return nil
+}
+
 func (g *git) push() error {
 	cmd := exec.Command("git", "push")
 	cmd.Dir = g.dir
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGitPersistAuthors(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir := t.TempDir()
+	run := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+
+	run("init", "-q")
+	run("config", "user.name", "Eagle")
+	run("config", "user.email", "eagle@example.com")
+	run("commit", "-q", "--allow-empty", "-m", "initial")
+
+	g := newGit(dir).(*git)
+	persist := func(author *CommitAuthor, filename string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, filename), []byte(filename), 0644))
+		require.NoError(t, g.Persist(author, "update "+filename, filename))
+	}
+
+	jane := &CommitAuthor{Name: "Jane", Email: "jane@example.com"}
+	persist(nil, "a")
+	persist(jane, "b")
+	persist(&CommitAuthor{Name: "Jane", Email: "jane@example.com"}, "c")
+	require.NoError(t, g.commitStaged())
+
+	log := run("log", "--format=%an <%ae> %s")
+	assert.Equal(t, strings.Join([]string{
+		"Jane <jane@example.com> eagle: add staged changes",
+		"Eagle <eagle@example.com> update a",
+		"Eagle <eagle@example.com> initial",
+	}, "\n"), log)
+	assert.Equal(t, "b\nc", run("show", "--name-only", "--format=", "HEAD"))
+}
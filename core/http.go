@@ -0,0 +1,103 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	urlpkg "net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrNonPublicAddress is returned when connecting to an address that is not
+// public, such as the local machine or a private network.
+var ErrNonPublicAddress = errors.New("address is not public")
+
+// sharedAddressSpace is the carrier-grade NAT range, which is not public either.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// IsPublicIP returns whether the IP address is reachable on the public
+// internet: it is not loopback, private, link-local, unspecified or multicast.
+func IsPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() &&
+		!ip.IsUnspecified() &&
+		!sharedAddressSpace.Contains(ip)
+}
+
+// NewPublicHTTPClient returns an HTTP client for URLs given by third parties,
+// which only connects to public IP addresses. The addresses are checked when
+// dialing, after the DNS resolution, such that hostnames resolving to private
+// addresses and redirects to them are rejected as well.
+func NewPublicHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			if ip := net.ParseIP(host); ip == nil || !IsPublicIP(ip) {
+				return fmt.Errorf("%w: %s", ErrNonPublicAddress, address)
+			}
+
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would be dialed instead of the actual address.
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:       timeout,
+		Transport:     transport,
+		CheckRedirect: checkPublicRedirect,
+	}
+}
+
+func checkPublicRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+	}
+
+	if IsPrivateURL(req.URL.String()) {
+		return fmt.Errorf("%w: %s", ErrNonPublicAddress, req.URL.Host)
+	}
+
+	return nil
+}
+
+// IsPrivateURL returns whether the URL points to the local machine or to a
+// non-public address. It does not resolve the hostname: it only allows failing
+// early, and the requests must still be made with [NewPublicHTTPClient].
+func IsPrivateURL(urlStr string) bool {
+	url, _ := urlpkg.Parse(urlStr)
+	if url == nil {
+		return false
+	}
+
+	hostname := url.Hostname()
+	if hostname == "localhost" || strings.HasSuffix(hostname, ".localhost") {
+		return true
+	}
+
+	ip := net.ParseIP(hostname)
+	if ip == nil {
+		return false
+	}
+
+	return !IsPublicIP(ip)
+}
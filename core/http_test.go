@@ -0,0 +1,73 @@
+package core
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	for ip, public := range map[string]bool{
+		"1.1.1.1":            true,
+		"2606:4700::1111":    true,
+		"127.0.0.1":          false,
+		"::1":                false,
+		"10.0.0.1":           false,
+		"192.168.1.1":        false,
+		"172.16.0.1":         false,
+		"fd00::1":            false,
+		"169.254.169.254":    false,
+		"fe80::1":            false,
+		"0.0.0.0":            false,
+		"::":                 false,
+		"224.0.0.1":          false,
+		"ff02::1":            false,
+		"100.64.0.1":         false,
+		"::ffff:127.0.0.1":   false,
+		"::ffff:169.254.1.1": false,
+	} {
+		assert.Equal(t, public, IsPublicIP(net.ParseIP(ip)), ip)
+	}
+}
+
+func TestIsPrivateURL(t *testing.T) {
+	assert.True(t, IsPrivateURL("http://localhost/"))
+	assert.True(t, IsPrivateURL("http://app.localhost/"))
+	assert.True(t, IsPrivateURL("http://169.254.169.254/latest/meta-data/"))
+	assert.True(t, IsPrivateURL("http://[::1]:8080/"))
+	assert.False(t, IsPrivateURL("https://example.com/"))
+}
+
+func TestPublicHTTPClient(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	client := NewPublicHTTPClient(time.Second * 5)
+
+	// The addresses are checked after resolving the hostname.
+	u, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	u.Host = "localhost:" + u.Port()
+
+	for _, target := range []string{ts.URL, u.String()} {
+		_, err = client.Get(target)
+		assert.ErrorIs(t, err, ErrNonPublicAddress, target)
+	}
+
+	// Redirects are checked before following them.
+	for _, target := range []string{"http://127.0.0.1/", "http://169.254.169.254/", "file:///etc/passwd"} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		assert.Error(t, client.CheckRedirect(req, []*http.Request{{}}), target)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	assert.NoError(t, client.CheckRedirect(req, []*http.Request{{}}))
+}
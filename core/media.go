@@ -0,0 +1,28 @@
+package core
+
+import "time"
+
+// MediaFile is a file uploaded to the media storage.
+type MediaFile struct {
+	// ID is the filename of the original in the storage.
+	ID string
+	// Reference is how entries refer to the file: the "image:" URL for photos,
+	// the URL of the web-friendly rendition for transcoded videos and audio, or
+	// the public URL of the original otherwise.
+	Reference   string `gorm:"index"`
+	URL         string
+	ContentType string
+	Size        int
+	Width       int
+	Height      int
+	Renditions  *Renditions `gorm:"serializer:json"` // Only for photos.
+	// Derived are the other files in the storage generated from the original,
+	// such as the transcoded videos and audio.
+	Derived []string `gorm:"serializer:json"`
+	Created time.Time
+}
+
+// IsImage returns whether the file is an "image:" photo.
+func (f *MediaFile) IsImage() bool {
+	return f.Renditions != nil
+}
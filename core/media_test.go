@@ -0,0 +1,63 @@
+package core
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDatabase(t *testing.T) *Database {
+	t.Helper()
+	f, err := os.CreateTemp("", "eagle-db-*.db")
+	require.NoError(t, err)
+	_ = f.Close()
+	t.Cleanup(func() {
+		_ = os.Remove(f.Name())
+	})
+
+	db, err := newDatabase(f.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	return db
+}
+
+func TestMediaFiles(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+
+	require.NoError(t, db.SaveMediaFile(ctx, &MediaFile{
+		ID:         "2024-01-01-cat.jpeg",
+		Reference:  "image:2024-01-01-cat",
+		Renditions: &Renditions{Formats: []string{"webp"}, Widths: []int{600}},
+		Created:    time.Now().Add(-time.Hour),
+	}))
+	require.NoError(t, db.SaveMediaFile(ctx, &MediaFile{
+		ID:        "2024-01-02-notes.pdf",
+		Reference: "https://media.example.com/2024-01-02-notes.pdf",
+		Created:   time.Now(),
+	}))
+
+	files, err := db.GetMediaFiles(ctx, "", 0)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	assert.Equal(t, "2024-01-02-notes.pdf", files[0].ID)
+	assert.False(t, files[0].IsImage())
+	assert.True(t, files[1].IsImage())
+	assert.Equal(t, []int{600}, files[1].Renditions.Widths)
+
+	files, err = db.GetMediaFiles(ctx, "cat", 10)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "image:2024-01-01-cat", files[0].Reference)
+
+	require.NoError(t, db.DeleteMediaFile(ctx, "2024-01-01-cat.jpeg"))
+	_, err = db.GetMediaFile(ctx, "2024-01-01-cat.jpeg")
+	assert.Error(t, err)
+}
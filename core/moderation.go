@@ -0,0 +1,197 @@
+package core
+
+import (
+	urlpkg "net/url"
+	"strings"
+	"time"
+)
+
+type MentionRuleType string
+
+const (
+	// MentionRuleAllowDomain approves the webmentions whose source is in the
+	// domain, or any of its subdomains. Only the source is verified, so the URL
+	// that the source page declares for itself is not considered.
+	MentionRuleAllowDomain MentionRuleType = "allow-domain"
+	// MentionRuleAllowAuthor approves the webmentions of the author, given by
+	// URL. The author URL must be on the same host as the source, see
+	// [Mention.VerifiedAuthorURL].
+	MentionRuleAllowAuthor MentionRuleType = "allow-author"
+	// MentionRuleAllowType approves the webmentions of an interaction type,
+	// such as like or repost.
+	MentionRuleAllowType MentionRuleType = "allow-type"
+	// MentionRuleAllowApproved approves the webmentions of the authors whose
+	// mentions were approved before, identified by their verified author URL.
+	// It has no value.
+	MentionRuleAllowApproved MentionRuleType = "allow-approved"
+	// MentionRuleBlockDomain drops the mentions whose source, or author, is
+	// in the domain, or any of its subdomains.
+	MentionRuleBlockDomain MentionRuleType = "block-domain"
+	// MentionRuleBlockAuthor drops the mentions of the author, given by URL
+	// or name.
+	MentionRuleBlockAuthor MentionRuleType = "block-author"
+)
+
+var MentionRuleTypes = []MentionRuleType{
+	MentionRuleAllowDomain,
+	MentionRuleAllowAuthor,
+	MentionRuleAllowType,
+	MentionRuleAllowApproved,
+	MentionRuleBlockDomain,
+	MentionRuleBlockAuthor,
+}
+
+// MentionRule is a rule that moderates incoming mentions automatically.
+type MentionRule struct {
+	ID      string `gorm:"primaryKey"`
+	Type    MentionRuleType
+	Value   string
+	Created time.Time
+}
+
+// ApprovedAuthor is the URL of an author whose mentions were approved.
+type ApprovedAuthor struct {
+	URL      string `gorm:"primaryKey"`
+	Approved time.Time
+}
+
+type MentionAction int
+
+const (
+	MentionPending MentionAction = iota
+	MentionApprove
+	MentionBlock
+)
+
+// MentionRules are the moderation rules applied to incoming mentions.
+type MentionRules []*MentionRule
+
+// Moderate returns what to do with a new mention, given whether its verified
+// author was approved before. Block rules take precedence over allow rules.
+//
+// Everything but the source of a webmention is declared by the sender, who can
+// claim any name, URL or author. Therefore, allow rules only apply to
+// webmentions, and only trust the source and the author URLs on the same host,
+// while block rules match anything. Comments are never allowed automatically.
+func (rr MentionRules) Moderate(m *Mention, approvedAuthor bool) MentionAction {
+	hosts := m.hosts()
+	source := hostname(m.verifiedSource())
+	author := m.VerifiedAuthorURL()
+	action := MentionPending
+
+	for _, rule := range rr {
+		switch rule.Type {
+		case MentionRuleBlockDomain:
+			if matchesDomain(append(hosts, hostname(m.AuthorURL)), rule.Value) {
+				return MentionBlock
+			}
+		case MentionRuleBlockAuthor:
+			if m.isAuthor(rule.Value) {
+				return MentionBlock
+			}
+		}
+
+		if !m.IsWebmention() {
+			continue
+		}
+
+		switch rule.Type {
+		case MentionRuleAllowDomain:
+			if source != "" && matchesDomain([]string{source}, rule.Value) {
+				action = MentionApprove
+			}
+		case MentionRuleAllowAuthor:
+			if author != "" && NormalizeAuthorURL(author) == NormalizeAuthorURL(rule.Value) {
+				action = MentionApprove
+			}
+		case MentionRuleAllowType:
+			if strings.EqualFold(string(m.Type), rule.Value) {
+				action = MentionApprove
+			}
+		case MentionRuleAllowApproved:
+			if approvedAuthor && author != "" {
+				action = MentionApprove
+			}
+		}
+	}
+
+	return action
+}
+
+// IsWebmention returns whether the mention was received as a webmention,
+// instead of being a comment.
+func (m *Mention) IsWebmention() bool {
+	return m.URL != "" || m.Source != ""
+}
+
+// verifiedSource returns the source of the webmention, which was verified to
+// link to the target. The source is only stored when it differs from the URL,
+// otherwise the URL is the source. Comments have neither.
+func (m *Mention) verifiedSource() string {
+	if m.Source != "" {
+		return m.Source
+	}
+	return m.URL
+}
+
+// VerifiedAuthorURL returns the author URL of the webmention if it is on the
+// same host as the source, which was verified to link to the target. Otherwise,
+// anyone could claim to be the author, and an empty string is returned.
+func (m *Mention) VerifiedAuthorURL() string {
+	source := hostname(m.verifiedSource())
+	if source == "" || m.AuthorURL == "" || hostname(m.AuthorURL) != source {
+		return ""
+	}
+
+	return m.AuthorURL
+}
+
+func (m *Mention) hosts() []string {
+	var hosts []string
+	for _, u := range []string{m.URL, m.Source} {
+		if host := hostname(u); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+func (m *Mention) isAuthor(author string) bool {
+	if m.AuthorURL != "" && NormalizeAuthorURL(m.AuthorURL) == NormalizeAuthorURL(author) {
+		return true
+	}
+
+	return m.Author != "" && strings.EqualFold(m.Author, author)
+}
+
+// NormalizeAuthorURL returns the URL without scheme and trailing slash, such
+// that equivalent author URLs compare equal.
+func NormalizeAuthorURL(u string) string {
+	u = strings.ToLower(strings.TrimSpace(u))
+	u = strings.TrimPrefix(u, "https://")
+	u = strings.TrimPrefix(u, "http://")
+	u = strings.TrimPrefix(u, "www.")
+	return strings.TrimSuffix(u, "/")
+}
+
+func hostname(u string) string {
+	parsed, err := urlpkg.Parse(u)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
+
+func matchesDomain(hosts []string, domain string) bool {
+	domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "."))
+	if domain == "" {
+		return false
+	}
+
+	for _, host := range hosts {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
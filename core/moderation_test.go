@@ -0,0 +1,102 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.hacdias.com/eagle/xray"
+	"go.hacdias.com/indielib/microformats"
+)
+
+func TestMentionRulesModerate(t *testing.T) {
+	like := &Mention{
+		Post: xray.Post{
+			Type:      microformats.TypeLike,
+			URL:       "https://twitter.com/jane/status/1",
+			Author:    "Jane",
+			AuthorURL: "https://twitter.com/jane",
+		},
+		Source: "https://brid.gy/like/twitter/1",
+	}
+
+	reply := &Mention{
+		Post: xray.Post{
+			Type:      microformats.TypeReply,
+			URL:       "https://jane.example/replies/1",
+			Author:    "Jane",
+			AuthorURL: "https://jane.example/",
+		},
+	}
+
+	comment := &Mention{
+		Post: xray.Post{
+			Author:    "Jane",
+			AuthorURL: "https://twitter.com/jane",
+			Content:   "Hello!",
+		},
+	}
+
+	for _, tc := range []struct {
+		name     string
+		rules    MentionRules
+		mention  *Mention
+		approved bool
+		action   MentionAction
+	}{
+		{"no rules", nil, like, false, MentionPending},
+		{"allow type", MentionRules{{Type: MentionRuleAllowType, Value: "like"}}, like, false, MentionApprove},
+		{"allow other type", MentionRules{{Type: MentionRuleAllowType, Value: "repost"}}, like, false, MentionPending},
+		{"allow domain", MentionRules{{Type: MentionRuleAllowDomain, Value: "brid.gy"}}, like, false, MentionApprove},
+		{"allow other domain", MentionRules{{Type: MentionRuleAllowDomain, Value: "id.gy"}}, like, false, MentionPending},
+		{"allow domain of declared url", MentionRules{{Type: MentionRuleAllowDomain, Value: "twitter.com"}}, like, false, MentionPending},
+		{"allow domain without source", MentionRules{{Type: MentionRuleAllowDomain, Value: "jane.example"}}, reply, false, MentionApprove},
+		{"allow author url", MentionRules{{Type: MentionRuleAllowAuthor, Value: "http://jane.example"}}, reply, false, MentionApprove},
+		{"allow author url on other host", MentionRules{{Type: MentionRuleAllowAuthor, Value: "http://twitter.com/jane/"}}, like, false, MentionPending},
+		{"allow author name", MentionRules{{Type: MentionRuleAllowAuthor, Value: "jane"}}, reply, false, MentionPending},
+		{"allow approved", MentionRules{{Type: MentionRuleAllowApproved}}, reply, true, MentionApprove},
+		{"allow approved on other host", MentionRules{{Type: MentionRuleAllowApproved}}, like, true, MentionPending},
+		{"allow not approved", MentionRules{{Type: MentionRuleAllowApproved}}, reply, false, MentionPending},
+		{"block domain", MentionRules{{Type: MentionRuleBlockDomain, Value: "twitter.com"}}, like, false, MentionBlock},
+		{"block author", MentionRules{{Type: MentionRuleBlockAuthor, Value: "Jane"}}, like, false, MentionBlock},
+		{"block wins", MentionRules{
+			{Type: MentionRuleAllowType, Value: "like"},
+			{Type: MentionRuleBlockAuthor, Value: "twitter.com/jane"},
+		}, like, false, MentionBlock},
+		{"allow ignores comments", MentionRules{{Type: MentionRuleAllowAuthor, Value: "https://twitter.com/jane"}}, comment, true, MentionPending},
+		{"block comment domain", MentionRules{{Type: MentionRuleBlockDomain, Value: "twitter.com"}}, comment, false, MentionBlock},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.action, tc.rules.Moderate(tc.mention, tc.approved))
+		})
+	}
+}
+
+func TestMentionRulesDatabase(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+
+	require.NoError(t, db.CreateMentionRule(ctx, &MentionRule{ID: "1", Type: MentionRuleBlockDomain, Value: "spam.example"}))
+	require.NoError(t, db.CreateMentionRule(ctx, &MentionRule{ID: "2", Type: MentionRuleAllowType, Value: "like"}))
+
+	rules, err := db.GetMentionRules(ctx)
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	assert.Equal(t, MentionRuleAllowType, rules[0].Type)
+
+	require.NoError(t, db.DeleteMentionRule(ctx, "2"))
+	rules, err = db.GetMentionRules(ctx)
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+
+	approved, err := db.IsApprovedAuthor(ctx, "twitter.com/jane")
+	require.NoError(t, err)
+	assert.False(t, approved)
+
+	require.NoError(t, db.SaveApprovedAuthor(ctx, &ApprovedAuthor{URL: "twitter.com/jane"}))
+	require.NoError(t, db.SaveApprovedAuthor(ctx, &ApprovedAuthor{URL: "twitter.com/jane"}))
+	approved, err = db.IsApprovedAuthor(ctx, "twitter.com/jane")
+	require.NoError(t, err)
+	assert.True(t, approved)
+}
@@ -0,0 +1,19 @@
+package core
+
+import "time"
+
+// Passkey is a WebAuthn credential registered to login to the panel.
+type Passkey struct {
+	// ID is the base64url-encoded credential ID.
+	ID string `gorm:"primaryKey"`
+	// Username is the user the passkey belongs to. It is empty for the passkeys
+	// registered before there were multiple users, which belong to the owner
+	// from the configuration.
+	Username string `gorm:"index"`
+	Name     string
+	// Credential is the JSON-encoded credential, as given by the WebAuthn
+	// library, including its public key and signature counter.
+	Credential string
+	Created    time.Time
+	LastUsed   time.Time
+}
@@ -0,0 +1,36 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasskeys(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	require.NoError(t, db.CreatePasskey(ctx, &Passkey{ID: "b", Name: "Phone", Created: now.Add(time.Minute)}))
+	require.NoError(t, db.CreatePasskey(ctx, &Passkey{ID: "a", Name: "Laptop", Created: now}))
+
+	passkeys, err := db.GetPasskeys(ctx)
+	require.NoError(t, err)
+	require.Len(t, passkeys, 2)
+	assert.Equal(t, "a", passkeys[0].ID)
+	assert.Equal(t, "b", passkeys[1].ID)
+
+	passkeys[0].Name = "Work Laptop"
+	passkeys[0].LastUsed = now
+	require.NoError(t, db.UpdatePasskey(ctx, passkeys[0]))
+	require.NoError(t, db.DeletePasskey(ctx, "b"))
+
+	passkeys, err = db.GetPasskeys(ctx)
+	require.NoError(t, err)
+	require.Len(t, passkeys, 1)
+	assert.Equal(t, "Work Laptop", passkeys[0].Name)
+	assert.False(t, passkeys[0].LastUsed.IsZero())
+}
@@ -18,13 +18,13 @@ const (
 )
 
 type QueueItem struct {
-	ID           string
-	Type         string `gorm:"index"`
-	Payload      string // JSON-encoded job data
-	Attempts     int
-	FailedReason string
-	Created      time.Time
-	LastAttempt  *time.Time
+	ID           string     `json:"id"`
+	Type         string     `json:"type" gorm:"index"`
+	Payload      string     `json:"payload"` // JSON-encoded job data
+	Attempts     int        `json:"attempts"`
+	FailedReason string     `json:"failedReason,omitempty"`
+	Created      time.Time  `json:"created"`
+	LastAttempt  *time.Time `json:"lastAttempt,omitempty"`
 }
 
 type Queue struct {
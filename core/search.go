@@ -0,0 +1,311 @@
+package core
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"html"
+	"html/template"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Facets of the entries in a [SearchIndex], which can be used to filter the
+// results, and whose counts are returned with them.
+const (
+	SearchFacetTags       = "tags"
+	SearchFacetCategories = "categories"
+	SearchFacetSection    = "section"
+	SearchFacetKind       = "kind"
+	SearchFacetLocation   = "location"
+)
+
+var SearchFacets = []string{
+	SearchFacetTags,
+	SearchFacetCategories,
+	SearchFacetSection,
+	SearchFacetKind,
+	SearchFacetLocation,
+}
+
+// Orders of the search results. The default is by relevance.
+const (
+	SearchSortRelevance = "relevance"
+	SearchSortNewest    = "newest"
+	SearchSortOldest    = "oldest"
+)
+
+// SearchQuery is a query to a [SearchIndex]. An empty query with filters
+// matches all entries passing the filters.
+type SearchQuery struct {
+	Query string
+
+	// Filters. Empty values do not filter.
+	Tag      string
+	Category string
+	Section  string
+	Kind     string
+	Location string
+	From     time.Time
+	To       time.Time
+
+	Sort  string
+	Page  int // Zero-based.
+	Limit int
+}
+
+// Filters returns the non-empty facet filters of the query, by facet.
+func (q *SearchQuery) Filters() map[string]string {
+	filters := map[string]string{}
+	for facet, value := range map[string]string{
+		SearchFacetTags:       q.Tag,
+		SearchFacetCategories: q.Category,
+		SearchFacetSection:    q.Section,
+		SearchFacetKind:       q.Kind,
+		SearchFacetLocation:   q.Location,
+	} {
+		if value != "" {
+			filters[facet] = value
+		}
+	}
+	return filters
+}
+
+// Filtered returns whether the query has any filters.
+func (q *SearchQuery) Filtered() bool {
+	return len(q.Filters()) != 0 || !q.From.IsZero() || !q.To.IsZero()
+}
+
+// SearchResults are the results of a [SearchQuery].
+type SearchResults struct {
+	Hits []*SearchResult
+
+	// Total is the number of matching entries, which may be an estimate.
+	Total int
+
+	// Facets are the values of each facet among all the matching entries,
+	// and not only the current page, most common first.
+	Facets map[string][]SearchFacetValue
+}
+
+type SearchFacetValue struct {
+	Value string
+	Count int
+}
+
+// NewSearchFacets converts the facet counts into sorted [SearchFacetValue]s.
+func NewSearchFacets(counts map[string]map[string]int) map[string][]SearchFacetValue {
+	facets := map[string][]SearchFacetValue{}
+	for facet, values := range counts {
+		for value, count := range values {
+			facets[facet] = append(facets[facet], SearchFacetValue{Value: value, Count: count})
+		}
+
+		slices.SortFunc(facets[facet], func(a, b SearchFacetValue) int {
+			return cmp.Or(b.Count-a.Count, strings.Compare(a.Value, b.Value))
+		})
+	}
+	return facets
+}
+
+// SearchResult is an entry that matches a [SearchQuery].
+type SearchResult struct {
+	*Entry
+
+	// Snippet is an excerpt of the content, with the matches highlighted in
+	// <mark> elements.
+	Snippet template.HTML
+}
+
+// SearchIndex is a full-text search index of the entries.
+type SearchIndex interface {
+	// Add adds or updates the searchable entries in the index.
+	Add(ee ...*Entry) error
+	Remove(ids ...string) error
+
+	// Hashes returns the [SearchDocument.Hash] of each entry in the index.
+	Hashes() (map[string]string, error)
+
+	// Outdated returns whether the index was built with a previous version
+	// of the searchable attributes, and must therefore be rebuilt.
+	Outdated() (bool, error)
+
+	// Rebuild builds a new index with the searchable entries and, once it is
+	// complete, atomically swaps it with the current one. The current one
+	// keeps serving searches in the meantime.
+	Rebuild(ee ...*Entry) error
+
+	Search(q *SearchQuery) (*SearchResults, error)
+}
+
+// SyncSearchIndex brings the index up to date with the entries. If the index
+// is outdated, or rebuild is true, it is rebuilt. Otherwise, only the entries
+// whose hash changed are updated, and the ones no longer searchable removed.
+func SyncSearchIndex(idx SearchIndex, ee Entries, rebuild bool) (updated, removed int, err error) {
+	if !rebuild {
+		rebuild, err = idx.Outdated()
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	var searchable Entries
+	for _, e := range ee {
+		if e.Searchable() {
+			searchable = append(searchable, e)
+		}
+	}
+
+	if rebuild {
+		return len(searchable), 0, idx.Rebuild(searchable...)
+	}
+
+	hashes, err := idx.Hashes()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var changed Entries
+	for _, e := range searchable {
+		if hashes[e.ID] != NewSearchDocument(e).Hash() {
+			changed = append(changed, e)
+		}
+		delete(hashes, e.ID)
+	}
+
+	err = idx.Add(changed...)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var vanished []string
+	for id := range hashes {
+		vanished = append(vanished, id)
+	}
+
+	err = idx.Remove(vanished...)
+	if err != nil {
+		return len(changed), 0, err
+	}
+
+	return len(changed), len(vanished), nil
+}
+
+// Markers delimiting the highlighted matches in the snippets returned by the
+// search backends. Control characters are used such that they cannot clash
+// with the content.
+const (
+	SnippetMarkStart = "\x02"
+	SnippetMarkEnd   = "\x03"
+)
+
+// SnippetHTML escapes the snippet and converts the highlight markers into
+// <mark> elements.
+func SnippetHTML(snippet string) template.HTML {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, SnippetMarkStart, "<mark>")
+	snippet = strings.ReplaceAll(snippet, SnippetMarkEnd, "</mark>")
+	return template.HTML(snippet)
+}
+
+// Searchable returns whether the entry should be in the search index.
+func (e *Entry) Searchable() bool {
+	return !e.Deleted() && !e.Draft && !e.NoIndex
+}
+
+// SearchLocation returns the location of the entry as indexed in the search,
+// which is its locality, or the country if there is none.
+func (e *Entry) SearchLocation() string {
+	if e.Location == nil {
+		return ""
+	}
+	return cmp.Or(e.Location.Locality, e.Location.Country)
+}
+
+// SearchDocument is a document in the embedded full-text search index.
+type SearchDocument struct {
+	ID         string
+	Title      string
+	Content    string
+	Date       time.Time
+	Tags       []string
+	Categories []string
+	Section    string
+	Kind       string
+	Location   string
+}
+
+// NewSearchDocument creates the [SearchDocument] of an entry.
+func NewSearchDocument(e *Entry) *SearchDocument {
+	return &SearchDocument{
+		ID:         e.ID,
+		Title:      e.Title,
+		Content:    e.TextContent(),
+		Date:       e.Date,
+		Tags:       e.Tags,
+		Categories: e.Categories,
+		Section:    e.Section(),
+		Kind:       e.Kind(),
+		Location:   e.SearchLocation(),
+	}
+}
+
+// Hash returns a hash of the indexed contents of the document, which changes
+// whenever the document needs to be reindexed.
+func (doc *SearchDocument) Hash() string {
+	data, _ := json.Marshal(doc)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// attributes returns the filterable attributes of the document.
+func (doc *SearchDocument) attributes() []*searchAttribute {
+	var attributes []*searchAttribute
+	add := func(name string, values ...string) {
+		for _, value := range values {
+			if value != "" {
+				attributes = append(attributes, &searchAttribute{DocumentID: doc.ID, Name: name, Value: value})
+			}
+		}
+	}
+
+	add(SearchFacetTags, doc.Tags...)
+	add(SearchFacetCategories, doc.Categories...)
+	add(SearchFacetSection, doc.Section)
+	add(SearchFacetKind, doc.Kind)
+	add(SearchFacetLocation, doc.Location)
+	if !doc.Date.IsZero() {
+		add(searchAttributeDate, doc.Date.UTC().Format(searchDateFormat))
+	}
+	return attributes
+}
+
+const (
+	searchAttributeDate = "date"
+	// searchDateFormat sorts lexicographically in chronological order.
+	searchDateFormat = "2006-01-02T15:04:05Z"
+)
+
+// searchAttribute is a filterable attribute of a document in the embedded
+// full-text search index.
+type searchAttribute struct {
+	DocumentID string
+	Name       string
+	Value      string
+}
+
+// SearchIndexState records the active generation of the tables of the
+// embedded full-text search index.
+type SearchIndexState struct {
+	ID         int `gorm:"primaryKey"`
+	Version    int
+	Generation int
+}
+
+// SearchHit is a document that matches an embedded full-text search query.
+type SearchHit struct {
+	ID      string
+	Snippet string
+}
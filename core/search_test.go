@@ -0,0 +1,200 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnippetHTML(t *testing.T) {
+	assert.EqualValues(t, "a &lt;b&gt; <mark>cat</mark> &amp; dog", SnippetHTML("a <b> "+SnippetMarkStart+"cat"+SnippetMarkEnd+" & dog"))
+}
+
+func TestSearchDocuments(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+
+	err := db.SearchSupported(ctx)
+	if err != nil {
+		t.Skip(err.Error())
+	}
+
+	outdated, err := db.SearchIndexOutdated(ctx)
+	require.NoError(t, err)
+	assert.True(t, outdated)
+
+	day := func(d int) time.Time {
+		return time.Date(2024, 1, d, 12, 0, 0, 0, time.UTC)
+	}
+
+	// Saving does nothing before the index is built.
+	require.NoError(t, db.SaveSearchDocuments(ctx, &SearchDocument{ID: "/z/", Title: "Cat"}))
+
+	require.NoError(t, db.RebuildSearchIndex(ctx,
+		&SearchDocument{ID: "/a/", Title: "Walking", Content: "A long walk with the cat.", Date: day(1), Section: "posts", Kind: KindArticle, Location: "Lisbon"},
+		&SearchDocument{ID: "/b/", Title: "Cats", Tags: []string{"pets"}, Content: "Nothing else to say.", Date: day(2), Section: "posts", Kind: KindPhoto},
+		&SearchDocument{ID: "/c/", Title: "Dogs", Tags: []string{"cats", "pets"}, Content: "Dogs are fine too.", Date: day(3), Section: "notes", Kind: KindNote},
+	))
+
+	search := func(match string, q *SearchQuery) []string {
+		if q.Limit == 0 {
+			q.Limit = 10
+		}
+		hits, _, err := db.SearchDocuments(ctx, match, q)
+		require.NoError(t, err)
+		var ids []string
+		for _, hit := range hits {
+			ids = append(ids, hit.ID)
+		}
+		return ids
+	}
+
+	hits, total, err := db.SearchDocuments(ctx, `"cat"*`, &SearchQuery{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, hits, 3)
+	assert.Equal(t, 3, total)
+	assert.Equal(t, "/b/", hits[0].ID)
+	assert.Equal(t, "/c/", hits[1].ID)
+	assert.Equal(t, "/a/", hits[2].ID)
+	assert.Contains(t, hits[2].Snippet, SnippetMarkStart+"cat"+SnippetMarkEnd)
+
+	assert.Equal(t, []string{"/a/", "/b/", "/c/"}, search(`"cat"*`, &SearchQuery{Sort: SearchSortOldest}))
+	assert.Equal(t, []string{"/c/", "/b/", "/a/"}, search(`"cat"*`, &SearchQuery{Sort: SearchSortNewest}))
+	assert.Equal(t, []string{"/c/", "/b/", "/a/"}, search("", &SearchQuery{}))
+	assert.Equal(t, []string{"/b/"}, search(`"cat"*`, &SearchQuery{Limit: 1}))
+	assert.Equal(t, []string{"/c/"}, search(`"cat"*`, &SearchQuery{Limit: 1, Page: 1}))
+
+	_, total, err = db.SearchDocuments(ctx, "", &SearchQuery{Tag: "pets", Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+	assert.Equal(t, []string{"/c/", "/b/"}, search("", &SearchQuery{Tag: "pets"}))
+	assert.Equal(t, []string{"/b/", "/a/"}, search("", &SearchQuery{Section: "posts"}))
+	assert.Equal(t, []string{"/b/"}, search("", &SearchQuery{Section: "posts", Tag: "pets"}))
+	assert.Equal(t, []string{"/a/"}, search(`"walk"*`, &SearchQuery{Location: "Lisbon"}))
+	assert.Equal(t, []string{"/b/"}, search("", &SearchQuery{From: day(2), To: day(2)}))
+
+	counts, err := db.SearchFacetCounts(ctx, `"cat"*`, &SearchQuery{Section: "posts"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]map[string]int{
+		SearchFacetTags:     {"pets": 1},
+		SearchFacetSection:  {"posts": 2},
+		SearchFacetKind:     {KindArticle: 1, KindPhoto: 1},
+		SearchFacetLocation: {"Lisbon": 1},
+	}, counts)
+
+	// Saving again replaces the document.
+	require.NoError(t, db.SaveSearchDocuments(ctx, &SearchDocument{ID: "/a/", Title: "Walking", Content: "A long walk."}))
+	assert.Equal(t, []string{"/b/", "/c/"}, search(`"cat"*`, &SearchQuery{}))
+	assert.Empty(t, search("", &SearchQuery{Location: "Lisbon"}))
+
+	require.NoError(t, db.DeleteSearchDocuments(ctx, "/b/"))
+	assert.Equal(t, []string{"/c/"}, search(`"cat"*`, &SearchQuery{}))
+	assert.Equal(t, []string{"/c/"}, search("", &SearchQuery{Tag: "pets"}))
+
+	hashes, err := db.GetSearchHashes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"/a/": (&SearchDocument{ID: "/a/", Title: "Walking", Content: "A long walk."}).Hash(),
+		"/c/": (&SearchDocument{ID: "/c/", Title: "Dogs", Tags: []string{"cats", "pets"}, Content: "Dogs are fine too.", Date: day(3), Section: "notes", Kind: KindNote}).Hash(),
+	}, hashes)
+
+	// Rebuilding replaces all documents and drops the previous tables.
+	require.NoError(t, db.RebuildSearchIndex(ctx, &SearchDocument{ID: "/d/", Title: "Cat"}))
+	assert.Equal(t, []string{"/d/"}, search(`"cat"*`, &SearchQuery{}))
+	assert.Empty(t, search("", &SearchQuery{Tag: "pets"}))
+	assert.False(t, db.db.Migrator().HasTable("search_documents_1"))
+	assert.True(t, db.db.Migrator().HasTable("search_documents_2"))
+
+	outdated, err = db.SearchIndexOutdated(ctx)
+	require.NoError(t, err)
+	assert.False(t, outdated)
+}
+
+type memorySearchIndex struct {
+	outdated bool
+	docs     map[string]string
+	rebuilt  bool
+}
+
+func (m *memorySearchIndex) Add(ee ...*Entry) error {
+	for _, e := range ee {
+		m.docs[e.ID] = NewSearchDocument(e).Hash()
+	}
+	return nil
+}
+
+func (m *memorySearchIndex) Remove(ids ...string) error {
+	for _, id := range ids {
+		delete(m.docs, id)
+	}
+	return nil
+}
+
+func (m *memorySearchIndex) Hashes() (map[string]string, error) {
+	hashes := map[string]string{}
+	for id, hash := range m.docs {
+		hashes[id] = hash
+	}
+	return hashes, nil
+}
+
+func (m *memorySearchIndex) Outdated() (bool, error) {
+	return m.outdated, nil
+}
+
+func (m *memorySearchIndex) Rebuild(ee ...*Entry) error {
+	m.rebuilt = true
+	m.outdated = false
+	m.docs = map[string]string{}
+	return m.Add(ee...)
+}
+
+func (m *memorySearchIndex) Search(q *SearchQuery) (*SearchResults, error) {
+	return &SearchResults{}, nil
+}
+
+func TestSyncSearchIndex(t *testing.T) {
+	entries := Entries{
+		{ID: "/a/", FrontMatter: FrontMatter{Title: "A"}},
+		{ID: "/b/", FrontMatter: FrontMatter{Title: "B"}},
+		{ID: "/c/", FrontMatter: FrontMatter{Title: "C", Draft: true}},
+	}
+
+	idx := &memorySearchIndex{outdated: true, docs: map[string]string{}}
+	updated, removed, err := SyncSearchIndex(idx, entries, false)
+	require.NoError(t, err)
+	assert.True(t, idx.rebuilt)
+	assert.Equal(t, 2, updated)
+	assert.Equal(t, 0, removed)
+	assert.Len(t, idx.docs, 2)
+
+	idx.rebuilt = false
+	updated, removed, err = SyncSearchIndex(idx, entries, false)
+	require.NoError(t, err)
+	assert.False(t, idx.rebuilt)
+	assert.Equal(t, 0, updated)
+	assert.Equal(t, 0, removed)
+
+	entries[0].Title = "A!"
+	entries[1].Draft = true
+	updated, removed, err = SyncSearchIndex(idx, entries, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, updated)
+	assert.Equal(t, 1, removed)
+	assert.Equal(t, map[string]string{"/a/": NewSearchDocument(entries[0]).Hash()}, idx.docs)
+
+	_, _, err = SyncSearchIndex(idx, entries, true)
+	require.NoError(t, err)
+	assert.True(t, idx.rebuilt)
+}
+
+func TestNewSearchFacets(t *testing.T) {
+	assert.Equal(t, map[string][]SearchFacetValue{
+		SearchFacetTags: {{"b", 3}, {"a", 1}, {"c", 1}},
+	}, NewSearchFacets(map[string]map[string]int{
+		SearchFacetTags: {"a": 1, "b": 3, "c": 1},
+	}))
+}
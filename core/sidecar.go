@@ -1,6 +1,9 @@
 package core
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"os"
 	"path/filepath"
 	"sort"
@@ -16,8 +19,15 @@ const (
 type Mention struct {
 	xray.Post `gorm:"embedded"`
 	Source    string `json:"source,omitempty"`
-	ID        string `json:"-"`
+	ID        string `json:"id,omitempty"`
 	EntryID   string `json:"-"`
+
+	// ParentID is the ID of the comment this comment replies to, if any.
+	ParentID string `json:"parentId,omitempty"`
+
+	// SpamScore is the probability, between 0 and 1, of the mention being
+	// spam according to the [SpamFilter] when it was received.
+	SpamScore float64 `json:"-"`
 }
 
 func (m *Mention) IsInteraction() bool {
@@ -27,16 +37,81 @@ func (m *Mention) IsInteraction() bool {
 		m.Type == microformats.TypeRsvp
 }
 
+// legacyID returns an ID derived from the contents of a mention published
+// before mentions had IDs, such that it can be referred to.
+func (m *Mention) legacyID() string {
+	h := sha256.New()
+	for _, v := range []string{m.URL, m.Source, m.Author, m.AuthorURL, m.Content, m.Date.String()} {
+		h.Write([]byte(v))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+var ErrMentionNotFound = errors.New("mention not found")
+
 type Sidecar struct {
 	Context      *xray.Post `json:"context,omitempty"`
 	Replies      []*Mention `json:"replies,omitempty"`
 	Interactions []*Mention `json:"interactions,omitempty"`
+
+	// Hidden are the mentions that were published, but have been hidden. They
+	// are kept such that they can be shown again.
+	Hidden []*Mention `json:"hidden,omitempty"`
 }
 
 func (s *Sidecar) Empty() bool {
 	return s.Context == nil &&
 		len(s.Replies) == 0 &&
-		len(s.Interactions) == 0
+		len(s.Interactions) == 0 &&
+		len(s.Hidden) == 0
+}
+
+func (s *Sidecar) lists() []*[]*Mention {
+	return []*[]*Mention{&s.Replies, &s.Interactions, &s.Hidden}
+}
+
+// FindMention returns the mention with the given ID and whether it is hidden.
+func (s *Sidecar) FindMention(id string) (*Mention, bool, error) {
+	for _, list := range s.lists() {
+		for _, m := range *list {
+			if m.ID == id {
+				return m, list == &s.Hidden, nil
+			}
+		}
+	}
+	return nil, false, ErrMentionNotFound
+}
+
+// DeleteMention removes the mention with the given ID.
+func (s *Sidecar) DeleteMention(id string) (*Mention, error) {
+	for _, list := range s.lists() {
+		for i, m := range *list {
+			if m.ID == id {
+				*list = append((*list)[:i], (*list)[i+1:]...)
+				return m, nil
+			}
+		}
+	}
+	return nil, ErrMentionNotFound
+}
+
+// HideMention moves the mention with the given ID to, or from, the hidden
+// mentions.
+func (s *Sidecar) HideMention(id string, hidden bool) error {
+	m, err := s.DeleteMention(id)
+	if err != nil {
+		return err
+	}
+
+	if hidden {
+		s.Hidden = append(s.Hidden, m)
+	} else if m.IsInteraction() {
+		s.Interactions = append(s.Interactions, m)
+	} else {
+		s.Replies = append(s.Replies, m)
+	}
+	return nil
 }
 
 func (f *Core) getSidecar(entry *Entry) (*Sidecar, string, error) {
@@ -63,13 +138,21 @@ func (f *Core) getSidecar(entry *Entry) (*Sidecar, string, error) {
 		sidecar.Interactions = []*Mention{}
 	}
 
+	for _, list := range sidecar.lists() {
+		for _, m := range *list {
+			if m.ID == "" {
+				m.ID = m.legacyID()
+			}
+		}
+	}
+
 	return sidecar, filename, err
 }
 
-// func (f *Core) GetSidecar(entry *Entry) (*Sidecar, error) {
-// 	sidecar, _, err := f.getSidecar(entry)
-// 	return sidecar, err
-// }
+func (f *Core) GetSidecar(entry *Entry) (*Sidecar, error) {
+	sidecar, _, err := f.getSidecar(entry)
+	return sidecar, err
+}
 
 func (f *Core) UpdateSidecar(entry *Entry, t func(*Sidecar) (*Sidecar, error)) error {
 	oldSidecar, filename, err := f.getSidecar(entry)
@@ -90,6 +173,10 @@ func (f *Core) UpdateSidecar(entry *Entry, t func(*Sidecar) (*Sidecar, error)) e
 		return newSidecar.Interactions[i].Date.After(newSidecar.Interactions[j].Date)
 	})
 
+	sort.SliceStable(newSidecar.Hidden, func(i, j int) bool {
+		return newSidecar.Hidden[i].Date.After(newSidecar.Hidden[j].Date)
+	})
+
 	if newSidecar.Empty() {
 		err = f.sourceFS.Remove(filename)
 		if os.IsNotExist(err) {
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.hacdias.com/eagle/xray"
+	"go.hacdias.com/indielib/microformats"
+)
+
+func TestSidecarMentions(t *testing.T) {
+	reply := &Mention{ID: "reply", Post: xray.Post{Content: "Hello", Date: time.Now()}}
+	like := &Mention{ID: "like", Post: xray.Post{Type: microformats.TypeLike}}
+
+	sidecar := &Sidecar{
+		Replies:      []*Mention{reply},
+		Interactions: []*Mention{like},
+	}
+
+	require.NoError(t, sidecar.HideMention("like", true))
+	assert.Empty(t, sidecar.Interactions)
+	assert.Equal(t, []*Mention{like}, sidecar.Hidden)
+
+	m, hidden, err := sidecar.FindMention("like")
+	require.NoError(t, err)
+	assert.True(t, hidden)
+	assert.Equal(t, like, m)
+
+	require.NoError(t, sidecar.HideMention("like", false))
+	assert.Empty(t, sidecar.Hidden)
+	assert.Equal(t, []*Mention{like}, sidecar.Interactions)
+
+	m, err = sidecar.DeleteMention("reply")
+	require.NoError(t, err)
+	assert.Equal(t, reply, m)
+	assert.Empty(t, sidecar.Replies)
+
+	_, _, err = sidecar.FindMention("reply")
+	assert.ErrorIs(t, err, ErrMentionNotFound)
+	assert.ErrorIs(t, sidecar.HideMention("reply", true), ErrMentionNotFound)
+}
+
+func TestMentionLegacyID(t *testing.T) {
+	a := &Mention{Post: xray.Post{URL: "https://example.com/a", Author: "Jane"}}
+	b := &Mention{Post: xray.Post{URL: "https://example.com/b", Author: "Jane"}}
+
+	assert.Len(t, a.legacyID(), 16)
+	assert.Equal(t, a.legacyID(), a.legacyID())
+	assert.NotEqual(t, a.legacyID(), b.legacyID())
+}
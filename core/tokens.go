@@ -1,6 +1,10 @@
 package core
 
-import "time"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
 
 type TokenType string
 
@@ -10,11 +14,45 @@ const (
 	TokenTypeRefresh TokenType = "refresh"
 )
 
+// Token is a session, access or refresh token. Only the hash of the secret
+// given to clients is stored, see [HashToken], except for JWT access tokens,
+// whose ID is the JWT ID.
 type Token struct {
-	ID       string
-	Type     TokenType `gorm:"index"`
+	ID   string
+	Type TokenType `gorm:"index"`
+	// Username is the user the token belongs to. It is empty for the tokens
+	// issued before there were multiple users, which belong to the owner from
+	// the configuration.
+	Username string `gorm:"index"`
 	ClientID string
-	Scope    string
-	Expiry   time.Time // zero means no expiry, only for access tokens
-	Created  time.Time
+	// ClientName and ClientLogo are discovered from the client metadata when
+	// the token is authorized.
+	ClientName string
+	ClientLogo string
+	Scope      string
+	Expiry     time.Time // zero means no expiry, only for access tokens
+	Created    time.Time
+
+	// UserAgent, IP and LastSeen describe the device of a session, as seen on
+	// its latest request.
+	UserAgent string
+	IP        string
+	LastSeen  time.Time
+
+	// JWT is whether the token is a signed JWT, which is verified without the
+	// database. Such tokens are revoked through the denylist.
+	JWT bool
+}
+
+// HashToken returns the hash of a token secret, which is used as the ID of
+// the stored tokens.
+func HashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// DeniedToken is a revoked JWT access token, which is kept until it expires.
+type DeniedToken struct {
+	ID     string `gorm:"primaryKey"`
+	Expiry time.Time
 }
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessions(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	require.NoError(t, db.CreateToken(ctx, &Token{ID: "a", Type: TokenTypeSession, Created: now}))
+	require.NoError(t, db.CreateToken(ctx, &Token{ID: "b", Type: TokenTypeSession, Created: now.Add(time.Minute)}))
+	require.NoError(t, db.CreateToken(ctx, &Token{ID: "c", Type: TokenTypeAccess, Created: now}))
+	require.NoError(t, db.CreateToken(ctx, &Token{ID: "d", Type: TokenTypeSession, Username: "jane", Created: now}))
+	require.NoError(t, db.CreateToken(ctx, &Token{ID: "e", Type: TokenTypeSession, Username: "john", Created: now}))
+
+	session, err := db.GetToken(ctx, "a", TokenTypeSession)
+	require.NoError(t, err)
+
+	session.UserAgent = "Firefox"
+	session.IP = "1.1.1.1"
+	session.LastSeen = now
+	require.NoError(t, db.UpdateToken(ctx, session))
+
+	require.NoError(t, db.DeleteOtherTokensByType(ctx, TokenTypeSession, "a", "", "owner"))
+
+	sessions, err := db.GetTokensByType(ctx, TokenTypeSession, "", "owner")
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "a", sessions[0].ID)
+	assert.Equal(t, "Firefox", sessions[0].UserAgent)
+	assert.Equal(t, "1.1.1.1", sessions[0].IP)
+
+	// The sessions of the other users are untouched.
+	sessions, err = db.GetTokensByType(ctx, TokenTypeSession, "jane", "john")
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+
+	require.NoError(t, db.DeleteAllTokensByType(ctx, TokenTypeSession, "jane"))
+
+	sessions, err = db.GetTokensByType(ctx, TokenTypeSession, "jane", "john")
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "e", sessions[0].ID)
+
+	_, err = db.GetToken(ctx, "c", TokenTypeAccess)
+	assert.NoError(t, err)
+}
+
+func TestMigrateTokenHashes(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+
+	secret := "c6b2e9b6-0c4e-4a8e-9a62-5b2e1c0f7d3a"
+	require.NoError(t, db.CreateToken(ctx, &Token{ID: secret, Type: TokenTypeAccess}))
+	require.NoError(t, db.CreateToken(ctx, &Token{ID: "jwt-id", Type: TokenTypeAccess, JWT: true}))
+	require.NoError(t, db.CreateToken(ctx, &Token{ID: HashToken("other"), Type: TokenTypeRefresh}))
+
+	require.NoError(t, db.migrateTokenHashes())
+	require.NoError(t, db.migrateTokenHashes())
+
+	_, err := db.GetToken(ctx, secret, TokenTypeAccess)
+	assert.Error(t, err)
+
+	_, err = db.GetToken(ctx, HashToken(secret), TokenTypeAccess)
+	assert.NoError(t, err)
+
+	_, err = db.GetToken(ctx, "jwt-id", TokenTypeAccess)
+	assert.NoError(t, err)
+
+	_, err = db.GetToken(ctx, HashToken("other"), TokenTypeRefresh)
+	assert.NoError(t, err)
+}
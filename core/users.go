@@ -0,0 +1,112 @@
+package core
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+	"time"
+)
+
+// Role is the role of a [User], which determines what they can do.
+type Role string
+
+const (
+	// RoleOwner can do everything, including managing users, tokens and
+	// running actions. The user from the configuration is always an owner.
+	RoleOwner Role = "owner"
+	// RoleEditor can create and edit all entries and files, and moderate
+	// mentions.
+	RoleEditor Role = "editor"
+	// RoleAuthor can create entries and edit their own.
+	RoleAuthor Role = "author"
+	// RoleModerator can only moderate mentions.
+	RoleModerator Role = "moderator"
+)
+
+var Roles = []Role{RoleOwner, RoleEditor, RoleAuthor, RoleModerator}
+
+// Permission is something that a [Role] can do.
+type Permission string
+
+const (
+	// PermissionEntries allows creating entries and editing their own.
+	PermissionEntries Permission = "entries"
+	// PermissionAllEntries allows editing the entries of other users.
+	PermissionAllEntries Permission = "all-entries"
+	// PermissionFiles allows browsing and editing any file of the source.
+	PermissionFiles Permission = "files"
+	// PermissionMedia allows uploading and managing media.
+	PermissionMedia Permission = "media"
+	// PermissionMentions allows moderating mentions.
+	PermissionMentions Permission = "mentions"
+	// PermissionAdmin allows managing users and tokens, running actions and
+	// builds, and managing the queue.
+	PermissionAdmin Permission = "admin"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleOwner:     {PermissionEntries, PermissionAllEntries, PermissionFiles, PermissionMedia, PermissionMentions, PermissionAdmin},
+	RoleEditor:    {PermissionEntries, PermissionAllEntries, PermissionFiles, PermissionMedia, PermissionMentions},
+	RoleAuthor:    {PermissionEntries, PermissionMedia},
+	RoleModerator: {PermissionMentions},
+}
+
+// Can returns whether the role has the given permission.
+func (r Role) Can(p Permission) bool {
+	return slices.Contains(rolePermissions[r], p)
+}
+
+var usernameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// User is a user of the panel, in addition to the one from the configuration.
+type User struct {
+	Username string `gorm:"primaryKey"`
+	Name     string
+	Email    string
+	// URL is the profile URL of the user, used as their IndieAuth identity.
+	URL  string
+	Role Role
+	// Password is the bcrypt hash of the password. If empty, only passkeys can
+	// be used to login.
+	Password string
+	// TOTP is the base32-encoded secret of the time-based one-time passwords
+	// required after the password. If empty, the second factor is disabled.
+	TOTP    string
+	Created time.Time
+}
+
+func (u *User) Validate() error {
+	if !usernameRegexp.MatchString(u.Username) {
+		return errors.New("username must only contain lowercase letters, digits, dashes and underscores")
+	}
+
+	if !slices.Contains(Roles, u.Role) {
+		return errors.New("invalid role")
+	}
+
+	if u.TOTP != "" {
+		if _, err := decodeTOTPSecret(u.TOTP); err != nil {
+			return errors.New("invalid TOTP secret")
+		}
+	}
+
+	return nil
+}
+
+// Can returns whether the user has the given permission.
+func (u *User) Can(p Permission) bool {
+	return u.Role.Can(p)
+}
+
+// CommitAuthor returns the author of the commits made by the user.
+func (u *User) CommitAuthor() *CommitAuthor {
+	name := u.Name
+	if name == "" {
+		name = u.Username
+	}
+
+	return &CommitAuthor{
+		Name:  name,
+		Email: u.Email,
+	}
+}
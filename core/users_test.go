@@ -0,0 +1,76 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRolePermissions(t *testing.T) {
+	assert.True(t, RoleOwner.Can(PermissionAdmin))
+	assert.False(t, RoleEditor.Can(PermissionAdmin))
+	assert.True(t, RoleEditor.Can(PermissionAllEntries))
+	assert.True(t, RoleAuthor.Can(PermissionEntries))
+	assert.False(t, RoleAuthor.Can(PermissionAllEntries))
+	assert.False(t, RoleAuthor.Can(PermissionMentions))
+	assert.True(t, RoleModerator.Can(PermissionMentions))
+	assert.False(t, RoleModerator.Can(PermissionEntries))
+	assert.False(t, Role("unknown").Can(PermissionEntries))
+}
+
+func TestUserValidate(t *testing.T) {
+	assert.NoError(t, (&User{Username: "jane-doe", Role: RoleAuthor}).Validate())
+	assert.Error(t, (&User{Username: "Jane", Role: RoleAuthor}).Validate())
+	assert.Error(t, (&User{Username: "../jane", Role: RoleAuthor}).Validate())
+	assert.Error(t, (&User{Username: "jane", Role: "admin"}).Validate())
+	assert.Error(t, (&User{Username: "jane", Role: RoleAuthor, TOTP: "not base32!"}).Validate())
+}
+
+func TestUsers(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	require.NoError(t, db.CreateUser(ctx, &User{Username: "jane", Role: RoleEditor, Created: now}))
+	require.NoError(t, db.CreateUser(ctx, &User{Username: "john", Role: RoleAuthor, Created: now.Add(time.Minute)}))
+	require.NoError(t, db.CreateToken(ctx, &Token{ID: "session", Type: TokenTypeSession, Username: "jane"}))
+	require.NoError(t, db.CreateToken(ctx, &Token{ID: "other", Type: TokenTypeSession, Username: "john"}))
+	require.NoError(t, db.CreatePasskey(ctx, &Passkey{ID: "passkey", Username: "jane"}))
+	require.NoError(t, db.CreatePasskey(ctx, &Passkey{ID: "legacy"}))
+
+	users, err := db.GetUsers(ctx)
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	assert.Equal(t, "jane", users[0].Username)
+
+	passkeys, err := db.GetPasskeysByUsername(ctx, "jane")
+	require.NoError(t, err)
+	require.Len(t, passkeys, 1)
+	assert.Equal(t, "passkey", passkeys[0].ID)
+
+	users[0].Role = RoleModerator
+	require.NoError(t, db.UpdateUser(ctx, users[0]))
+
+	user, err := db.GetUser(ctx, "jane")
+	require.NoError(t, err)
+	assert.Equal(t, RoleModerator, user.Role)
+
+	require.NoError(t, db.DeleteUser(ctx, "jane"))
+
+	_, err = db.GetUser(ctx, "jane")
+	assert.Error(t, err)
+
+	_, err = db.GetTokenByID(ctx, "session")
+	assert.Error(t, err)
+
+	_, err = db.GetTokenByID(ctx, "other")
+	assert.NoError(t, err)
+
+	passkeys, err = db.GetPasskeys(ctx)
+	require.NoError(t, err)
+	require.Len(t, passkeys, 1)
+	assert.Equal(t, "legacy", passkeys[0].ID)
+}
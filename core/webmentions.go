@@ -1,14 +1,19 @@
 package core
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"net"
+	"net/http"
 	urlpkg "net/url"
 	"os"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/samber/lo"
+	"go.hacdias.com/eagle/pingback"
 	"willnorris.com/go/webmention"
 )
 
@@ -26,7 +31,23 @@ func (co *Core) AddOrUpdateWebmention(id string, mention *Mention, sourceOrURL s
 
 	isInteraction := mention.IsInteraction()
 
+	matches := func(m *Mention) bool {
+		return (m.URL == mention.URL && len(m.URL) != 0) ||
+			(m.Source == mention.Source && len(m.Source) != 0) ||
+			(m.URL == sourceOrURL && len(m.URL) != 0) ||
+			(m.Source == sourceOrURL && len(m.Source) != 0)
+	}
+
 	return co.UpdateSidecar(e, func(sidecar *Sidecar) (*Sidecar, error) {
+		// Updates of hidden mentions are kept hidden.
+		for i, m := range sidecar.Hidden {
+			if matches(m) {
+				mention.ID = m.ID
+				sidecar.Hidden[i] = mention
+				return sidecar, nil
+			}
+		}
+
 		var mentions []*Mention
 		if isInteraction {
 			mentions = sidecar.Interactions
@@ -36,10 +57,8 @@ func (co *Core) AddOrUpdateWebmention(id string, mention *Mention, sourceOrURL s
 
 		updated := false
 		for i, m := range mentions {
-			if (m.URL == mention.URL && len(m.URL) != 0) ||
-				(m.Source == mention.Source && len(m.Source) != 0) ||
-				(m.URL == sourceOrURL && len(m.URL) != 0) ||
-				(m.Source == sourceOrURL && len(m.Source) != 0) {
+			if matches(m) {
+				mention.ID = m.ID
 				mentions[i] = mention
 				updated = true
 				break
@@ -79,10 +98,43 @@ func (co *Core) DeleteWebmention(id, sourceOrURL string) error {
 			return mention.URL != sourceOrURL && mention.Source != sourceOrURL
 		})
 
+		sidecar.Hidden = lo.Filter(sidecar.Hidden, func(mention *Mention, _ int) bool {
+			return mention.URL != sourceOrURL && mention.Source != sourceOrURL
+		})
+
 		return sidecar, nil
 	})
 }
 
+// WebmentionAttempt is an attempt to send a webmention.
+type WebmentionAttempt struct {
+	ID       string `gorm:"primaryKey"`
+	Source   string `gorm:"index"`
+	Target   string
+	Endpoint string
+	Status   int
+	// Location is the status URL given by receivers that process webmentions
+	// asynchronously.
+	Location string
+	Error    string
+	// Pingback is whether the target did not support webmentions, and a
+	// pingback was sent instead.
+	Pingback bool
+	Created  time.Time
+}
+
+// Accepted returns whether the receiver accepted the webmention.
+func (a *WebmentionAttempt) Accepted() bool {
+	return a.Status >= 200 && a.Status < 300
+}
+
+const webmentionQueueItemType = "webmention"
+
+type webmentionQueuePayload struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
 func (co *Core) SendWebmentions(e *Entry, otherTargets ...string) error {
 	if !e.IsPost() || e.Draft {
 		return nil
@@ -95,6 +147,8 @@ func (co *Core) SendWebmentions(e *Entry, otherTargets ...string) error {
 	targets = append(targets, otherTargets...)
 	targets = lo.Uniq(targets)
 
+	ctx := context.Background()
+
 	err = nil
 	for _, target := range targets {
 		targetUrl, targetErr := urlpkg.Parse(target)
@@ -103,7 +157,14 @@ func (co *Core) SendWebmentions(e *Entry, otherTargets ...string) error {
 			continue
 		}
 
-		wmErr := co.sendWebmention(e.Permalink, target)
+		retry, wmErr := co.sendWebmention(ctx, e.Permalink, target)
+		if retry {
+			wmErr = co.Enqueue(ctx, webmentionQueueItemType, &webmentionQueuePayload{
+				Source: e.Permalink,
+				Target: target,
+			})
+		}
+
 		if wmErr != nil && !errors.Is(wmErr, webmention.ErrNoEndpointFound) {
 			wmErr = fmt.Errorf("send webmention error %s: %w", target, wmErr)
 			err = errors.Join(err, wmErr)
@@ -112,19 +173,65 @@ func (co *Core) SendWebmentions(e *Entry, otherTargets ...string) error {
 	return err
 }
 
-func (co *Core) sendWebmention(source, target string) error {
-	endpoint, err := co.wmClient.DiscoverEndpoint(target)
+// ResendWebmention sends a webmention again through the queue.
+func (co *Core) ResendWebmention(ctx context.Context, source, target string) error {
+	return co.Enqueue(ctx, webmentionQueueItemType, &webmentionQueuePayload{
+		Source: source,
+		Target: target,
+	})
+}
+
+func (co *Core) handleWebmentionQueueItem(ctx context.Context, data []byte) error {
+	var payload webmentionQueuePayload
+	err := json.Unmarshal(data, &payload)
 	if err != nil {
-		return fmt.Errorf("error discovering endpoint: %w", err)
+		return err
 	}
 
-	if isPrivate(endpoint) {
-		return fmt.Errorf("webmention endpoint is a private address: %s", endpoint)
+	retry, err := co.sendWebmention(ctx, payload.Source, payload.Target)
+	if retry {
+		return err
 	}
 
-	res, err := co.wmClient.SendWebmention(endpoint, source, target)
+	// Permanent failures are recorded, and not worth retrying.
+	return nil
+}
+
+// sendWebmention sends a webmention and records the attempt. It returns
+// whether it failed for a transient reason, and is worth retrying.
+func (co *Core) sendWebmention(ctx context.Context, source, target string) (bool, error) {
+	attempt := &WebmentionAttempt{
+		ID:      uuid.New().String(),
+		Source:  source,
+		Target:  target,
+		Created: time.Now(),
+	}
+
+	retry, err := co.doSendWebmention(attempt)
 	if err != nil {
-		return fmt.Errorf("error sending webmention: %w", err)
+		attempt.Error = err.Error()
+	}
+
+	return retry, errors.Join(err, co.db.CreateWebmentionAttempt(ctx, attempt))
+}
+
+func (co *Core) doSendWebmention(attempt *WebmentionAttempt) (bool, error) {
+	endpoint, err := co.wmClient.DiscoverEndpoint(attempt.Target)
+	if errors.Is(err, webmention.ErrNoEndpointFound) {
+		return co.doSendPingback(attempt)
+	} else if err != nil {
+		return true, fmt.Errorf("error discovering endpoint: %w", err)
+	}
+
+	attempt.Endpoint = endpoint
+
+	if IsPrivateURL(endpoint) {
+		return false, fmt.Errorf("webmention endpoint is a private address: %s", endpoint)
+	}
+
+	res, err := co.wmClient.SendWebmention(endpoint, attempt.Source, attempt.Target)
+	if res == nil {
+		return true, fmt.Errorf("error sending webmention: %w", err)
 	}
 
 	defer func() {
@@ -132,24 +239,54 @@ func (co *Core) sendWebmention(source, target string) error {
 		_ = res.Body.Close()
 	}()
 
-	return nil
+	attempt.Status = res.StatusCode
+	attempt.Location = res.Header.Get("Location")
+
+	if err != nil {
+		retry := res.StatusCode >= 500 ||
+			res.StatusCode == http.StatusTooManyRequests ||
+			res.StatusCode == http.StatusRequestTimeout
+		return retry, fmt.Errorf("error sending webmention: %w", err)
+	}
+
+	return false, nil
 }
 
-func isPrivate(urlStr string) bool {
-	url, _ := urlpkg.Parse(urlStr)
-	if url == nil {
-		return false
+// doSendPingback sends a pingback to targets that do not support webmentions.
+// If the target does not support pingbacks either, it returns
+// [webmention.ErrNoEndpointFound].
+func (co *Core) doSendPingback(attempt *WebmentionAttempt) (bool, error) {
+	endpoint, err := co.pbClient.DiscoverEndpoint(attempt.Target)
+	if errors.Is(err, pingback.ErrNoEndpointFound) {
+		return false, webmention.ErrNoEndpointFound
+	} else if err != nil {
+		return true, fmt.Errorf("error discovering pingback endpoint: %w", err)
 	}
 
-	hostname := url.Hostname()
-	if hostname == "localhost" {
-		return true
+	attempt.Endpoint = endpoint
+	attempt.Pingback = true
+
+	if IsPrivateURL(endpoint) {
+		return false, fmt.Errorf("pingback endpoint is a private address: %s", endpoint)
 	}
 
-	ip := net.ParseIP(hostname)
-	if ip == nil {
-		return false
+	attempt.Status, err = co.pbClient.Ping(endpoint, attempt.Source, attempt.Target)
+	var fault *pingback.Fault
+	if errors.As(err, &fault) {
+		if fault.Code == pingback.FaultAlreadyRegistered {
+			return false, nil
+		}
+
+		// Faults are successful responses, but the pingback was not accepted.
+		attempt.Status = 0
+		return false, fmt.Errorf("error sending pingback: %w", err)
+	} else if err != nil {
+		retry := attempt.Status == 0 ||
+			attempt.Status >= 500 ||
+			attempt.Status == http.StatusTooManyRequests ||
+			attempt.Status == http.StatusRequestTimeout
+		return retry, fmt.Errorf("error sending pingback: %w", err)
 	}
 
-	return ip.IsPrivate() || ip.IsLoopback()
+	return false, nil
 }
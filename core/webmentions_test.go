@@ -0,0 +1,71 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.hacdias.com/eagle/pingback"
+	"willnorris.com/go/webmention"
+)
+
+func TestSendWebmentionAttempts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/private":
+			w.Header().Set("Link", `</webmention>; rel="webmention"`)
+		case "/pingback":
+			w.Header().Set("X-Pingback", "/xmlrpc")
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<html><body>No endpoint.</body></html>"))
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	co := &Core{
+		db:       newTestDatabase(t),
+		wmClient: webmention.New(srv.Client()),
+		pbClient: pingback.New(srv.Client()),
+	}
+	ctx := context.Background()
+	source := "https://example.com/post/"
+
+	retry, err := co.sendWebmention(ctx, source, srv.URL+"/unavailable")
+	assert.True(t, retry)
+	assert.Error(t, err)
+
+	retry, err = co.sendWebmention(ctx, source, srv.URL+"/none")
+	assert.False(t, retry)
+	assert.ErrorIs(t, err, webmention.ErrNoEndpointFound)
+
+	retry, err = co.sendWebmention(ctx, source, srv.URL+"/private")
+	assert.False(t, retry)
+	assert.ErrorContains(t, err, "private address")
+
+	retry, err = co.sendWebmention(ctx, source, srv.URL+"/pingback")
+	assert.False(t, retry)
+	assert.ErrorContains(t, err, "pingback endpoint is a private address")
+
+	attempts, err := co.db.GetWebmentionAttempts(ctx, source)
+	require.NoError(t, err)
+	require.Len(t, attempts, 4)
+	assert.Equal(t, srv.URL+"/xmlrpc", attempts[0].Endpoint)
+	assert.True(t, attempts[0].Pingback)
+	assert.Equal(t, srv.URL+"/webmention", attempts[1].Endpoint)
+	assert.False(t, attempts[1].Pingback)
+	for _, attempt := range attempts {
+		assert.Equal(t, source, attempt.Source)
+		assert.NotEmpty(t, attempt.Error)
+		assert.False(t, attempt.Accepted())
+	}
+
+	attempts, err = co.db.GetWebmentionAttempts(ctx, "https://example.com/other/")
+	require.NoError(t, err)
+	assert.Empty(t, attempts)
+}
@@ -0,0 +1,248 @@
+// Package pingback implements the sending and receiving of Pingbacks, as
+// specified in https://www.hixie.ch/specs/pingback/pingback, the predecessor of
+// Webmention still supported by many blogs.
+package pingback
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	urlpkg "net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ErrNoEndpointFound is returned when the target does not support pingbacks.
+var ErrNoEndpointFound = errors.New("no pingback endpoint found")
+
+// maxResponseSize is the maximum size of the documents and responses read.
+const maxResponseSize = 5 << 20 // 5 MB
+
+// Fault codes defined by the specification.
+const (
+	FaultGeneric           = 0
+	FaultSourceNotFound    = 16
+	FaultNoLink            = 17
+	FaultTargetNotFound    = 32
+	FaultTargetInvalid     = 33
+	FaultAlreadyRegistered = 48
+	FaultAccessDenied      = 49
+	FaultUpstream          = 50
+)
+
+// Fault is an XML-RPC fault.
+type Fault struct {
+	Code    int
+	Message string
+}
+
+func (f *Fault) Error() string {
+	return fmt.Sprintf("pingback fault %d: %s", f.Code, f.Message)
+}
+
+type Client struct {
+	*http.Client
+}
+
+func New(client *http.Client) *Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Client{Client: client}
+}
+
+// DiscoverEndpoint discovers the pingback endpoint of the target from the
+// X-Pingback header or, otherwise, the pingback link of the document.
+func (c *Client) DiscoverEndpoint(target string) (string, error) {
+	res, err := c.Get(target)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return "", fmt.Errorf("response error: %d", res.StatusCode)
+	}
+
+	if endpoint := res.Header.Get("X-Pingback"); endpoint != "" {
+		return resolve(target, endpoint)
+	}
+
+	if !strings.Contains(res.Header.Get("Content-Type"), "html") {
+		return "", ErrNoEndpointFound
+	}
+
+	doc, err := goquery.NewDocumentFromReader(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return "", err
+	}
+
+	endpoint, ok := doc.Find("link[rel~=pingback][href]").First().Attr("href")
+	if !ok || endpoint == "" {
+		return "", ErrNoEndpointFound
+	}
+
+	return resolve(target, endpoint)
+}
+
+// Ping notifies the endpoint that the source links to the target. It returns
+// the HTTP response status code, if any, and a [*Fault] error if the pingback
+// was rejected.
+func (c *Client) Ping(endpoint, source, target string) (int, error) {
+	body, err := xml.Marshal(&methodCall{
+		MethodName: "pingback.ping",
+		Params: []param{
+			{Value: value{String: source}},
+			{Value: value{String: target}},
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := c.Post(endpoint, "text/xml", bytes.NewReader(append([]byte(xml.Header), body...)))
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("response error: %d", res.StatusCode)
+	}
+
+	var response methodResponse
+	err = xml.NewDecoder(io.LimitReader(res.Body, maxResponseSize)).Decode(&response)
+	if err != nil {
+		return res.StatusCode, fmt.Errorf("invalid response: %w", err)
+	}
+
+	if response.Fault != nil {
+		return res.StatusCode, response.Fault.fault()
+	}
+
+	return res.StatusCode, nil
+}
+
+// Source is the document of a received pingback.
+type Source struct {
+	Title string
+	// Excerpt is the text surrounding the link to the target.
+	Excerpt string
+}
+
+// FetchSource fetches the source of a received pingback, and checks that it
+// links to the target. The returned errors are a [*Fault].
+func (c *Client) FetchSource(source, target string) (*Source, error) {
+	res, err := c.Get(source)
+	if err != nil {
+		return nil, &Fault{FaultSourceNotFound, "The source URI could not be fetched."}
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, &Fault{FaultSourceNotFound, "The source URI does not exist."}
+	}
+
+	doc, err := goquery.NewDocumentFromReader(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return nil, &Fault{FaultNoLink, "The source URI could not be parsed."}
+	}
+
+	link := doc.Find("a[href]").FilterFunction(func(_ int, s *goquery.Selection) bool {
+		href, _ := resolve(source, s.AttrOr("href", ""))
+		return sameURL(href, target)
+	}).First()
+	if link.Length() == 0 {
+		return nil, &Fault{FaultNoLink, "The source URI does not contain a link to the target URI."}
+	}
+
+	excerpt := strings.Join(strings.Fields(link.Parent().Text()), " ")
+	if runes := []rune(excerpt); len(runes) > 300 {
+		excerpt = string(runes[:300]) + "…"
+	}
+
+	return &Source{
+		Title:   strings.TrimSpace(doc.Find("title").First().Text()),
+		Excerpt: excerpt,
+	}, nil
+}
+
+// ParseRequest parses a pingback.ping XML-RPC request. The returned errors
+// are a [*Fault].
+func ParseRequest(r io.Reader) (source, target string, err error) {
+	var call methodCall
+	err = xml.NewDecoder(io.LimitReader(r, maxResponseSize)).Decode(&call)
+	if err != nil {
+		return "", "", &Fault{FaultGeneric, "Invalid XML-RPC request."}
+	}
+
+	if call.MethodName != "pingback.ping" {
+		return "", "", &Fault{FaultGeneric, "Unsupported method " + call.MethodName + "."}
+	}
+
+	if len(call.Params) != 2 {
+		return "", "", &Fault{FaultGeneric, "Expected the source and target URIs."}
+	}
+
+	return call.Params[0].Value.text(), call.Params[1].Value.text(), nil
+}
+
+// WriteResponse writes a successful XML-RPC response with a message.
+func WriteResponse(w http.ResponseWriter, message string) {
+	write(w, &methodResponse{Params: []param{{Value: value{String: message}}}})
+}
+
+// WriteFault writes an XML-RPC fault response. Errors that are not a
+// [*Fault] are written as a generic fault.
+func WriteFault(w http.ResponseWriter, err error) {
+	var fault *Fault
+	if !errors.As(err, &fault) {
+		fault = &Fault{FaultGeneric, err.Error()}
+	}
+
+	write(w, &methodResponse{Fault: &faultValue{Members: []member{
+		{Name: "faultCode", Value: value{Int: &fault.Code}},
+		{Name: "faultString", Value: value{String: fault.Message}},
+	}}})
+}
+
+func write(w http.ResponseWriter, res *methodResponse) {
+	data, err := xml.Marshal(res)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// XML-RPC responses are always 200 OK, including faults.
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(data)
+}
+
+func resolve(base, ref string) (string, error) {
+	b, err := urlpkg.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	r, err := urlpkg.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return "", err
+	}
+	return b.ResolveReference(r).String(), nil
+}
+
+func sameURL(a, b string) bool {
+	a = strings.TrimSuffix(strings.SplitN(a, "#", 2)[0], "/")
+	b = strings.TrimSuffix(strings.SplitN(b, "#", 2)[0], "/")
+	return a != "" && a == b
+}
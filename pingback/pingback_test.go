@@ -0,0 +1,96 @@
+package pingback
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPingback(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/header":
+			w.Header().Set("X-Pingback", "/xmlrpc")
+		case "/link":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<html><head><link rel="pingback" href="` + srv.URL + `/xmlrpc"></head></html>`))
+		case "/none":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<html><head></head></html>`))
+		case "/source":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<html><head><title> A Post </title></head><body><p>I  liked <a href="/target/">this post</a>.</p></body></html>`))
+		case "/xmlrpc":
+			source, target, err := ParseRequest(r.Body)
+			if err != nil {
+				WriteFault(w, err)
+			} else if target != srv.URL+"/target" {
+				WriteFault(w, &Fault{FaultTargetInvalid, "Invalid target " + source})
+			} else {
+				WriteResponse(w, "Thanks!")
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	c := New(srv.Client())
+
+	endpoint, err := c.DiscoverEndpoint(srv.URL + "/header")
+	require.NoError(t, err)
+	assert.Equal(t, srv.URL+"/xmlrpc", endpoint)
+
+	endpoint, err = c.DiscoverEndpoint(srv.URL + "/link")
+	require.NoError(t, err)
+	assert.Equal(t, srv.URL+"/xmlrpc", endpoint)
+
+	_, err = c.DiscoverEndpoint(srv.URL + "/none")
+	assert.ErrorIs(t, err, ErrNoEndpointFound)
+
+	status, err := c.Ping(endpoint, "https://example.com/", srv.URL+"/target")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+
+	_, err = c.Ping(endpoint, "https://example.com/", srv.URL+"/other")
+	var fault *Fault
+	require.ErrorAs(t, err, &fault)
+	assert.Equal(t, FaultTargetInvalid, fault.Code)
+	assert.Equal(t, "Invalid target https://example.com/", fault.Message)
+
+	source, err := c.FetchSource(srv.URL+"/source", srv.URL+"/target")
+	require.NoError(t, err)
+	assert.Equal(t, &Source{Title: "A Post", Excerpt: "I liked this post."}, source)
+
+	_, err = c.FetchSource(srv.URL+"/source", srv.URL+"/other")
+	require.ErrorAs(t, err, &fault)
+	assert.Equal(t, FaultNoLink, fault.Code)
+
+	_, err = c.FetchSource(srv.URL+"/missing", srv.URL+"/target")
+	require.ErrorAs(t, err, &fault)
+	assert.Equal(t, FaultSourceNotFound, fault.Code)
+}
+
+func TestParseRequest(t *testing.T) {
+	source, target, err := ParseRequest(strings.NewReader(`<?xml version="1.0"?>
+<methodCall>
+  <methodName>pingback.ping</methodName>
+  <params>
+    <param><value>https://a.example/post</value></param>
+    <param><value><string>https://b.example/post</string></value></param>
+  </params>
+</methodCall>`))
+	require.NoError(t, err)
+	assert.Equal(t, "https://a.example/post", source)
+	assert.Equal(t, "https://b.example/post", target)
+
+	_, _, err = ParseRequest(strings.NewReader(`<methodCall><methodName>system.listMethods</methodName></methodCall>`))
+	var fault *Fault
+	require.ErrorAs(t, err, &fault)
+	assert.Equal(t, FaultGeneric, fault.Code)
+}
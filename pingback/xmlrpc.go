@@ -0,0 +1,67 @@
+package pingback
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+)
+
+type methodCall struct {
+	XMLName    xml.Name `xml:"methodCall"`
+	MethodName string   `xml:"methodName"`
+	Params     []param  `xml:"params>param"`
+}
+
+type methodResponse struct {
+	XMLName xml.Name    `xml:"methodResponse"`
+	Params  []param     `xml:"params>param,omitempty"`
+	Fault   *faultValue `xml:"fault>value>struct,omitempty"`
+}
+
+type param struct {
+	Value value `xml:"value"`
+}
+
+// value is an XML-RPC value. Only strings and integers are supported, which
+// is all that pingbacks use. Untyped values are strings.
+type value struct {
+	String string `xml:"string,omitempty"`
+	Int    *int   `xml:"int,omitempty"`
+	I4     *int   `xml:"i4,omitempty"`
+	Raw    string `xml:",chardata"`
+}
+
+func (v value) text() string {
+	if v.String != "" {
+		return strings.TrimSpace(v.String)
+	}
+	return strings.TrimSpace(v.Raw)
+}
+
+type member struct {
+	Name  string `xml:"name"`
+	Value value  `xml:"value"`
+}
+
+type faultValue struct {
+	Members []member `xml:"member"`
+}
+
+func (f *faultValue) fault() *Fault {
+	fault := &Fault{}
+	for _, m := range f.Members {
+		switch m.Name {
+		case "faultCode":
+			if m.Value.Int != nil {
+				fault.Code = *m.Value.Int
+			} else if m.Value.I4 != nil {
+				fault.Code = *m.Value.I4
+			} else {
+				fault.Code, _ = strconv.Atoi(m.Value.text())
+			}
+		case "faultString":
+			fault.Message = m.Value.text()
+		}
+	}
+	return fault
+}
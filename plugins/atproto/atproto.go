@@ -321,6 +321,13 @@ func (at *ATProto) Syndicate(ctx context.Context, e *core.Entry, sctx *server.Sy
 		var photos []*photoBlob
 		if len(posts) > 0 {
 			photos = blueskyPostToPhotoBlobs(posts)
+
+			// Bluesky posts do not carry EXIF metadata, so recover it from the entry.
+			for i := range photos {
+				if i < len(sctx.Photos) {
+					photos[i].exif = sctx.Photos[i].Exif
+				}
+			}
 		} else {
 			photos, err = uploadPhotos(ctx, client, sctx.Photos)
 			if err != nil {
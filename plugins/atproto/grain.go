@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"strings"
 	"time"
 
@@ -121,6 +122,14 @@ func (at *ATProto) createGrainGallery(ctx context.Context, client *xrpc.Client,
 		}
 		at.log.Infow("created social.grain.photo", "uri", photoURI)
 		photoURIs = append(photoURIs, photoURI)
+
+		if photo.exif != nil {
+			exifURI, err := createRecord(ctx, client, "social.grain.photo.exif", &recordKey, grainExifRecord(photoURI, photo.exif, createdAt))
+			if err != nil {
+				return "", fmt.Errorf("failed to create social.grain.photo.exif: %w", err)
+			}
+			at.log.Infow("created social.grain.photo.exif", "uri", exifURI)
+		}
 	}
 
 	// 3. Create gallery item records linking photos to the gallery.
@@ -146,6 +155,48 @@ func (at *ATProto) createGrainGallery(ctx context.Context, client *xrpc.Client,
 	return galleryURI, nil
 }
 
+// grainExifScale is the factor by which decimal values are scaled, as
+// defined by the social.grain.photo.exif lexicon.
+const grainExifScale = 1000000
+
+func grainExifRecord(photoURI string, exif *core.Exif, createdAt time.Time) map[string]any {
+	record := map[string]any{
+		"$type":     "social.grain.photo.exif",
+		"photo":     photoURI,
+		"createdAt": createdAt.Format(syntax.AtprotoDatetimeLayout),
+	}
+
+	if !exif.TakenAt.IsZero() {
+		record["dateTimeOriginal"] = exif.TakenAt.Format(syntax.AtprotoDatetimeLayout)
+	}
+	if exif.Make != "" {
+		record["make"] = exif.Make
+	}
+	if exif.Model != "" {
+		record["model"] = exif.Model
+	}
+	if exif.LensMake != "" {
+		record["lensMake"] = exif.LensMake
+	}
+	if exif.LensModel != "" {
+		record["lensModel"] = exif.LensModel
+	}
+	if exposure := exif.ExposureSeconds(); exposure > 0 {
+		record["exposureTime"] = int64(math.Round(exposure * grainExifScale))
+	}
+	if exif.Aperture > 0 {
+		record["fNumber"] = int64(math.Round(exif.Aperture * grainExifScale))
+	}
+	if exif.FocalLength35mm > 0 {
+		record["focalLengthIn35mmFormat"] = int64(exif.FocalLength35mm) * grainExifScale
+	}
+	if exif.ISO > 0 {
+		record["iSO"] = int64(exif.ISO) * grainExifScale
+	}
+
+	return record
+}
+
 func (at *ATProto) deleteGrainGallery(ctx context.Context, client *xrpc.Client, uri syntax.ATURI) error {
 	// TODO: Implement deletion of the gallery record, photo records, and gallery item records.
 	// Maybe see if delete gallery xrpc method on grain.social becomes specified?
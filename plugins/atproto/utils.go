@@ -12,6 +12,7 @@ import (
 	"github.com/bluesky-social/indigo/api/bsky"
 	lexutil "github.com/bluesky-social/indigo/lex/util"
 	"github.com/bluesky-social/indigo/xrpc"
+	"go.hacdias.com/eagle/core"
 	"go.hacdias.com/eagle/server"
 )
 
@@ -22,6 +23,7 @@ type photoBlob struct {
 	alt    string
 	width  int
 	height int
+	exif   *core.Exif
 }
 
 func uploadPhoto(ctx context.Context, client *xrpc.Client, photo *server.Photo) (*photoBlob, error) {
@@ -44,6 +46,7 @@ func uploadPhoto(ctx context.Context, client *xrpc.Client, photo *server.Photo)
 		alt:    alt,
 		width:  photo.Width,
 		height: photo.Height,
+		exif:   photo.Exif,
 	}, nil
 }
 
@@ -1,11 +1,13 @@
 package mastodon
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/karlseguin/typed"
 	"github.com/mattn/go-mastodon"
@@ -24,6 +26,11 @@ func init() {
 	server.RegisterPlugin("mastodon", NewMastodon)
 }
 
+const (
+	mediaProcessingTimeout  = 5 * time.Minute
+	mediaProcessingInterval = 5 * time.Second
+)
+
 type Mastodon struct {
 	core              *core.Core
 	log               *zap.SugaredLogger
@@ -128,6 +135,76 @@ func (m *Mastodon) uploadPhotos(ctx context.Context, photos []*server.Photo) []m
 	return mediaIDs
 }
 
+// uploadMedia uploads the media of the entry. Mastodon does not allow mixing
+// videos or audio with photos, so only the first video or audio is uploaded,
+// if any. Otherwise, the photos are uploaded.
+func (m *Mastodon) uploadMedia(ctx context.Context, sctx *server.SyndicationContext) []mastodon.ID {
+	var (
+		media    *mastodon.Media
+		mimetype string
+	)
+
+	if len(sctx.Videos) > 0 {
+		video := sctx.Videos[0]
+		mimetype = video.MimeType
+		media = &mastodon.Media{
+			File:        bytes.NewReader(video.Data),
+			Description: video.Title,
+		}
+		if video.Poster != nil {
+			media.Thumbnail = bytes.NewReader(video.Poster.Data)
+		}
+	} else if len(sctx.Audio) > 0 {
+		audio := sctx.Audio[0]
+		mimetype = audio.MimeType
+		media = &mastodon.Media{
+			File:        bytes.NewReader(audio.Data),
+			Description: audio.Title,
+		}
+	} else {
+		return m.uploadPhotos(ctx, sctx.Photos)
+	}
+
+	attachment, err := m.client.UploadMediaFromMedia(ctx, media)
+	if err != nil {
+		m.log.Warnw("media upload failed", "mimetype", mimetype, "err", err)
+		return []mastodon.ID{}
+	}
+
+	err = m.waitForMedia(ctx, attachment)
+	if err != nil {
+		m.log.Warnw("media processing failed", "mimetype", mimetype, "err", err)
+		return []mastodon.ID{}
+	}
+
+	return []mastodon.ID{attachment.ID}
+}
+
+// waitForMedia waits until the attachment is processed. Videos and audio are
+// processed asynchronously, and cannot be attached to a status before.
+func (m *Mastodon) waitForMedia(ctx context.Context, attachment *mastodon.Attachment) error {
+	if attachment.URL != "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mediaProcessingTimeout)
+	defer cancel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(mediaProcessingInterval):
+		}
+
+		// The status is 206 Partial Content while processing, which is
+		// reported as an error.
+		if err := m.client.GetMediaStatus(ctx, attachment); err == nil {
+			return nil
+		}
+	}
+}
+
 func (m *Mastodon) Syndicate(ctx context.Context, e *core.Entry, sctx *server.SyndicationContext) error {
 	url, id, err := m.getSyndication(e)
 	if err != nil {
@@ -153,13 +230,13 @@ func (m *Mastodon) Syndicate(ctx context.Context, e *core.Entry, sctx *server.Sy
 
 	toot := mastodon.Toot{
 		Visibility: mastodon.VisibilityPublic,
-		MediaIDs:   m.uploadPhotos(ctx, sctx.Photos),
+		MediaIDs:   m.uploadMedia(ctx, sctx),
 	}
 
 	if sctx.Status != "" {
 		toot.Status = sctx.Status + " " + e.Permalink
 	} else {
-		statuses := e.Statuses(m.maximumCharacters, 1, len(e.Photos) > len(toot.MediaIDs))
+		statuses := e.Statuses(m.maximumCharacters, 1, len(e.Photos)+len(e.Videos)+len(e.Audio) > len(toot.MediaIDs))
 		if len(statuses) != 1 {
 			return fmt.Errorf("expected 1 status, got %d", len(statuses))
 		}
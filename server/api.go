@@ -0,0 +1,565 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/samber/lo"
+	"go.hacdias.com/eagle/core"
+)
+
+const (
+	apiPath = "/api/v1"
+
+	// Scopes of the admin API. Each grants access to the equivalent panel
+	// feature, if the user has the permission for it, see [scopePermissions].
+	// Write scopes do not imply the read scopes.
+	scopeEntriesRead      = "entries:read"
+	scopeEntriesWrite     = "entries:write"
+	scopeFilesRead        = "files:read"
+	scopeFilesWrite       = "files:write"
+	scopeActionsRun       = "actions:run"
+	scopeBuild            = "build"
+	scopeMentionsModerate = "mentions:moderate"
+	scopeQueueManage      = "queue:manage"
+
+	// maxAPIRequestSize is the maximum size of the API request bodies.
+	maxAPIRequestSize = 10 << 20 // 10 MB
+)
+
+// scopePermissions are the permissions that the users need in order to use
+// the scopes of the admin API.
+var scopePermissions = map[string]core.Permission{
+	scopeEntriesRead:      core.PermissionEntries,
+	scopeEntriesWrite:     core.PermissionEntries,
+	scopeFilesRead:        core.PermissionFiles,
+	scopeFilesWrite:       core.PermissionFiles,
+	scopeActionsRun:       core.PermissionAdmin,
+	scopeBuild:            core.PermissionAdmin,
+	scopeMentionsModerate: core.PermissionMentions,
+	scopeQueueManage:      core.PermissionAdmin,
+}
+
+func (s *Server) apiRouter(r chi.Router) {
+	r.With(s.mustScope(scopeEntriesRead)).Get("/entries", s.apiEntriesGet)
+	r.With(s.mustScope(scopeEntriesRead)).Get("/entries/*", s.apiEntryGet)
+	r.With(s.mustScope(scopeEntriesWrite)).Post("/entries", s.apiEntriesPost)
+	r.With(s.mustScope(scopeEntriesWrite)).Put("/entries/*", s.apiEntryPut)
+	r.With(s.mustScope(scopeEntriesWrite)).Delete("/entries/*", s.apiEntryDelete)
+	r.With(s.mustScope(scopeFilesRead)).Get("/files/*", s.apiFileGet)
+	r.With(s.mustScope(scopeFilesWrite)).Put("/files/*", s.apiFilePut)
+	r.With(s.mustScope(scopeActionsRun)).Get("/actions", s.apiActionsGet)
+	r.With(s.mustScope(scopeActionsRun)).Post("/actions/{action}", s.apiActionPost)
+	r.With(s.mustScope(scopeBuild)).Post("/build", s.apiBuildPost)
+	r.With(s.mustScope(scopeMentionsModerate)).Get("/mentions", s.apiMentionsGet)
+	r.With(s.mustScope(scopeMentionsModerate)).Post("/mentions", s.apiMentionsPost)
+	r.With(s.mustScope(scopeQueueManage)).Get("/queue", s.apiQueueGet)
+	r.With(s.mustScope(scopeQueueManage)).Delete("/queue/failed", s.apiQueueFailedDelete)
+}
+
+// mustScope only allows requests whose token has the given scope, and whose
+// user has the permission for it. It must be used after [Server.mustIndieAuth].
+func (s *Server) mustScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !s.checkScope(w, r, scope) {
+				return
+			}
+
+			if user := s.getUser(r); user == nil || !user.Can(scopePermissions[scope]) {
+				s.serveErrorJSON(w, http.StatusForbidden, "insufficient_scope", errNotAllowed.Error())
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (s *Server) decodeAPIRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIRequestSize))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(v)
+	if err != nil {
+		s.serveErrorJSON(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return false
+	}
+
+	return true
+}
+
+type apiEntry struct {
+	ID           string    `json:"id"`
+	Permalink    string    `json:"permalink"`
+	Title        string    `json:"title,omitempty"`
+	Date         time.Time `json:"date"`
+	Draft        bool      `json:"draft,omitempty"`
+	Deleted      bool      `json:"deleted,omitempty"`
+	Author       string    `json:"author,omitempty"`
+	Categories   []string  `json:"categories,omitempty"`
+	Tags         []string  `json:"tags,omitempty"`
+	Syndications []string  `json:"syndications,omitempty"`
+	// Source is the Markdown source of the entry, including the front matter.
+	Source string `json:"source,omitempty"`
+}
+
+func newAPIEntry(e *core.Entry) *apiEntry {
+	return &apiEntry{
+		ID:           e.ID,
+		Permalink:    e.Permalink,
+		Title:        e.Title,
+		Date:         e.Date,
+		Draft:        e.Draft,
+		Deleted:      e.Deleted(),
+		Author:       e.Author,
+		Categories:   e.Categories,
+		Tags:         e.Tags,
+		Syndications: e.Syndications,
+	}
+}
+
+func apiEntryID(r *http.Request) string {
+	return "/" + chi.URLParam(r, "*")
+}
+
+// canReadEntry returns whether the user can read the entry through the API:
+// either it is published, or the user can edit it.
+func canReadEntry(user *core.User, e *core.Entry) bool {
+	return (!e.Draft && !e.Deleted()) || canEditEntry(user, e)
+}
+
+func (s *Server) apiEntriesGet(w http.ResponseWriter, r *http.Request) {
+	ee, err := s.core.GetEntries(false)
+	if err != nil {
+		s.serveServerErrorJSON(w, r, err)
+		return
+	}
+
+	user := s.getUser(r)
+	entries := []*apiEntry{}
+	for _, e := range ee {
+		if canReadEntry(user, e) {
+			entries = append(entries, newAPIEntry(e))
+		}
+	}
+
+	s.serveJSON(w, http.StatusOK, entries)
+}
+
+func (s *Server) apiEntryGet(w http.ResponseWriter, r *http.Request) {
+	e, err := s.core.GetEntry(apiEntryID(r))
+	if errors.Is(err, os.ErrNotExist) || (err == nil && !canReadEntry(s.getUser(r), e)) {
+		s.serveErrorJSON(w, http.StatusNotFound, "not_found", "entry not found")
+		return
+	} else if err != nil {
+		s.serveErrorJSON(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	source, err := e.String()
+	if err != nil {
+		s.serveServerErrorJSON(w, r, err)
+		return
+	}
+
+	entry := newAPIEntry(e)
+	entry.Source = source
+	s.serveJSON(w, http.StatusOK, entry)
+}
+
+type apiNewEntryRequest struct {
+	Slug       string   `json:"slug"`
+	Title      string   `json:"title"`
+	Content    string   `json:"content"`
+	Categories []string `json:"categories"`
+	Tags       []string `json:"tags"`
+	Draft      bool     `json:"draft"`
+
+	Syndicators       []string `json:"syndicators"`
+	SyndicationStatus string   `json:"syndicationStatus"`
+}
+
+func (s *Server) apiEntriesPost(w http.ResponseWriter, r *http.Request) {
+	var req apiNewEntryRequest
+	if !s.decodeAPIRequest(w, r, &req) {
+		return
+	}
+
+	if req.Slug == "" || req.Content == "" {
+		s.serveErrorJSON(w, http.StatusBadRequest, "invalid_request", "slug and content are required")
+		return
+	}
+
+	id := core.NewPostID(req.Slug, time.Now())
+	if _, err := s.core.GetEntry(id); err == nil {
+		s.serveErrorJSON(w, http.StatusConflict, "conflict", "entry already exists")
+		return
+	}
+
+	// As in the panel, the content may include the front matter.
+	var e *core.Entry
+	if strings.HasPrefix(req.Content, "---") {
+		var err error
+		e, err = s.core.GetEntryFromContent(id, req.Content)
+		if err != nil {
+			s.serveErrorJSON(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+	} else {
+		e = s.core.NewBlankEntry(id)
+		e.Content = req.Content
+	}
+
+	if req.Title != "" {
+		e.Title = req.Title
+	}
+	if len(req.Categories) > 0 {
+		e.Categories = req.Categories
+	}
+	if len(req.Tags) > 0 {
+		e.Tags = req.Tags
+	}
+	e.Draft = e.Draft || req.Draft
+
+	// Only the users who can edit the entries of others can set the author.
+	user := s.getUser(r)
+	if e.Author == "" || !user.Can(core.PermissionAllEntries) {
+		e.Author = user.Username
+	}
+
+	err := s.saveEntryWithHooks(e, postSaveEntryOptions{
+		author:            s.getCommitAuthor(r),
+		isNew:             true,
+		syndicators:       req.Syndicators,
+		syndicationStatus: req.SyndicationStatus,
+	})
+	if err != nil {
+		s.serveServerErrorJSON(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", e.Permalink)
+	s.serveJSON(w, http.StatusCreated, newAPIEntry(e))
+}
+
+type apiEditEntryRequest struct {
+	// Source is the Markdown source of the entry, including the front matter.
+	Source string `json:"source"`
+
+	Syndicators       []string `json:"syndicators"`
+	SyndicationStatus string   `json:"syndicationStatus"`
+}
+
+func (s *Server) apiEntryPut(w http.ResponseWriter, r *http.Request) {
+	var req apiEditEntryRequest
+	if !s.decodeAPIRequest(w, r, &req) {
+		return
+	}
+
+	oldEntry, err := s.core.GetEntry(apiEntryID(r))
+	if errors.Is(err, os.ErrNotExist) {
+		s.serveErrorJSON(w, http.StatusNotFound, "not_found", "entry not found")
+		return
+	} else if err != nil {
+		s.serveErrorJSON(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	user := s.getUser(r)
+	if !canEditEntry(user, oldEntry) {
+		s.serveErrorJSON(w, http.StatusForbidden, "forbidden", errNotAllowed.Error())
+		return
+	}
+
+	previousLinks, _ := s.core.GetEntryLinks(oldEntry, true)
+
+	e, err := s.core.GetEntryFromContent(oldEntry.ID, string(normalizeLineEndings([]byte(req.Source))))
+	if err != nil {
+		s.serveErrorJSON(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	if !canEditEntry(user, e) {
+		s.serveErrorJSON(w, http.StatusForbidden, "forbidden", errNotAllowed.Error())
+		return
+	}
+
+	err = s.saveEntryWithHooks(e, postSaveEntryOptions{
+		author:            s.getCommitAuthor(r),
+		syndicators:       req.Syndicators,
+		syndicationStatus: req.SyndicationStatus,
+		previousLinks:     previousLinks,
+	})
+	if err != nil {
+		s.serveServerErrorJSON(w, r, err)
+		return
+	}
+
+	s.serveJSON(w, http.StatusOK, newAPIEntry(e))
+}
+
+// apiEntryDelete deletes the entry by expiring it, such that it is served as
+// 410 Gone, and the webmentions of its links are sent again.
+func (s *Server) apiEntryDelete(w http.ResponseWriter, r *http.Request) {
+	e, err := s.core.GetEntry(apiEntryID(r))
+	if errors.Is(err, os.ErrNotExist) {
+		s.serveErrorJSON(w, http.StatusNotFound, "not_found", "entry not found")
+		return
+	} else if err != nil {
+		s.serveErrorJSON(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	if !canEditEntry(s.getUser(r), e) {
+		s.serveErrorJSON(w, http.StatusForbidden, "forbidden", errNotAllowed.Error())
+		return
+	}
+
+	previousLinks, _ := s.core.GetEntryLinks(e, true)
+	e.ExpiryDate = time.Now()
+
+	err = s.saveEntryWithHooks(e, postSaveEntryOptions{
+		author:        s.getCommitAuthor(r),
+		previousLinks: previousLinks,
+	})
+	if err != nil {
+		s.serveServerErrorJSON(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type apiFile struct {
+	Name     string    `json:"name"`
+	Dir      bool      `json:"dir"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+type apiFileContent struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+func apiFilename(r *http.Request) string {
+	return filepath.Clean("/" + chi.URLParam(r, "*"))
+}
+
+// apiFileGet returns the content of the file, or the list of files if it is
+// a directory.
+func (s *Server) apiFileGet(w http.ResponseWriter, r *http.Request) {
+	filename := apiFilename(r)
+	if core.IsHiddenPath(filename) {
+		s.serveErrorJSON(w, http.StatusForbidden, "forbidden", errNotAllowed.Error())
+		return
+	}
+
+	info, err := s.core.Stat(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		s.serveErrorJSON(w, http.StatusNotFound, "not_found", "file not found")
+		return
+	} else if err != nil {
+		s.serveErrorJSON(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	if info.IsDir() {
+		infos, err := s.core.ReadDir(filename)
+		if err != nil {
+			s.serveServerErrorJSON(w, r, err)
+			return
+		}
+
+		infos = lo.Filter(infos, func(info os.FileInfo, _ int) bool {
+			return !core.IsHiddenPath(info.Name())
+		})
+
+		s.serveJSON(w, http.StatusOK, lo.Map(infos, func(info os.FileInfo, _ int) *apiFile {
+			return &apiFile{
+				Name:     info.Name(),
+				Dir:      info.IsDir(),
+				Size:     info.Size(),
+				Modified: info.ModTime(),
+			}
+		}))
+		return
+	}
+
+	data, err := s.core.ReadFile(filename)
+	if err != nil {
+		s.serveServerErrorJSON(w, r, err)
+		return
+	}
+
+	if !utf8.Valid(data) {
+		s.serveErrorJSON(w, http.StatusPreconditionFailed, "invalid_request", "file is not text file")
+		return
+	}
+
+	s.serveJSON(w, http.StatusOK, &apiFileContent{
+		Path:    filename,
+		Content: string(data),
+	})
+}
+
+type apiFileRequest struct {
+	Content           string   `json:"content"`
+	Syndicators       []string `json:"syndicators"`
+	SyndicationStatus string   `json:"syndicationStatus"`
+}
+
+func (s *Server) apiFilePut(w http.ResponseWriter, r *http.Request) {
+	filename := apiFilename(r)
+	if filename == "/" {
+		s.serveErrorJSON(w, http.StatusBadRequest, "invalid_request", "missing filename")
+		return
+	}
+
+	// Hidden files, such as the git configuration, could be used to run
+	// commands on the server.
+	if core.IsHiddenPath(filename) {
+		s.serveErrorJSON(w, http.StatusForbidden, "forbidden", errNotAllowed.Error())
+		return
+	}
+
+	var req apiFileRequest
+	if !s.decodeAPIRequest(w, r, &req) {
+		return
+	}
+
+	err := s.core.MkdirAll(path.Dir(filename))
+	if err != nil {
+		s.serveServerErrorJSON(w, r, err)
+		return
+	}
+
+	err = s.saveFile(s.getUser(r), filename, req.Content, postSaveEntryOptions{
+		author:            s.getCommitAuthor(r),
+		syndicators:       req.Syndicators,
+		syndicationStatus: req.SyndicationStatus,
+	})
+	if errors.Is(err, errNotAllowed) {
+		s.serveErrorJSON(w, http.StatusForbidden, "forbidden", err.Error())
+		return
+	} else if errors.Is(err, errInvalidEntry) {
+		s.serveErrorJSON(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	} else if err != nil {
+		s.serveServerErrorJSON(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) apiActionsGet(w http.ResponseWriter, r *http.Request) {
+	s.serveJSON(w, http.StatusOK, s.getActions())
+}
+
+func (s *Server) apiActionPost(w http.ResponseWriter, r *http.Request) {
+	action := chi.URLParam(r, "action")
+	if _, ok := s.actions[action]; !ok {
+		s.serveErrorJSON(w, http.StatusNotFound, "not_found", "action not found")
+		return
+	}
+
+	err := s.runActions([]string{action})
+	if err != nil {
+		s.serveServerErrorJSON(w, r, err)
+		return
+	}
+
+	go s.build(false)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiBuildPost builds the website, waiting for the build to finish. The build
+// directory is cleaned first if the clean query parameter is true.
+func (s *Server) apiBuildPost(w http.ResponseWriter, r *http.Request) {
+	err := s.core.Build(r.URL.Query().Get("clean") == "true")
+	if err != nil {
+		s.serveServerErrorJSON(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) apiMentionsGet(w http.ResponseWriter, r *http.Request) {
+	mentions, err := s.core.DB().GetMentions(r.Context())
+	if err != nil {
+		s.serveServerErrorJSON(w, r, err)
+		return
+	}
+
+	s.serveJSON(w, http.StatusOK, mentions)
+}
+
+type apiMentionsRequest struct {
+	Action string   `json:"action"`
+	IDs    []string `json:"ids"`
+}
+
+func (s *Server) apiMentionsPost(w http.ResponseWriter, r *http.Request) {
+	var req apiMentionsRequest
+	if !s.decodeAPIRequest(w, r, &req) {
+		return
+	}
+
+	if req.Action != "approve" && req.Action != "delete" {
+		s.serveErrorJSON(w, http.StatusBadRequest, "invalid_request", "invalid action: "+req.Action)
+		return
+	}
+
+	err := s.moderateMentions(r.Context(), req.Action, req.IDs)
+	if err != nil {
+		s.serveServerErrorJSON(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type apiQueue struct {
+	Active []*core.QueueItem `json:"active"`
+	Failed []*core.QueueItem `json:"failed"`
+}
+
+func (s *Server) apiQueueGet(w http.ResponseWriter, r *http.Request) {
+	active, err := s.core.DB().GetActiveQueueItems(r.Context())
+	if err != nil {
+		s.serveServerErrorJSON(w, r, err)
+		return
+	}
+
+	failed, err := s.core.DB().GetFailedQueueItems(r.Context())
+	if err != nil {
+		s.serveServerErrorJSON(w, r, err)
+		return
+	}
+
+	s.serveJSON(w, http.StatusOK, &apiQueue{
+		Active: active,
+		Failed: failed,
+	})
+}
+
+func (s *Server) apiQueueFailedDelete(w http.ResponseWriter, r *http.Request) {
+	err := s.core.DB().DeleteFailedQueueItems(r.Context())
+	if err != nil {
+		s.serveServerErrorJSON(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.hacdias.com/eagle/core"
+)
+
+func TestAPIScopes(t *testing.T) {
+	s := &Server{
+		c: &core.Config{
+			ServerConfig: core.ServerConfig{
+				Login: core.Login{Username: "owner"},
+			},
+			Site: core.SiteConfig{BaseURL: "https://example.com"},
+		},
+		jwtAuth:  jwtauth.New("HS256", []byte("secret"), nil),
+		denylist: &tokenDenylist{ids: map[string]time.Time{}},
+		actions: map[string]func() error{
+			"Sync": func() error { return nil },
+		},
+	}
+
+	r := chi.NewRouter()
+	r.Group(func(r chi.Router) {
+		r.Use(s.mustIndieAuth)
+		r.Route(apiPath, s.apiRouter)
+	})
+
+	token := func(scope string) string {
+		_, signed, err := s.jwtAuth.Encode(map[string]any{
+			jwt.SubjectKey:    accessTokenSubject,
+			jwt.JwtIDKey:      scope,
+			jwt.ExpirationKey: time.Now().Add(time.Hour).Unix(),
+			"scope":           scope,
+		})
+		require.NoError(t, err)
+		return signed
+	}
+
+	do := func(method, path, secret string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if secret != "" {
+			req.Header.Set("Authorization", "Bearer "+secret)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodGet, apiPath+"/actions", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = do(http.MethodGet, apiPath+"/actions", token("create update"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "insufficient_scope")
+
+	w = do(http.MethodGet, apiPath+"/actions", token("entries:write actions:run"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `["Sync"]`, w.Body.String())
+
+	w = do(http.MethodPost, apiPath+"/actions/Unknown", token(scopeActionsRun))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Write scopes do not imply the read scopes, and vice-versa.
+	for _, req := range []struct{ method, path, scope string }{
+		{http.MethodGet, "/entries", scopeEntriesWrite},
+		{http.MethodPut, "/entries/posts/2024/01/01/hello", scopeEntriesRead},
+		{http.MethodDelete, "/entries/posts/2024/01/01/hello", scopeEntriesRead},
+		{http.MethodGet, "/files/content", scopeFilesWrite},
+		{http.MethodPut, "/files/content/index.md", scopeFilesRead},
+		{http.MethodPost, "/build", scopeActionsRun},
+		{http.MethodPost, "/mentions", scopeQueueManage},
+		{http.MethodDelete, "/queue/failed", scopeMentionsModerate},
+	} {
+		w = do(req.method, apiPath+req.path, token(req.scope))
+		assert.Equal(t, http.StatusForbidden, w.Code, "%s %s", req.method, req.path)
+	}
+
+	// Hidden files, such as the git configuration, are never accessible.
+	for _, req := range []struct{ method, path string }{
+		{http.MethodGet, "/files/.git/config"},
+		{http.MethodPut, "/files/.git/config"},
+		{http.MethodPut, "/files/content/../.git/hooks/pre-commit"},
+		{http.MethodPut, "/files/.github/workflows/ci.yml"},
+	} {
+		w = do(req.method, apiPath+req.path, token(scopeFilesRead+" "+scopeFilesWrite))
+		assert.Equal(t, http.StatusForbidden, w.Code, "%s %s", req.method, req.path)
+	}
+}
+
+func TestAPIEntries(t *testing.T) {
+	withFakeHugo(t)
+	s := newTestServer(t)
+	owner := testAccessToken(t, s, "owner", scopeEntriesRead+" "+scopeEntriesWrite)
+
+	w := testAPIRequest(s, http.MethodPost, "/entries", owner, `{"content": "Hello, world!"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = testAPIRequest(s, http.MethodPost, "/entries", owner, `{"slug": "hello", "title": "Hello", "content": "Hello, world!", "tags": ["greeting"], "unknown": true}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = testAPIRequest(s, http.MethodPost, "/entries", owner, `{"slug": "hello", "title": "Hello", "content": "Hello, world!", "tags": ["greeting"]}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var created apiEntry
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, core.NewPostID("hello", created.Date), created.ID)
+	assert.Equal(t, "Hello", created.Title)
+	assert.Equal(t, "owner", created.Author)
+	assert.Equal(t, []string{"greeting"}, created.Tags)
+	assert.Equal(t, created.Permalink, w.Header().Get("Location"))
+
+	w = testAPIRequest(s, http.MethodPost, "/entries", owner, `{"slug": "hello", "content": "Again."}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = testAPIRequest(s, http.MethodGet, "/entries"+created.ID, owner, "")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var entry apiEntry
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entry))
+	assert.Equal(t, created.ID, entry.ID)
+	assert.Contains(t, entry.Source, "title: Hello")
+	assert.Contains(t, entry.Source, "Hello, world!")
+
+	w = testAPIRequest(s, http.MethodGet, "/entries", owner, "")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var entries []*apiEntry
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	require.Len(t, entries, 1)
+	assert.Equal(t, created.ID, entries[0].ID)
+
+	// Authors cannot create entries on behalf of others.
+	alice := testAccessToken(t, s, "alice", scopeEntriesWrite)
+	w = testAPIRequest(s, http.MethodPost, "/entries", alice, `{"slug": "mine", "content": "---\nauthor: owner\n---\n\nMine."}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "alice", created.Author)
+}
+
+func TestAPIFiles(t *testing.T) {
+	s := newTestServer(t)
+	token := testAccessToken(t, s, "owner", scopeFilesRead+" "+scopeFilesWrite)
+
+	w := testAPIRequest(s, http.MethodGet, "/files/data/links.yaml", token, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = testAPIRequest(s, http.MethodPut, "/files/data/links.yaml", token, `{"content": "- https://example.org\r\n"}`)
+	require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+
+	w = testAPIRequest(s, http.MethodGet, "/files/data/links.yaml", token, "")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var file apiFileContent
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &file))
+	assert.Equal(t, "/data/links.yaml", file.Path)
+	assert.Equal(t, "- https://example.org\n", file.Content)
+
+	writeTestFile(t, s, "data/.hidden", "secret")
+
+	w = testAPIRequest(s, http.MethodGet, "/files/data", token, "")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var files []*apiFile
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &files))
+	require.Len(t, files, 1)
+	assert.Equal(t, "links.yaml", files[0].Name)
+	assert.False(t, files[0].Dir)
+	assert.EqualValues(t, len(file.Content), files[0].Size)
+
+	w = testAPIRequest(s, http.MethodPut, "/files/", token, `{"content": ""}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAPIEntriesDrafts(t *testing.T) {
+	s := newTestServer(t)
+	writeTestFile(t, s, s.core.EntryFilenameFromID("/published/"), "---\ntitle: Published\nauthor: owner\n---\n\nHello.\n")
+	writeTestFile(t, s, s.core.EntryFilenameFromID("/owner-draft/"), "---\ntitle: Owner\nauthor: owner\ndraft: true\n---\n\nSecret.\n")
+	writeTestFile(t, s, s.core.EntryFilenameFromID("/alice-draft/"), "---\ntitle: Alice\nauthor: alice\ndraft: true\n---\n\nMine.\n")
+
+	ids := func(token string) []string {
+		w := testAPIRequest(s, http.MethodGet, "/entries", token, "")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var entries []*apiEntry
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+		return lo.Map(entries, func(e *apiEntry, _ int) string { return e.ID })
+	}
+
+	owner := testAccessToken(t, s, "owner", scopeEntriesRead)
+	assert.ElementsMatch(t, []string{"/published/", "/owner-draft/", "/alice-draft/"}, ids(owner))
+
+	// Authors only see their own drafts.
+	alice := testAccessToken(t, s, "alice", scopeEntriesRead)
+	assert.ElementsMatch(t, []string{"/published/", "/alice-draft/"}, ids(alice))
+	assert.Equal(t, http.StatusNotFound, testAPIRequest(s, http.MethodGet, "/entries/owner-draft/", alice, "").Code)
+	assert.Equal(t, http.StatusOK, testAPIRequest(s, http.MethodGet, "/entries/alice-draft/", alice, "").Code)
+	assert.Equal(t, http.StatusOK, testAPIRequest(s, http.MethodGet, "/entries/published/", alice, "").Code)
+}
@@ -0,0 +1,106 @@
+(function () {
+  'use strict'
+
+  function decode (value) {
+    const base64 = value.replace(/-/g, '+').replace(/_/g, '/')
+    const binary = atob(base64.padEnd(base64.length + (4 - base64.length % 4) % 4, '='))
+    return Uint8Array.from(binary, c => c.charCodeAt(0)).buffer
+  }
+
+  function encode (buffer) {
+    const binary = String.fromCharCode(...new Uint8Array(buffer))
+    return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '')
+  }
+
+  function showError (err) {
+    const el = document.getElementById('passkey-error')
+    el.textContent = err.message || String(err)
+    el.hidden = false
+  }
+
+  function csrfToken () {
+    const meta = document.querySelector('meta[name="csrf-token"]')
+    return meta ? meta.content : ''
+  }
+
+  // The server only returns local paths, but make sure the redirect can never
+  // be a script or another website.
+  function redirect (path) {
+    window.location = /^\/(?![\/\\])/.test(path) ? path : '/'
+  }
+
+  async function post (url, body) {
+    const res = await fetch(url, {
+      method: 'POST',
+      credentials: 'same-origin',
+      headers: { 'Content-Type': 'application/json', 'X-CSRF-Token': csrfToken() },
+      body: body ? JSON.stringify(body) : undefined
+    })
+
+    const data = await res.json()
+    if (!res.ok) {
+      throw new Error(data.error_description || data.error || res.statusText)
+    }
+    return data
+  }
+
+  async function login (button) {
+    const options = await post(button.dataset.begin)
+    options.publicKey.challenge = decode(options.publicKey.challenge)
+    for (const credential of options.publicKey.allowCredentials || []) {
+      credential.id = decode(credential.id)
+    }
+
+    const credential = await navigator.credentials.get(options)
+    const data = await post(button.dataset.finish + window.location.search, {
+      id: credential.id,
+      rawId: encode(credential.rawId),
+      type: credential.type,
+      response: {
+        clientDataJSON: encode(credential.response.clientDataJSON),
+        authenticatorData: encode(credential.response.authenticatorData),
+        signature: encode(credential.response.signature),
+        userHandle: credential.response.userHandle ? encode(credential.response.userHandle) : undefined
+      }
+    })
+
+    redirect(data.redirect)
+  }
+
+  async function register (form) {
+    const options = await post(form.dataset.begin)
+    options.publicKey.challenge = decode(options.publicKey.challenge)
+    options.publicKey.user.id = decode(options.publicKey.user.id)
+    for (const credential of options.publicKey.excludeCredentials || []) {
+      credential.id = decode(credential.id)
+    }
+
+    const credential = await navigator.credentials.create(options)
+    const query = new URLSearchParams({ name: form.elements.name.value })
+    const data = await post(form.dataset.finish + '?' + query, {
+      id: credential.id,
+      rawId: encode(credential.rawId),
+      type: credential.type,
+      response: {
+        clientDataJSON: encode(credential.response.clientDataJSON),
+        attestationObject: encode(credential.response.attestationObject),
+        transports: credential.response.getTransports ? credential.response.getTransports() : []
+      }
+    })
+
+    redirect(data.redirect)
+  }
+
+  const button = document.getElementById('passkey-login')
+  if (button) {
+    button.addEventListener('click', () => login(button).catch(showError))
+  }
+
+  const form = document.getElementById('passkey-register')
+  if (form) {
+    form.addEventListener('submit', event => {
+      event.preventDefault()
+      register(form).catch(showError)
+    })
+  }
+})()
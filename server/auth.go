@@ -2,6 +2,8 @@ package server
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	urlpkg "net/url"
 	"strconv"
@@ -34,20 +36,25 @@ const (
 
 func (s *Server) indieauthGet(w http.ResponseWriter, r *http.Request) {
 	s.serveJSON(w, http.StatusOK, map[string]any{
-		"issuer":                           s.c.ID(),
-		"authorization_endpoint":           s.c.AbsoluteURL(authPath),
-		"token_endpoint":                   s.c.AbsoluteURL(tokenPath),
-		"introspection_endpoint":           s.c.AbsoluteURL(tokenVerifyPath),
-		"userinfo_endpoint":                s.c.AbsoluteURL(userInfoPath),
-		"code_challenge_methods_supported": indieauth.CodeChallengeMethods,
-		"grant_types_supported":            []string{"authorization_code", "refresh_token"},
-		"response_types_supported":         []string{"code"},
+		"issuer":                 s.c.ID(),
+		"authorization_endpoint": s.c.AbsoluteURL(authPath),
+		"token_endpoint":         s.c.AbsoluteURL(tokenPath),
+		"introspection_endpoint": s.c.AbsoluteURL(tokenVerifyPath),
+		"revocation_endpoint":    s.c.AbsoluteURL(tokenRevokePath),
+		"revocation_endpoint_auth_methods_supported": []string{"none"},
+		"userinfo_endpoint":                          s.c.AbsoluteURL(userInfoPath),
+		"code_challenge_methods_supported":           indieauth.CodeChallengeMethods,
+		"grant_types_supported":                      []string{"authorization_code", "refresh_token"},
+		"response_types_supported":                   []string{"code"},
 	})
 }
 
 type authPage struct {
 	Title   string
 	Request *indieauth.AuthenticationRequest
+	Client  *clientMetadata
+	// ClientError is the error found while discovering the client metadata.
+	ClientError string
 }
 
 func (s *Server) authGet(w http.ResponseWriter, r *http.Request) {
@@ -62,10 +69,23 @@ func (s *Server) authGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.panelTemplate(w, r, http.StatusOK, panelAuthTemplate, &authPage{
+	page := &authPage{
 		Title:   "Authorization",
 		Request: req,
-	})
+	}
+
+	page.Client, err = s.getClientMetadata(r.Context(), req.ClientID)
+	if err != nil {
+		page.ClientError = err.Error()
+		page.Client = &clientMetadata{ClientID: req.ClientID}
+	}
+
+	if !page.Client.verifyRedirect(req.RedirectURI) {
+		s.panelError(w, r, http.StatusBadRequest, fmt.Errorf("redirect_uri %q is not allowed for client %q", req.RedirectURI, req.ClientID))
+		return
+	}
+
+	s.panelTemplate(w, r, http.StatusOK, panelAuthTemplate, page)
 }
 
 func (s *Server) authPost(w http.ResponseWriter, r *http.Request) {
@@ -84,13 +104,41 @@ func (s *Server) authAcceptPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The metadata is cached from the authorization page. If it cannot be
+	// discovered, only the client ID is known.
+	client, err := s.getClientMetadata(r.Context(), req.ClientID)
+	if err != nil {
+		client = &clientMetadata{ClientID: req.ClientID}
+	}
+
+	if !client.verifyRedirect(req.RedirectURI) {
+		s.panelError(w, r, http.StatusBadRequest, fmt.Errorf("redirect_uri %q is not allowed for client %q", req.RedirectURI, req.ClientID))
+		return
+	}
+
+	// The granted scopes and expiry can be edited on the authorization page.
+	scopes := append(r.Form["scopes"], strings.Fields(r.Form.Get("extra_scopes"))...)
+	scopes = lo.Uniq(lo.Compact(scopes))
+
+	expiry := r.Form.Get("expiry")
+	if expiry == "custom" {
+		expiry = r.Form.Get("expiry_days")
+	}
+	if days, err := strconv.Atoi(expiry); err != nil || days < 0 {
+		s.panelError(w, r, http.StatusBadRequest, errors.New("expiry must be a positive number of days"))
+		return
+	}
+
 	_, signed, err := s.jwtAuth.Encode(map[string]any{
 		jwt.SubjectKey:          authCodeSubject,
 		jwt.IssuedAtKey:         time.Now().Unix(),
 		jwt.ExpirationKey:       time.Now().Add(time.Minute * 5),
-		"scope":                 strings.Join(req.Scopes, " "),
-		"expiry":                r.Form.Get("expiry"),
+		"scope":                 strings.Join(scopes, " "),
+		"expiry":                expiry,
 		"client_id":             req.ClientID,
+		"client_name":           client.Name,
+		"client_logo":           client.Logo,
+		"username":              s.getUser(r).Username,
 		"redirect_uri":          req.RedirectURI,
 		"code_challenge":        req.CodeChallenge,
 		"code_challenge_method": req.CodeChallengeMethod,
@@ -131,7 +179,7 @@ func (s *Server) tokenGet(w http.ResponseWriter, r *http.Request) {
 	// - Old Access Token Verifications: https://indieauth.spec.indieweb.org/20201126/#access-token-verification
 	// - New Access Token Verifications: https://indieauth.spec.indieweb.org/#access-token-verification
 	s.serveJSON(w, http.StatusOK, &tokenResponse{
-		Me:       s.c.ID(),
+		Me:       s.getUser(r).URL,
 		Scope:    strings.Join(s.getScopes(r), " "),
 		ClientID: s.getClient(r),
 	})
@@ -151,9 +199,9 @@ func (s *Server) tokenPost(w http.ResponseWriter, r *http.Request) {
 	if r.Form.Get("action") == "revoke" {
 		// NOTE: this is kept for backwards compatibility with prior versions
 		// of IndieAuth specification. Revocation endpoints are now separate.
-		tokenID := r.Form.Get("token")
-		if tokenID != "" {
-			_ = s.core.DB().DeleteToken(r.Context(), tokenID)
+		secret := r.Form.Get("token")
+		if secret != "" {
+			_ = s.revokeTokenSecret(r.Context(), secret)
 		}
 		w.WriteHeader(http.StatusOK)
 		return
@@ -168,29 +216,30 @@ func (s *Server) tokenVerifyPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tokenID := r.Form.Get("token")
-	if tokenID == "" {
-		tokenID = bearerToken(r)
+	secret := r.Form.Get("token")
+	if secret == "" {
+		secret = bearerToken(r)
 	}
-	if tokenID == "" {
+	if secret == "" {
 		s.serveJSON(w, http.StatusOK, map[string]any{"active": false})
 		return
 	}
 
-	token, err := s.core.DB().GetToken(r.Context(), tokenID, core.TokenTypeAccess)
+	token, err := s.verifyAccessToken(r.Context(), secret)
 	if err != nil {
 		s.serveJSON(w, http.StatusOK, map[string]any{"active": false})
 		return
 	}
 
-	if !token.Expiry.IsZero() && token.Expiry.Before(time.Now()) {
+	user, err := s.getUserByUsername(r.Context(), token.Username)
+	if err != nil {
 		s.serveJSON(w, http.StatusOK, map[string]any{"active": false})
 		return
 	}
 
 	info := map[string]any{
 		"active":    true,
-		"me":        s.c.ID(),
+		"me":        user.URL,
 		"client_id": token.ClientID,
 		"scope":     token.Scope,
 		"iat":       token.Created.Unix(),
@@ -234,8 +283,16 @@ func (s *Server) authorizationCodeExchange(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// The code is issued to the logged in user, whose profile URL is their
+	// identity. Codes from before there were multiple users have no username.
+	user, err := s.getUserByUsername(r.Context(), getString(token, "username"))
+	if err != nil {
+		s.serveErrorJSON(w, http.StatusBadRequest, "invalid_grant", "user not found")
+		return
+	}
+
 	at := &tokenResponse{
-		Me: s.c.ID(),
+		Me: user.URL,
 	}
 
 	scope := getString(token, "scope")
@@ -247,7 +304,13 @@ func (s *Server) authorizationCodeExchange(w http.ResponseWriter, r *http.Reques
 			return
 		}
 
-		accessToken, err := s.generateToken(r.Context(), authRequest.ClientID, scope, expiry)
+		client := &clientMetadata{
+			ClientID: authRequest.ClientID,
+			Name:     getString(token, "client_name"),
+			Logo:     getString(token, "client_logo"),
+		}
+
+		accessToken, err := s.generateToken(r.Context(), client, user.Username, scope, expiry)
 		if err != nil {
 			s.serveErrorJSON(w, http.StatusInternalServerError, "server_error", err.Error())
 			return
@@ -259,7 +322,7 @@ func (s *Server) authorizationCodeExchange(w http.ResponseWriter, r *http.Reques
 		at.Scope = scope
 
 		if expiry > 0 {
-			refreshToken, err := s.generateRefreshToken(r.Context(), authRequest.ClientID, scope, expiry*2)
+			refreshToken, err := s.generateRefreshToken(r.Context(), client, user.Username, scope, expiry*2)
 			if err != nil {
 				s.serveErrorJSON(w, http.StatusInternalServerError, "server_error", err.Error())
 				return
@@ -269,7 +332,7 @@ func (s *Server) authorizationCodeExchange(w http.ResponseWriter, r *http.Reques
 		}
 	}
 
-	at.Profile = s.buildProfile(scope)
+	at.Profile = s.buildProfile(user, scope)
 	s.serveJSON(w, http.StatusOK, at)
 }
 
@@ -279,18 +342,20 @@ func (s *Server) userInfoGet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	scope := strings.Join(s.getScopes(r), " ")
-	profile := s.buildProfile(scope)
+	profile := s.buildProfile(s.getUser(r), scope)
 	s.serveJSON(w, http.StatusOK, profile)
 }
 
-func (s *Server) buildProfile(scope string) *tokenUser {
+func (s *Server) buildProfile(user *core.User, scope string) *tokenUser {
 	var profile *tokenUser
 
 	if strings.Contains(scope, "profile") {
 		profile = &tokenUser{
-			Name:  s.c.Site.Params.Author.Name,
-			URL:   s.c.ID(),
-			Photo: s.c.Site.Params.Author.Photo,
+			Name: user.Name,
+			URL:  user.URL,
+		}
+		if s.isConfigUser(user.Username) {
+			profile.Photo = s.c.Site.Params.Author.Photo
 		}
 	}
 
@@ -298,7 +363,7 @@ func (s *Server) buildProfile(scope string) *tokenUser {
 		if profile == nil {
 			profile = &tokenUser{}
 		}
-		profile.Email = s.c.Site.Params.Author.Email
+		profile.Email = user.Email
 	}
 
 	return profile
@@ -317,44 +382,56 @@ func handleExpiry(expiry string) (time.Duration, error) {
 	return time.Hour * 24 * time.Duration(days), nil
 }
 
-func (s *Server) generateToken(ctx context.Context, client, scope string, expiry time.Duration) (string, error) {
-	id := uuid.New().String()
-
+func (s *Server) generateToken(ctx context.Context, client *clientMetadata, username, scope string, expiry time.Duration) (string, error) {
 	var expiresAt time.Time
 	if expiry > 0 {
 		expiresAt = time.Now().Add(expiry)
 	}
 
-	return id, s.core.DB().CreateToken(ctx, &core.Token{
-		ID:       id,
-		Type:     core.TokenTypeAccess,
-		ClientID: client,
-		Scope:    scope,
-		Expiry:   expiresAt,
-		Created:  time.Now(),
-	})
+	token := &core.Token{
+		Type:       core.TokenTypeAccess,
+		Username:   username,
+		ClientID:   client.ClientID,
+		ClientName: client.Name,
+		ClientLogo: client.Logo,
+		Scope:      scope,
+		Expiry:     expiresAt,
+		Created:    time.Now(),
+	}
+
+	if s.c.JWTAccessTokens {
+		token.ID = uuid.New().String()
+		return s.generateJWTAccessToken(ctx, token)
+	}
+
+	secret := uuid.New().String()
+	token.ID = core.HashToken(secret)
+	return secret, s.core.DB().CreateToken(ctx, token)
 }
 
-func (s *Server) generateRefreshToken(ctx context.Context, client, scope string, expiry time.Duration) (string, error) {
-	id := uuid.New().String()
-	return id, s.core.DB().CreateToken(ctx, &core.Token{
-		ID:       id,
-		Type:     core.TokenTypeRefresh,
-		ClientID: client,
-		Scope:    scope,
-		Expiry:   time.Now().Add(expiry),
-		Created:  time.Now(),
+func (s *Server) generateRefreshToken(ctx context.Context, client *clientMetadata, username, scope string, expiry time.Duration) (string, error) {
+	secret := uuid.New().String()
+	return secret, s.core.DB().CreateToken(ctx, &core.Token{
+		ID:         core.HashToken(secret),
+		Type:       core.TokenTypeRefresh,
+		Username:   username,
+		ClientID:   client.ClientID,
+		ClientName: client.Name,
+		ClientLogo: client.Logo,
+		Scope:      scope,
+		Expiry:     time.Now().Add(expiry),
+		Created:    time.Now(),
 	})
 }
 
 func (s *Server) refreshTokenGrant(w http.ResponseWriter, r *http.Request) {
-	tokenID := r.Form.Get("refresh_token")
-	if tokenID == "" {
+	secret := r.Form.Get("refresh_token")
+	if secret == "" {
 		s.serveErrorJSON(w, http.StatusBadRequest, "invalid_request", "missing refresh_token")
 		return
 	}
 
-	rt, err := s.core.DB().GetToken(r.Context(), tokenID, core.TokenTypeRefresh)
+	rt, err := s.core.DB().GetToken(r.Context(), core.HashToken(secret), core.TokenTypeRefresh)
 	if err != nil {
 		s.serveErrorJSON(w, http.StatusBadRequest, "invalid_grant", "invalid refresh token")
 		return
@@ -394,20 +471,32 @@ func (s *Server) refreshTokenGrant(w http.ResponseWriter, r *http.Request) {
 	// Derive original access token duration: refresh expiry was set to 2x access expiry.
 	accessExpiry := rt.Expiry.Sub(rt.Created) / 2
 
-	accessToken, err := s.generateToken(r.Context(), rt.ClientID, scope, accessExpiry)
+	client := &clientMetadata{
+		ClientID: rt.ClientID,
+		Name:     rt.ClientName,
+		Logo:     rt.ClientLogo,
+	}
+
+	user, err := s.getUserByUsername(r.Context(), rt.Username)
+	if err != nil {
+		s.serveErrorJSON(w, http.StatusBadRequest, "invalid_grant", "user not found")
+		return
+	}
+
+	accessToken, err := s.generateToken(r.Context(), client, user.Username, scope, accessExpiry)
 	if err != nil {
 		s.serveErrorJSON(w, http.StatusInternalServerError, "server_error", err.Error())
 		return
 	}
 
-	newRefreshToken, err := s.generateRefreshToken(r.Context(), rt.ClientID, scope, accessExpiry*2)
+	newRefreshToken, err := s.generateRefreshToken(r.Context(), client, user.Username, scope, accessExpiry*2)
 	if err != nil {
 		s.serveErrorJSON(w, http.StatusInternalServerError, "server_error", err.Error())
 		return
 	}
 
 	s.serveJSON(w, http.StatusOK, &tokenResponse{
-		Me:           s.c.ID(),
+		Me:           user.URL,
 		AccessToken:  accessToken,
 		RefreshToken: newRefreshToken,
 		TokenType:    "Bearer",
@@ -440,25 +529,28 @@ func bearerToken(r *http.Request) string {
 
 func (s *Server) mustIndieAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tokenID := bearerToken(r)
-		if tokenID == "" {
+		secret := bearerToken(r)
+		if secret == "" {
 			s.serveErrorJSON(w, http.StatusUnauthorized, "invalid_request", "invalid token")
 			return
 		}
 
-		token, err := s.core.DB().GetToken(r.Context(), tokenID, core.TokenTypeAccess)
+		token, err := s.verifyAccessToken(r.Context(), secret)
 		if err != nil {
-			s.serveErrorJSON(w, http.StatusUnauthorized, "invalid_request", "invalid token")
+			s.serveErrorJSON(w, http.StatusUnauthorized, "invalid_request", err.Error())
 			return
 		}
 
-		if !token.Expiry.IsZero() && token.Expiry.Before(time.Now()) {
-			s.serveErrorJSON(w, http.StatusUnauthorized, "invalid_request", "token expired")
+		// The tokens of deleted users are deleted as well, except for JWTs.
+		user, err := s.getUserByUsername(r.Context(), token.Username)
+		if err != nil {
+			s.serveErrorJSON(w, http.StatusUnauthorized, "invalid_request", errInvalidToken.Error())
 			return
 		}
 
 		ctx := context.WithValue(r.Context(), scopesContextKey, strings.Fields(token.Scope))
 		ctx = context.WithValue(ctx, clientContextKey, token.ClientID)
+		ctx = context.WithValue(ctx, userContextKey, user)
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	urlpkg "net/url"
+	"slices"
+	"strings"
+
+	"go.hacdias.com/eagle/core"
+	"willnorris.com/go/microformats"
+)
+
+// maxClientMetadataSize is the maximum size of the client metadata documents.
+const maxClientMetadataSize = 1 << 20 // 1 MB
+
+// clientMetadata is the metadata of an IndieAuth client, discovered from its
+// client ID.
+//
+// https://indieauth.spec.indieweb.org/#client-information-discovery
+type clientMetadata struct {
+	ClientID     string   `json:"client_id"`
+	Name         string   `json:"client_name"`
+	URI          string   `json:"client_uri"`
+	Logo         string   `json:"logo_uri"`
+	RedirectURIs []string `json:"redirect_uris"`
+}
+
+// verifyRedirect returns whether the redirect URI is allowed for the client:
+// either it has the same scheme, host and port as the client ID, or it is one
+// of the redirect URIs published by the client.
+func (c *clientMetadata) verifyRedirect(redirectURI string) bool {
+	clientURL, err := urlpkg.Parse(c.ClientID)
+	if err != nil {
+		return false
+	}
+
+	redirectURL, err := urlpkg.Parse(redirectURI)
+	if err != nil {
+		return false
+	}
+
+	if clientURL.Scheme == redirectURL.Scheme && clientURL.Host == redirectURL.Host {
+		return true
+	}
+
+	return slices.Contains(c.RedirectURIs, redirectURI)
+}
+
+// getClientMetadata returns the metadata of the client, which is cached. If the
+// client does not publish any metadata, only the client ID is set.
+func (s *Server) getClientMetadata(ctx context.Context, clientID string) (*clientMetadata, error) {
+	if client, ok := s.clients.GetIfPresent(clientID); ok {
+		return client, nil
+	}
+
+	client, err := s.discoverClientMetadata(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.clients.Set(clientID, client)
+	return client, nil
+}
+
+func (s *Server) discoverClientMetadata(ctx context.Context, clientID string) (*clientMetadata, error) {
+	client := &clientMetadata{ClientID: clientID}
+
+	// Loopback and private clients, usually used in development, cannot be
+	// fetched, nor should they be. The HTTP client also refuses the hostnames
+	// that resolve, or redirect, to them.
+	if core.IsPrivateURL(clientID) {
+		return client, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, clientID, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json, text/html;q=0.9")
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch client metadata: %w", err)
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, fmt.Errorf("failed to fetch client metadata: status code %d", res.StatusCode)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	body := io.LimitReader(res.Body, maxClientMetadataSize)
+
+	switch mediaType {
+	case "application/json":
+		err = json.NewDecoder(body).Decode(client)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client metadata: %w", err)
+		}
+
+		if client.ClientID != clientID {
+			return nil, errors.New("invalid client metadata: client_id does not match")
+		}
+
+		if client.URI != "" && !strings.HasPrefix(clientID, client.URI) {
+			return nil, errors.New("invalid client metadata: client_uri is not a prefix of client_id")
+		}
+	case "text/html":
+		parseClientHApp(client, microformats.Parse(body, res.Request.URL))
+	}
+
+	// Redirect URIs can also be published in the Link header of older clients.
+	for _, link := range res.Header.Values("Link") {
+		for part := range strings.SplitSeq(link, ",") {
+			if !strings.Contains(part, `rel="redirect_uri"`) && !strings.Contains(part, "rel=redirect_uri") {
+				continue
+			}
+			start, end := strings.Index(part, "<"), strings.Index(part, ">")
+			if start == -1 || end < start {
+				continue
+			}
+			if ref, err := res.Request.URL.Parse(part[start+1 : end]); err == nil {
+				client.RedirectURIs = append(client.RedirectURIs, ref.String())
+			}
+		}
+	}
+
+	for _, uri := range []*string{&client.URI, &client.Logo} {
+		if !strings.HasPrefix(*uri, "https://") && !strings.HasPrefix(*uri, "http://") {
+			*uri = ""
+		}
+	}
+
+	return client, nil
+}
+
+// parseClientHApp parses the h-app, or legacy h-x-app, of the client, as well
+// as the redirect URIs published with rel=redirect_uri.
+func parseClientHApp(client *clientMetadata, data *microformats.Data) {
+	if data == nil {
+		return
+	}
+
+	client.RedirectURIs = append(client.RedirectURIs, data.Rels["redirect_uri"]...)
+
+	for _, item := range data.Items {
+		if !slices.Contains(item.Type, "h-app") && !slices.Contains(item.Type, "h-x-app") {
+			continue
+		}
+
+		client.Name = firstProperty(item, "name")
+		client.URI = firstProperty(item, "url")
+		client.Logo = firstProperty(item, "logo")
+		if client.Logo == "" {
+			client.Logo = firstProperty(item, "photo")
+		}
+		return
+	}
+}
+
+func firstProperty(item *microformats.Microformat, name string) string {
+	for _, value := range item.Properties[name] {
+		switch v := value.(type) {
+		case string:
+			return v
+		case map[string]string:
+			return v["value"]
+		case map[string]any:
+			if s, ok := v["value"].(string); ok {
+				return s
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/maypok86/otter/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t *handlerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	w := httptest.NewRecorder()
+	t.handler.ServeHTTP(w, r)
+	res := w.Result()
+	res.Request = r
+	return res, nil
+}
+
+func newTestClientsServer(handler http.HandlerFunc) *Server {
+	return &Server{
+		httpClient: &http.Client{Transport: &handlerTransport{handler: handler}},
+		clients: otter.Must(&otter.Options[string, *clientMetadata]{
+			ExpiryCalculator: otter.ExpiryWriting[string, *clientMetadata](time.Minute),
+		}),
+	}
+}
+
+func TestClientMetadataJSON(t *testing.T) {
+	s := newTestClientsServer(func(w http.ResponseWriter, r *http.Request) {
+		assert.Contains(t, r.Header.Get("Accept"), "application/json")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{
+			"client_id": "https://app.example/client.json",
+			"client_name": "Example App",
+			"client_uri": "https://app.example/",
+			"logo_uri": "https://app.example/logo.png",
+			"redirect_uris": ["https://callback.example/auth"]
+		}`))
+	})
+
+	client, err := s.getClientMetadata(context.Background(), "https://app.example/client.json")
+	require.NoError(t, err)
+	assert.Equal(t, "Example App", client.Name)
+	assert.Equal(t, "https://app.example/", client.URI)
+	assert.Equal(t, "https://app.example/logo.png", client.Logo)
+
+	assert.True(t, client.verifyRedirect("https://app.example/callback"))
+	assert.True(t, client.verifyRedirect("https://callback.example/auth"))
+	assert.False(t, client.verifyRedirect("https://callback.example/other"))
+	assert.False(t, client.verifyRedirect("https://evil.example/auth"))
+
+	_, err = s.getClientMetadata(context.Background(), "https://app.example/other.json")
+	assert.ErrorContains(t, err, "client_id does not match")
+}
+
+func TestClientMetadataHApp(t *testing.T) {
+	s := newTestClientsServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Link", `<https://callback.example/header>; rel="redirect_uri"`)
+		_, _ = w.Write([]byte(`<html><head>
+			<link rel="redirect_uri" href="/callback">
+		</head><body>
+			<div class="h-app">
+				<img class="u-logo" src="/logo.png" alt="">
+				<a class="u-url p-name" href="/">Example App</a>
+			</div>
+		</body></html>`))
+	})
+
+	client, err := s.getClientMetadata(context.Background(), "https://app.example/")
+	require.NoError(t, err)
+	assert.Equal(t, "Example App", client.Name)
+	assert.Equal(t, "https://app.example/", client.URI)
+	assert.Equal(t, "https://app.example/logo.png", client.Logo)
+	assert.ElementsMatch(t, []string{"https://app.example/callback", "https://callback.example/header"}, client.RedirectURIs)
+	assert.True(t, client.verifyRedirect("https://callback.example/header"))
+}
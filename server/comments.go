@@ -0,0 +1,313 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/samber/lo"
+	"go.hacdias.com/eagle/core"
+	"go.hacdias.com/eagle/xray"
+)
+
+const (
+	commentsPath            = "/comments"
+	commentsVerifyPath      = commentsPath + "/verify"
+	commentsUnsubscribePath = commentsPath + "/unsubscribe"
+
+	// commentsVerifyExpiry is for how long the verification links are valid.
+	commentsVerifyExpiry = time.Hour * 72
+	// commentsVerifiedTrust is for how long a verified address is trusted:
+	// the comments left with it in the meantime are verified without a new
+	// link. Anyone can leave a comment with a verified address, but they
+	// cannot receive the notifications, which are sent to the address.
+	commentsVerifiedTrust = time.Hour * 24 * 365
+)
+
+func (s *Server) commentsPost(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		s.serveErrorHTML(w, r, http.StatusBadRequest, fmt.Errorf("parse form failed: %w", err))
+		return
+	}
+
+	// Bots fill in every field, including the ones hidden from humans. They are
+	// told it worked, so that they do not adapt.
+	if s.c.Comments.Honeypot != "" && r.Form.Get(s.c.Comments.Honeypot) != "" {
+		s.log.Infow("discarded comment that filled in the honeypot", "ip", clientIP(r))
+		http.Redirect(w, r, s.c.Comments.Redirect, http.StatusSeeOther)
+		return
+	}
+
+	// Anti-spam prevention with user-defined captcha value.
+	if s.c.Comments.Captcha != "" && s.c.Comments.Captcha != strings.ToLower(r.Form.Get("captcha")) {
+		s.serveErrorHTML(w, r, http.StatusBadRequest, errors.New("anti-spam verification failed"))
+		return
+	}
+
+	name := r.Form.Get("name")
+	website := r.Form.Get("website")
+	content := r.Form.Get("content")
+	target := r.Form.Get("target")
+	parent := r.Form.Get("parent")
+	email := strings.TrimSpace(r.Form.Get("email"))
+
+	if target == "" {
+		s.serveErrorHTML(w, r, http.StatusBadRequest, errors.New("target entry is missing"))
+		return
+	}
+
+	e, err := s.core.GetEntry(target)
+	if err != nil {
+		s.serveErrorHTML(w, r, http.StatusBadRequest, fmt.Errorf("target entry is invalid: %w", err))
+		return
+	}
+
+	// Sanitize things just in case, specially the content.
+	sanitize := bluemonday.StrictPolicy()
+	name = sanitize.Sanitize(name)
+	website = sanitize.Sanitize(website)
+	content = sanitize.Sanitize(content)
+
+	if len(name) == 0 || len(content) == 0 {
+		s.serveErrorHTML(w, r, http.StatusBadRequest, errors.New("name and content are required"))
+		return
+	}
+
+	if len(content) > 1000 || len(name) > 200 || len(website) > 200 || len(email) > 254 {
+		s.serveErrorHTML(w, r, http.StatusBadRequest, errors.New("content, name, website or email outside of limits"))
+		return
+	}
+
+	if _, err := url.Parse(website); err != nil {
+		s.serveErrorHTML(w, r, http.StatusBadRequest, fmt.Errorf("website url is invalid: %w", err))
+		return
+	}
+
+	if email != "" {
+		address, err := mail.ParseAddress(email)
+		if err != nil {
+			s.serveErrorHTML(w, r, http.StatusBadRequest, fmt.Errorf("email is invalid: %w", err))
+			return
+		}
+		email = address.Address
+	}
+
+	if parent != "" {
+		sidecar, err := s.core.GetSidecar(e)
+		if err != nil {
+			s.serveErrorHTML(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		if !lo.ContainsBy(sidecar.Replies, func(m *core.Mention) bool { return m.ID == parent }) {
+			s.serveErrorHTML(w, r, http.StatusBadRequest, errors.New("parent comment is invalid"))
+			return
+		}
+	}
+
+	mention := &core.Mention{
+		ID: uuid.New().String(),
+		Post: xray.Post{
+			Author:    name,
+			AuthorURL: website,
+			Content:   content,
+			Date:      time.Now(),
+		},
+		EntryID:  e.ID,
+		ParentID: parent,
+	}
+
+	mention.SpamScore, err = s.spam.Score(r.Context(), mention)
+	if err != nil {
+		s.log.Errorw("failed to score comment", "err", err)
+	} else if s.c.Comments.SpamThreshold != 0 && mention.SpamScore >= s.c.Comments.SpamThreshold {
+		s.log.Infow("discarded spam comment", "score", mention.SpamScore, "name", name, "website", website, "content", content)
+		http.Redirect(w, r, s.c.Comments.Redirect, http.StatusSeeOther)
+		return
+	}
+
+	action := s.moderateMention(r.Context(), mention)
+	if action == core.MentionBlock {
+		s.log.Infow("discarded blocked comment", "name", name, "website", website, "content", content)
+		http.Redirect(w, r, s.c.Comments.Redirect, http.StatusSeeOther)
+		return
+	}
+
+	s.log.Infow("received comment entry", "name", name, "website", website, "content", content, "score", mention.SpamScore)
+
+	// The address is only verified once the comment is approved, such that
+	// spammers cannot use the form to send emails.
+	if email != "" && s.mailer != nil {
+		err = s.core.DB().CreateCommentEmail(r.Context(), &core.CommentEmail{
+			MentionID: mention.ID,
+			Email:     email,
+			Token:     uuid.New().String(),
+			Created:   time.Now(),
+		})
+		if err != nil {
+			s.log.Errorw("failed to save comment email", "err", err)
+		}
+	}
+
+	err = s.receiveMention(r.Context(), e, mention, action)
+	if err != nil {
+		s.serveErrorHTML(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	http.Redirect(w, r, s.c.Comments.Redirect, http.StatusSeeOther)
+}
+
+// mentionApproved learns that the public mention is legitimate, and handles
+// the email addresses of its comment and of the parent comment.
+func (s *Server) mentionApproved(ctx context.Context, m *core.Mention) {
+	if m.Private {
+		return
+	}
+
+	err := s.spam.Train(ctx, m, false)
+	if err != nil {
+		s.log.Errorw("failed to train spam filter", "id", m.ID, "err", err)
+	}
+
+	if author := m.VerifiedAuthorURL(); author != "" {
+		err = s.core.DB().SaveApprovedAuthor(ctx, &core.ApprovedAuthor{
+			URL:      core.NormalizeAuthorURL(author),
+			Approved: time.Now(),
+		})
+		if err != nil {
+			s.log.Errorw("failed to save approved author", "id", m.ID, "err", err)
+		}
+	}
+
+	if s.mailer == nil {
+		return
+	}
+
+	e, err := s.core.GetEntry(m.EntryID)
+	if err != nil {
+		s.log.Errorw("failed to get entry of mention", "id", m.ID, "err", err)
+		return
+	}
+
+	email, err := s.core.DB().GetCommentEmail(ctx, m.ID)
+	if err == nil && !email.Verified {
+		s.verifyCommentEmail(ctx, e, email)
+	}
+
+	if m.ParentID == "" {
+		return
+	}
+
+	parent, err := s.core.DB().GetCommentEmail(ctx, m.ParentID)
+	if err != nil || !parent.Verified || (email != nil && email.Email == parent.Email) {
+		return
+	}
+
+	body := fmt.Sprintf(
+		"%s replied to your comment on %s:\n\n%s\n\nTo stop receiving notifications of replies to this comment, visit:\n%s\n",
+		m.Author, e.Permalink, m.Content, s.commentsEmailURL(commentsUnsubscribePath, parent),
+	)
+	s.mail(parent.Email, "New reply to your comment on "+s.c.Site.Title, body)
+}
+
+// mentionDeleted learns that the mention is spam, unless it was private, and
+// forgets the email address of its author.
+func (s *Server) mentionDeleted(ctx context.Context, m *core.Mention) {
+	if !m.Private {
+		err := s.spam.Train(ctx, m, true)
+		if err != nil {
+			s.log.Errorw("failed to train spam filter", "id", m.ID, "err", err)
+		}
+	}
+
+	err := s.core.DB().DeleteCommentEmail(ctx, m.ID)
+	if err != nil {
+		s.log.Errorw("failed to delete comment email", "id", m.ID, "err", err)
+	}
+}
+
+// verifyCommentEmail marks the address as verified if it was verified with a
+// recent comment, or sends it a verification link otherwise.
+func (s *Server) verifyCommentEmail(ctx context.Context, e *core.Entry, email *core.CommentEmail) {
+	verified, err := s.core.DB().IsCommentEmailVerified(ctx, email.Email, time.Now().Add(-commentsVerifiedTrust))
+	if err != nil {
+		s.log.Errorw("failed to check comment email", "err", err)
+		return
+	}
+
+	if verified {
+		email.Verified = true
+		err = s.core.DB().UpdateCommentEmail(ctx, email)
+		if err != nil {
+			s.log.Errorw("failed to update comment email", "err", err)
+		}
+		return
+	}
+
+	email.Requested = time.Now()
+	err = s.core.DB().UpdateCommentEmail(ctx, email)
+	if err != nil {
+		s.log.Errorw("failed to update comment email", "err", err)
+		return
+	}
+
+	body := fmt.Sprintf(
+		"Your comment on %s was published. To be notified of replies to it, confirm your email address within %d days by visiting:\n%s\n\nIf you did not leave a comment, you can ignore this email.\n",
+		e.Permalink, int(commentsVerifyExpiry.Hours()/24), s.commentsEmailURL(commentsVerifyPath, email),
+	)
+	s.mail(email.Email, "Confirm your email address for "+s.c.Site.Title, body)
+}
+
+func (s *Server) commentsEmailURL(path string, email *core.CommentEmail) string {
+	return s.c.AbsoluteURL(path + "?" + url.Values{"token": {email.Token}}.Encode())
+}
+
+func (s *Server) mail(to, subject, body string) {
+	go func() {
+		err := s.mailer.Mail(to, subject, body)
+		if err != nil {
+			s.log.Errorw("failed to send email", "subject", subject, "err", err)
+		}
+	}()
+}
+
+func (s *Server) commentsVerifyGet(w http.ResponseWriter, r *http.Request) {
+	email, err := s.core.DB().GetCommentEmailByToken(r.Context(), r.URL.Query().Get("token"))
+	if err != nil || (!email.Verified && time.Since(email.Requested) > commentsVerifyExpiry) {
+		s.serveErrorHTML(w, r, http.StatusNotFound, errors.New("the verification link is invalid or expired"))
+		return
+	}
+
+	email.Verified = true
+	err = s.core.DB().UpdateCommentEmail(r.Context(), email)
+	if err != nil {
+		s.serveErrorHTML(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.serveMessageHTML(w, r, "Email Confirmed", "You will be notified of replies to your comment.")
+}
+
+func (s *Server) commentsUnsubscribeGet(w http.ResponseWriter, r *http.Request) {
+	email, err := s.core.DB().GetCommentEmailByToken(r.Context(), r.URL.Query().Get("token"))
+	if err != nil {
+		s.serveErrorHTML(w, r, http.StatusNotFound, errors.New("the unsubscribe link is invalid or expired"))
+		return
+	}
+
+	err = s.core.DB().DeleteCommentEmail(r.Context(), email.MentionID)
+	if err != nil {
+		s.serveErrorHTML(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.serveMessageHTML(w, r, "Unsubscribed", "You will no longer be notified of replies to your comment.")
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.hacdias.com/eagle/core"
+)
+
+func TestCommentsVerify(t *testing.T) {
+	s := newTestServer(t)
+	s.staticFs = newStaticFs(s.c.PublicDirectory)
+	ctx := context.Background()
+
+	for _, email := range []*core.CommentEmail{
+		{MentionID: "1", Email: "jane@example.org", Token: "sent", Requested: time.Now()},
+		{MentionID: "2", Email: "jane@example.org", Token: "expired", Requested: time.Now().Add(-commentsVerifyExpiry - time.Minute)},
+		{MentionID: "3", Email: "jane@example.org", Token: "unsent"},
+	} {
+		require.NoError(t, s.core.DB().CreateCommentEmail(ctx, email))
+	}
+
+	verify := func(token string) int {
+		w := httptest.NewRecorder()
+		s.commentsVerifyGet(w, httptest.NewRequest(http.MethodGet, commentsVerifyPath+"?token="+token, nil))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusNotFound, verify("expired"))
+	assert.Equal(t, http.StatusNotFound, verify("unsent"))
+	assert.Equal(t, http.StatusNotFound, verify("unknown"))
+	assert.Equal(t, http.StatusOK, verify("sent"))
+
+	email, err := s.core.DB().GetCommentEmail(ctx, "1")
+	require.NoError(t, err)
+	assert.True(t, email.Verified)
+
+	email, err = s.core.DB().GetCommentEmail(ctx, "2")
+	require.NoError(t, err)
+	assert.False(t, email.Verified)
+}
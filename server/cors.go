@@ -0,0 +1,40 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/samber/lo"
+)
+
+// withCORS returns a middleware that allows cross-origin GET requests from the
+// given origins, or from any origin if they include "*".
+func withCORS(origins []string) func(http.Handler) http.Handler {
+	anyOrigin := lo.Contains(origins, "*")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			w.Header().Add("Vary", "Origin")
+
+			if origin != "" && (anyOrigin || lo.Contains(origins, origin)) {
+				if anyOrigin {
+					w.Header().Set("Access-Control-Allow-Origin", "*")
+				} else {
+					w.Header().Set("Access-Control-Allow-Origin", origin)
+				}
+
+				if r.Method == http.MethodOptions {
+					w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+					w.Header().Set("Access-Control-Max-Age", "86400")
+				}
+			}
+
+			if r.Method == http.MethodOptions {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
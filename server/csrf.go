@@ -0,0 +1,121 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"mime"
+	"net/http"
+	"net/url"
+)
+
+const (
+	csrfFieldName  = "csrf_token"
+	csrfHeaderName = "X-CSRF-Token"
+)
+
+var (
+	errCSRFToken  = errors.New("invalid or missing CSRF token")
+	errCSRFOrigin = errors.New("cross-origin request")
+)
+
+// csrfToken returns the CSRF token of the session of the request, or an empty
+// string if there is no session. The token is bound to the session, such that
+// it does not need to be stored, and is valid for as long as the session is.
+func (s *Server) csrfToken(r *http.Request) string {
+	session := s.getSession(r)
+	if session == nil {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, []byte(s.c.TokensSecret))
+	_, _ = mac.Write([]byte("csrf:" + session.ID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// csrfField returns the hidden input with the CSRF token, to be included in the
+// forms of the panel.
+func csrfField(token string) template.HTML {
+	return template.HTML(`<input type='hidden' name='` + csrfFieldName + `' value='` + template.HTMLEscapeString(token) + `' />`)
+}
+
+// mustCSRF validates that the state-changing requests come from the panel
+// itself: the Origin and Sec-Fetch-Site headers, when sent by the browser, must
+// be of the same origin, and the request must carry the CSRF token of the
+// session in either the form or the X-CSRF-Token header. It must be used after
+// [Server.mustLoggedIn].
+func (s *Server) mustCSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if err := s.checkOrigin(r); err != nil {
+			s.csrfError(w, r, err)
+			return
+		}
+
+		token := r.Header.Get(csrfHeaderName)
+		if token == "" {
+			// The form is parsed here with the same limits as the handlers,
+			// which then reuse it.
+			if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+				r.Body = http.MaxBytesReader(w, r.Body, maxMediaSize)
+				_ = r.ParseMultipartForm(maxMediaSize)
+			}
+			token = r.PostFormValue(csrfFieldName)
+		}
+
+		expected := s.csrfToken(r)
+		if token == "" || expected == "" || !hmac.Equal([]byte(token), []byte(expected)) {
+			s.csrfError(w, r, errCSRFToken)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkOrigin checks that the request was not made from another origin. The
+// headers are only checked if present, as not all clients send them. The
+// origin must either match the host of the request, or the one of the website.
+func (s *Server) checkOrigin(r *http.Request) error {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "", "same-origin", "none":
+	default:
+		return errCSRFOrigin
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return errCSRFOrigin
+	}
+
+	if u.Host == r.Host {
+		return nil
+	}
+
+	if base, err := url.Parse(s.c.Site.BaseURL); err == nil && u.Scheme == base.Scheme && u.Host == base.Host {
+		return nil
+	}
+
+	return errCSRFOrigin
+}
+
+func (s *Server) csrfError(w http.ResponseWriter, r *http.Request, err error) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		s.serveErrorJSON(w, http.StatusForbidden, "forbidden", err.Error())
+		return
+	}
+
+	s.panelError(w, r, http.StatusForbidden, err)
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.hacdias.com/eagle/core"
+	"go.uber.org/zap"
+)
+
+func newCSRFTestServer() *Server {
+	return &Server{
+		c: &core.Config{
+			ServerConfig: core.ServerConfig{
+				TokensSecret: "secret",
+				Login:        core.Login{Username: "owner"},
+			},
+			Site: core.SiteConfig{BaseURL: "https://example.com"},
+		},
+		log: zap.NewNop().Sugar(),
+	}
+}
+
+// withTestSession logs in the requests as the owner, without the database.
+func withTestSession(s *Server, session *core.Token) func(http.Handler) http.Handler {
+	return withTestUser(s.configUser(), session)
+}
+
+func TestCSRFProtectedRoutes(t *testing.T) {
+	s := newCSRFTestServer()
+	session := &core.Token{ID: "session", Type: core.TokenTypeSession}
+
+	r := chi.NewRouter()
+	r.Use(withTestSession(s, session))
+	r.Group(s.panelRouter)
+
+	token := s.csrfToken(httptest.NewRequest(http.MethodGet, "/", nil).WithContext(
+		context.WithValue(context.Background(), sessionContextKey, session),
+	))
+	require.NotEmpty(t, token)
+
+	var routes []string
+	err := chi.Walk(r, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if method == http.MethodPost {
+			routes = append(routes, strings.TrimSuffix(route, "*"))
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Contains(t, routes, authAcceptPath)
+	require.Contains(t, routes, panelPath)
+	require.Contains(t, routes, panelUsersPath)
+
+	for _, route := range routes {
+		for name, tc := range map[string]struct {
+			form    url.Values
+			headers map[string]string
+		}{
+			"no token":     {form: url.Values{}},
+			"wrong token":  {form: url.Values{csrfFieldName: {"wrong"}}},
+			"wrong header": {headers: map[string]string{csrfHeaderName: "wrong"}},
+			"cross-origin": {
+				form:    url.Values{csrfFieldName: {token}},
+				headers: map[string]string{"Origin": "https://evil.example"},
+			},
+			"cross-site": {
+				form:    url.Values{csrfFieldName: {token}},
+				headers: map[string]string{"Sec-Fetch-Site": "cross-site"},
+			},
+			"null origin": {
+				form:    url.Values{csrfFieldName: {token}},
+				headers: map[string]string{"Origin": "null"},
+			},
+		} {
+			req := httptest.NewRequest(http.MethodPost, route, strings.NewReader(tc.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusForbidden, w.Code, "%s: %s", route, name)
+		}
+	}
+}
+
+func TestCSRFValidRequests(t *testing.T) {
+	s := newCSRFTestServer()
+	session := &core.Token{ID: "session", Type: core.TokenTypeSession}
+
+	r := chi.NewRouter()
+	r.Use(withTestSession(s, session))
+	r.Use(s.mustCSRF)
+	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	token := s.csrfToken(httptest.NewRequest(http.MethodGet, "/", nil).WithContext(
+		context.WithValue(context.Background(), sessionContextKey, session),
+	))
+
+	do := func(method string, body url.Values, headers map[string]string) int {
+		req := httptest.NewRequest(method, "https://example.com/", strings.NewReader(body.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Safe methods are not checked.
+	assert.Equal(t, http.StatusNoContent, do(http.MethodGet, nil, map[string]string{"Sec-Fetch-Site": "cross-site"}))
+
+	assert.Equal(t, http.StatusNoContent, do(http.MethodPost, url.Values{csrfFieldName: {token}}, nil))
+	assert.Equal(t, http.StatusNoContent, do(http.MethodPost, nil, map[string]string{csrfHeaderName: token}))
+	assert.Equal(t, http.StatusNoContent, do(http.MethodPost, url.Values{csrfFieldName: {token}}, map[string]string{
+		"Origin":         "https://example.com",
+		"Sec-Fetch-Site": "same-origin",
+	}))
+
+	// The token is bound to the session.
+	other := s.csrfToken(httptest.NewRequest(http.MethodGet, "/", nil).WithContext(
+		context.WithValue(context.Background(), sessionContextKey, &core.Token{ID: "other"}),
+	))
+	assert.NotEqual(t, token, other)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, url.Values{csrfFieldName: {other}}, nil))
+}
+
+func TestCSRFTemplateField(t *testing.T) {
+	s := newCSRFTestServer()
+	session := &core.Token{ID: "session", Type: core.TokenTypeSession}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), sessionContextKey, session))
+
+	w := httptest.NewRecorder()
+	s.panelTemplate(w, req, http.StatusOK, panelErrorTemplate, &errorPage{Title: "Error"})
+	assert.Contains(t, w.Body.String(), `<meta name='csrf-token' content='`+s.csrfToken(req)+`'>`)
+}
@@ -36,6 +36,7 @@ func (s *Server) getEntrySyndicationContext(e *core.Entry) (*SyndicationContext,
 			Alt:      p.Alt,
 			Width:    p.Width,
 			Height:   p.Height,
+			Exif:     p.Exif,
 		}
 
 		if p.URL == thumbnailStr {
@@ -66,6 +67,50 @@ func (s *Server) getEntrySyndicationContext(e *core.Entry) (*SyndicationContext,
 		ctx.Thumbnail = ctx.Photos[0]
 	}
 
+	for _, v := range e.Videos {
+		data, mimetype, err := s.media.GetMedia(v.URL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get video: %w", err)
+		}
+
+		video := &Video{
+			Data:     data,
+			Title:    v.Title,
+			MimeType: mimetype,
+			Width:    v.Width,
+			Height:   v.Height,
+			Duration: v.Duration,
+		}
+
+		if v.Poster != "" {
+			data, mimetype, err := s.media.GetImage(v.Poster)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get video poster: %w", err)
+			}
+
+			video.Poster = &Photo{
+				Data:     data,
+				MimeType: mimetype,
+			}
+		}
+
+		ctx.Videos = append(ctx.Videos, video)
+	}
+
+	for _, a := range e.Audio {
+		data, mimetype, err := s.media.GetMedia(a.URL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get audio: %w", err)
+		}
+
+		ctx.Audio = append(ctx.Audio, &Audio{
+			Data:     data,
+			Title:    a.Title,
+			MimeType: mimetype,
+			Duration: a.Duration,
+		})
+	}
+
 	return ctx, nil
 }
 
@@ -117,22 +162,60 @@ func (s *Server) syndicate(e *core.Entry, syndicators []string, status string) e
 }
 
 func (s *Server) saveEntryWithHooks(e *core.Entry, options postSaveEntryOptions) error {
-	err := s.preSaveEntry(e)
+	s.entriesMu.Lock()
+	err := s.saveEntryLocked(e, options)
+	s.entriesMu.Unlock()
 	if err != nil {
 		return err
 	}
 
-	err = s.core.SaveEntry(e)
+	return s.buildSavedEntry(e, options)
+}
+
+// updateEntryWithHooks reloads the entry and updates it, while no other entry
+// is saved, such that no edits are lost in the meantime. The entry is only
+// saved, with the hooks, if update returns true. It returns whether it was.
+func (s *Server) updateEntryWithHooks(id string, options postSaveEntryOptions, update func(e *core.Entry) bool) (bool, error) {
+	s.entriesMu.Lock()
+	e, err := s.core.GetEntry(id)
+	if err == nil && update(e) {
+		err = s.saveEntryLocked(e, options)
+	} else {
+		e = nil
+	}
+	s.entriesMu.Unlock()
+	if err != nil || e == nil {
+		return false, err
+	}
+
+	return true, s.buildSavedEntry(e, options)
+}
+
+// saveEntryLocked runs the pre save hooks and saves the entry. It must be
+// called with entriesMu locked.
+func (s *Server) saveEntryLocked(e *core.Entry, options postSaveEntryOptions) error {
+	err := s.preSaveEntry(e)
 	if err != nil {
 		return err
 	}
 
-	err = s.core.Build(e.Deleted())
+	return s.core.SaveEntryAs(options.author, e)
+}
+
+// buildSavedEntry builds the website and runs the post save hooks of the
+// saved entry.
+func (s *Server) buildSavedEntry(e *core.Entry, options postSaveEntryOptions) error {
+	err := s.core.Build(e.Deleted())
 	if err != nil {
 		return err
 	}
 
-	go s.postSaveEntry(e, options)
+	// The hooks run on a copy, such that the caller can still read the entry
+	// while they update it.
+	saved := *e
+	s.postSave.Go(func() {
+		s.postSaveEntry(&saved, options)
+	})
 	return nil
 }
 
@@ -155,6 +238,8 @@ func (s *Server) preSaveEntry(e *core.Entry) error {
 }
 
 type postSaveEntryOptions struct {
+	// author is the author of the commit that saves the entry.
+	author            *core.CommitAuthor
 	isNew             bool
 	skipBuild         bool
 	syndicators       []string
@@ -185,17 +270,7 @@ func (s *Server) postSaveEntry(e *core.Entry, options postSaveEntryOptions) {
 	}
 
 	// Search indexing
-	if s.meilisearch != nil {
-		var err error
-		if e.Deleted() {
-			err = s.meilisearch.Remove(e.ID)
-		} else {
-			err = s.meilisearch.Add(e)
-		}
-		if err != nil {
-			s.log.Errorw("meilisearch sync failed", "err", err)
-		}
-	}
+	s.indexEntry(e)
 
 	// Rebuild
 	if !options.skipBuild && !e.Deleted() && !e.Draft {
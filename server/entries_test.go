@@ -0,0 +1,46 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.hacdias.com/eagle/core"
+	"go.uber.org/zap"
+)
+
+type recordingSearchIndex struct {
+	core.SearchIndex
+	added chan string
+}
+
+func (r *recordingSearchIndex) Add(ee ...*core.Entry) error {
+	for _, e := range ee {
+		r.added <- e.ID
+	}
+	return nil
+}
+
+func TestIndexEntryWaitsForIndexAll(t *testing.T) {
+	index := &recordingSearchIndex{added: make(chan string, 1)}
+	s := &Server{search: index, log: zap.NewNop().Sugar()}
+
+	// Simulate an ongoing rebuild of the index.
+	s.searchMu.Lock()
+	go s.indexEntry(&core.Entry{ID: "/posts/hello/"})
+
+	select {
+	case <-index.added:
+		t.Fatal("entry indexed during the rebuild")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.searchMu.Unlock()
+
+	select {
+	case id := <-index.added:
+		assert.Equal(t, "/posts/hello/", id)
+	case <-time.After(time.Second):
+		t.Fatal("entry not indexed after the rebuild")
+	}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.hacdias.com/eagle/core"
+)
+
+// panelContentSecurityPolicy is the policy of the panel pages. Scripts must
+// either be served by Eagle or carry the nonce of the response. Inline styles
+// are allowed, as the templates use them, and images may only come from Eagle
+// and the media storage.
+const panelContentSecurityPolicy = "default-src 'self'; " +
+	"script-src 'self' 'nonce-%s'; " +
+	"style-src 'self' 'unsafe-inline'; " +
+	"img-src %s; " +
+	"connect-src 'self'; " +
+	"object-src 'none'; " +
+	"base-uri 'none'; " +
+	"frame-ancestors 'none'"
+
+// panelPermissionsPolicy only allows the geolocation, used for the location of
+// new entries.
+const panelPermissionsPolicy = "camera=(), microphone=(), geolocation=(self)"
+
+// withSecurityHeaders sets the configured security headers, followed by the
+// overrides of the path of the request. All of them are then replaced on the
+// panel pages by setPanelHeaders.
+func (s *Server) withSecurityHeaders(next http.Handler) http.Handler {
+	h := s.c.Headers
+	hsts := hstsHeader(h.HSTS)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		setHeader(header, "Content-Security-Policy", h.ContentSecurityPolicy)
+		setHeader(header, "Referrer-Policy", h.ReferrerPolicy)
+		setHeader(header, "X-Frame-Options", h.FrameOptions)
+		setHeader(header, "X-Content-Type-Options", "nosniff")
+		setHeader(header, "Permissions-Policy", h.PermissionsPolicy)
+		setHeader(header, "Cross-Origin-Opener-Policy", h.CrossOriginOpenerPolicy)
+		setHeader(header, "Cross-Origin-Resource-Policy", h.CrossOriginResourcePolicy)
+		setHeader(header, "Strict-Transport-Security", hsts)
+
+		for _, o := range h.Overrides {
+			if strings.HasPrefix(r.URL.Path, o.Path) {
+				for key, value := range o.Headers {
+					setHeader(header, key, value)
+				}
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setPanelHeaders sets the strict headers of the panel pages, replacing all
+// the ones set by withSecurityHeaders, including the overrides, such that no
+// configuration can weaken them. It returns the nonce of the scripts.
+func (s *Server) setPanelHeaders(w http.ResponseWriter) string {
+	nonce := rand.Text()
+
+	header := w.Header()
+	header.Set("Content-Security-Policy", fmt.Sprintf(panelContentSecurityPolicy, nonce, s.panelImageSources()))
+	header.Set("Referrer-Policy", "same-origin")
+	header.Set("X-Frame-Options", "DENY")
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Permissions-Policy", panelPermissionsPolicy)
+	header.Set("Cross-Origin-Opener-Policy", "same-origin")
+	header.Set("Cross-Origin-Resource-Policy", "same-origin")
+	setHeader(header, "Strict-Transport-Security", hstsHeader(s.c.Headers.HSTS))
+	return nonce
+}
+
+// panelImageSources returns the sources of the images of the panel: Eagle, data
+// and blob URLs for the previews of the uploads, and the media storage.
+func (s *Server) panelImageSources() string {
+	sources := "'self' data: blob:"
+	if s.media == nil {
+		return sources
+	}
+
+	u, err := url.Parse(s.media.BaseURL())
+	if err != nil || u.Host == "" {
+		return sources
+	}
+
+	return sources + " " + u.Scheme + "://" + u.Host
+}
+
+func setHeader(header http.Header, key, value string) {
+	if value == "" {
+		header.Del(key)
+	} else {
+		header.Set(key, value)
+	}
+}
+
+func hstsHeader(hsts core.HSTS) string {
+	if hsts.MaxAge <= 0 {
+		return ""
+	}
+
+	value := fmt.Sprintf("max-age=%d", int(hsts.MaxAge/time.Second))
+	if hsts.IncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+	if hsts.Preload {
+		value += "; preload"
+	}
+	return value
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.hacdias.com/eagle/core"
+	"go.hacdias.com/eagle/services/media"
+	"go.uber.org/zap"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	s := &Server{
+		c: &core.Config{
+			ServerConfig: core.ServerConfig{
+				Headers: core.Headers{
+					ContentSecurityPolicy: "default-src 'self'",
+					ReferrerPolicy:        "no-referrer",
+					FrameOptions:          "SAMEORIGIN",
+					PermissionsPolicy:     "camera=()",
+					HSTS: core.HSTS{
+						MaxAge:            time.Hour * 24 * 365,
+						IncludeSubdomains: true,
+					},
+					Overrides: []core.HeadersOverride{
+						{Path: "/.well-known/", Headers: map[string]string{
+							"x-frame-options":              "",
+							"cross-origin-resource-policy": "cross-origin",
+						}},
+						{Path: "/panel", Headers: map[string]string{
+							"x-frame-options": "SAMEORIGIN",
+						}},
+					},
+				},
+			},
+		},
+		log: zap.NewNop().Sugar(),
+		media: media.NewMedia(&core.Media{Storage: core.MediaStorage{
+			Bunny: &core.Bunny{Base: "https://cdn.example.com/media"},
+		}}, nil),
+	}
+
+	handler := s.withSecurityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/panel" {
+			s.panelTemplate(w, r, http.StatusOK, panelErrorTemplate, &errorPage{Title: "Error"})
+		}
+	}))
+
+	do := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := do("/")
+	assert.Equal(t, "default-src 'self'", w.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, "no-referrer", w.Header().Get("Referrer-Policy"))
+	assert.Equal(t, "SAMEORIGIN", w.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "camera=()", w.Header().Get("Permissions-Policy"))
+	assert.Equal(t, "max-age=31536000; includeSubDomains", w.Header().Get("Strict-Transport-Security"))
+	assert.Empty(t, w.Header().Values("Cross-Origin-Opener-Policy"))
+	assert.Empty(t, w.Header().Values("Cross-Origin-Resource-Policy"))
+
+	w = do("/.well-known/webfinger")
+	assert.Empty(t, w.Header().Values("X-Frame-Options"))
+	assert.Equal(t, "cross-origin", w.Header().Get("Cross-Origin-Resource-Policy"))
+	assert.Equal(t, "default-src 'self'", w.Header().Get("Content-Security-Policy"))
+
+	// The panel replaces the policy by its own, with a new nonce each time.
+	w = do("/panel")
+	csp := w.Header().Get("Content-Security-Policy")
+	assert.Contains(t, csp, "script-src 'self' 'nonce-")
+	assert.Contains(t, csp, "frame-ancestors 'none'")
+	assert.Contains(t, csp, "img-src 'self' data: blob: https://cdn.example.com; ")
+	assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+	assert.NotEqual(t, csp, do("/panel").Header().Get("Content-Security-Policy"))
+}
+
+func TestPanelTemplatesScripts(t *testing.T) {
+	scripts := regexp.MustCompile(`<script[^>]*>`)
+	handlers := regexp.MustCompile(`\son[a-z]+=`)
+
+	files, err := fs.Glob(panelTemplatesFS, "templates/*.html")
+	require.NoError(t, err)
+
+	// Inline scripts must carry the nonce, and inline event handlers are not
+	// allowed by the policy of the panel.
+	for _, file := range files {
+		data, err := fs.ReadFile(panelTemplatesFS, file)
+		require.NoError(t, err)
+
+		for _, tag := range scripts.FindAllString(string(data), -1) {
+			if !strings.Contains(tag, "src=") {
+				assert.Equal(t, "<script nonce='{{ cspNonce }}'>", tag, file)
+			}
+		}
+
+		assert.False(t, handlers.Match(data), file)
+	}
+}
+
+func TestPanelHeadersIgnoreOverrides(t *testing.T) {
+	s := &Server{
+		c: &core.Config{
+			ServerConfig: core.ServerConfig{
+				Headers: core.Headers{
+					ReferrerPolicy:          "no-referrer",
+					CrossOriginOpenerPolicy: "same-origin",
+					HSTS:                    core.HSTS{MaxAge: time.Hour},
+					Overrides: []core.HeadersOverride{
+						{Path: "/", Headers: map[string]string{
+							"x-content-type-options":     "",
+							"referrer-policy":            "unsafe-url",
+							"cross-origin-opener-policy": "unsafe-none",
+							"strict-transport-security":  "",
+						}},
+					},
+				},
+			},
+		},
+		log: zap.NewNop().Sugar(),
+	}
+
+	handler := s.withSecurityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.panelTemplate(w, r, http.StatusOK, panelErrorTemplate, &errorPage{Title: "Error"})
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, panelPath, nil))
+
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "same-origin", w.Header().Get("Referrer-Policy"))
+	assert.Equal(t, "same-origin", w.Header().Get("Cross-Origin-Opener-Policy"))
+	assert.Equal(t, "max-age=3600", w.Header().Get("Strict-Transport-Security"))
+}
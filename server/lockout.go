@@ -0,0 +1,118 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/maypok86/otter/v2"
+)
+
+const (
+	// loginIPFailures is the number of failed login attempts from an IP address
+	// after which it is locked out.
+	loginIPFailures = 5
+	loginIPWindow   = time.Hour * 24
+	// loginGlobalFailures is the number of failed login attempts, from all IP
+	// addresses, after which the password and TOTP login is locked out for
+	// everyone, such that distributed attacks are also slowed down.
+	loginGlobalFailures = 50
+	loginGlobalWindow   = time.Hour
+	// loginLockoutBase is the duration of the first lockout, which doubles with
+	// each subsequent failure in the same window, up to loginLockoutMax.
+	loginLockoutBase = time.Minute
+	loginLockoutMax  = time.Hour * 24
+	// loginMaxIPs is the maximum number of IP addresses whose failures are
+	// tracked at once.
+	loginMaxIPs = 100_000
+)
+
+// loginFailures counts the failed attempts in a window of time, which starts
+// with the first failure.
+type loginFailures struct {
+	count       int
+	first       time.Time
+	lockedUntil time.Time
+}
+
+// fail records a failed attempt. It returns the lockout duration if the failure
+// triggered one.
+func (f *loginFailures) fail(now time.Time, threshold int, window time.Duration) time.Duration {
+	if now.Sub(f.first) > window {
+		f.count = 0
+		f.first = now
+	}
+
+	f.count++
+
+	if f.count < threshold {
+		return 0
+	}
+
+	lockout := loginLockoutBase << min(f.count-threshold, 20)
+	lockout = min(lockout, loginLockoutMax)
+	f.lockedUntil = now.Add(lockout)
+	return lockout
+}
+
+// loginLimiter protects the password login against brute-force attacks by
+// locking out, with exponential backoff, the IP addresses with repeated failed
+// attempts, as well as everyone once there are too many failed attempts in
+// total. Passkeys are not affected, such that the owner can always log in.
+type loginLimiter struct {
+	mu  sync.Mutex
+	now func() time.Time
+	// ips are written on every failure, and expire once both the window and
+	// the longest lockout are over.
+	ips    *otter.Cache[string, *loginFailures]
+	global loginFailures
+}
+
+func newLoginLimiter() *loginLimiter {
+	return &loginLimiter{
+		now: time.Now,
+		ips: otter.Must(&otter.Options[string, *loginFailures]{
+			MaximumSize:      loginMaxIPs,
+			ExpiryCalculator: otter.ExpiryWriting[string, *loginFailures](max(loginIPWindow, loginLockoutMax)),
+		}),
+	}
+}
+
+// lockedOut returns for how long the IP address is still locked out, or zero.
+func (l *loginLimiter) lockedOut(ip string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	until := l.global.lockedUntil
+	if f, ok := l.ips.GetIfPresent(ip); ok && f.lockedUntil.After(until) {
+		until = f.lockedUntil
+	}
+
+	return max(until.Sub(l.now()), 0)
+}
+
+// fail records a failed attempt from the IP address. It returns the lockout
+// durations if the failure triggered a lockout of the IP address, or a global
+// one, respectively.
+func (l *loginLimiter) fail(ip string) (time.Duration, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, ok := l.ips.GetIfPresent(ip)
+	if !ok {
+		f = &loginFailures{}
+	}
+
+	now := l.now()
+	ipLockout := f.fail(now, loginIPFailures, loginIPWindow)
+	l.ips.Set(ip, f)
+	return ipLockout, l.global.fail(now, loginGlobalFailures, loginGlobalWindow)
+}
+
+// succeed resets the failed attempts of the IP address. The global ones are
+// kept, as the attack may still be ongoing from other addresses.
+func (l *loginLimiter) succeed(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.ips.Invalidate(ip)
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginLimiter(t *testing.T) {
+	now := time.Now()
+	l := newLoginLimiter()
+	l.now = func() time.Time { return now }
+
+	for range loginIPFailures - 1 {
+		ipLockout, _ := l.fail("1.1.1.1")
+		assert.Zero(t, ipLockout)
+	}
+	assert.Zero(t, l.lockedOut("1.1.1.1"))
+
+	ipLockout, globalLockout := l.fail("1.1.1.1")
+	assert.Equal(t, loginLockoutBase, ipLockout)
+	assert.Zero(t, globalLockout)
+	assert.Equal(t, loginLockoutBase, l.lockedOut("1.1.1.1"))
+	assert.Zero(t, l.lockedOut("2.2.2.2"))
+
+	// The lockout doubles with each subsequent failure.
+	now = now.Add(loginLockoutBase)
+	assert.Zero(t, l.lockedOut("1.1.1.1"))
+	ipLockout, _ = l.fail("1.1.1.1")
+	assert.Equal(t, loginLockoutBase*2, ipLockout)
+
+	// A successful login resets the failures of the IP address.
+	now = now.Add(loginLockoutBase * 2)
+	l.succeed("1.1.1.1")
+	ipLockout, _ = l.fail("1.1.1.1")
+	assert.Zero(t, ipLockout)
+
+	// The failures are forgotten after the window.
+	now = now.Add(loginIPWindow + time.Second)
+	for range loginIPFailures - 1 {
+		ipLockout, _ = l.fail("1.1.1.1")
+		assert.Zero(t, ipLockout)
+	}
+}
+
+func TestLoginLimiterGlobal(t *testing.T) {
+	now := time.Now()
+	l := newLoginLimiter()
+	l.now = func() time.Time { return now }
+
+	// A distributed attack never locks out any single IP address, but locks
+	// out everyone once there are too many failures in total.
+	for i := range loginGlobalFailures - 1 {
+		ipLockout, globalLockout := l.fail(string(rune('a' + i)))
+		assert.Zero(t, ipLockout)
+		assert.Zero(t, globalLockout)
+	}
+	assert.Zero(t, l.lockedOut("3.3.3.3"))
+
+	_, globalLockout := l.fail("b")
+	assert.Equal(t, loginLockoutBase, globalLockout)
+	assert.Equal(t, loginLockoutBase, l.lockedOut("3.3.3.3"))
+
+	_, globalLockout = l.fail("c")
+	assert.Equal(t, loginLockoutBase*2, globalLockout)
+
+	// A successful login does not reset the global failures.
+	l.succeed("b")
+	assert.Equal(t, loginLockoutBase*2, l.lockedOut("b"))
+
+	// The global failures are forgotten after the window.
+	now = now.Add(loginGlobalWindow + loginLockoutBase*2)
+	assert.Zero(t, l.lockedOut("3.3.3.3"))
+	_, globalLockout = l.fail("d")
+	assert.Zero(t, globalLockout)
+}
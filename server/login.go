@@ -2,11 +2,17 @@ package server
 
 import (
 	"context"
+	"crypto/rand"
+	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/google/uuid"
+	"github.com/pquerna/otp/totp"
 	"go.hacdias.com/eagle/core"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -14,14 +20,65 @@ import (
 const (
 	sessionCookieName             = "session"
 	loggedInContextKey contextKey = "logged-in"
+	sessionContextKey  contextKey = "session"
+
+	// sessionExpiry is for how long sessions are valid since they were last
+	// seen. Sessions expire after sessionMaxExpiry regardless.
+	sessionExpiry    = time.Hour * 24 * 7
+	sessionMaxExpiry = time.Hour * 24 * 90
+	// sessionSeenInterval is how often the last seen details of a session are
+	// updated, in order to avoid writing to the database on every request.
+	sessionSeenInterval = time.Minute
 
 	loginPath  = "/panel/login"
 	logoutPath = "/panel/logout"
+
+	totpCookieName    = "eagle-totp"
+	totpSessionExpiry = time.Minute * 5
 )
 
 type loginPage struct {
-	Title string
-	Error string
+	Title    string
+	Error    string
+	Password bool
+	Passkeys bool
+	TOTP     bool
+}
+
+func (s *Server) serveLogin(w http.ResponseWriter, r *http.Request, code int, loginErr string) {
+	passkeys, err := s.core.DB().GetPasskeys(r.Context())
+	if err != nil {
+		s.log.Errorw("failed to get passkeys", "err", err)
+	}
+
+	s.panelTemplate(w, r, code, panelLoginTemplate, &loginPage{
+		Title:    "Login",
+		Error:    loginErr,
+		Password: s.passwordLoginEnabled(r.Context()),
+		Passkeys: len(passkeys) > 0,
+	})
+}
+
+// passwordLoginEnabled returns whether any user can login with a password.
+// Users from the database always have one.
+func (s *Server) passwordLoginEnabled(ctx context.Context) bool {
+	if s.c.Login.Password != "" {
+		return true
+	}
+
+	users, err := s.core.DB().GetUsers(ctx)
+	if err != nil {
+		s.log.Errorw("failed to get users", "err", err)
+	}
+	return len(users) > 0
+}
+
+func (s *Server) serveLoginTOTP(w http.ResponseWriter, r *http.Request, code int, loginErr string) {
+	s.panelTemplate(w, r, code, panelLoginTemplate, &loginPage{
+		Title: "Login",
+		Error: loginErr,
+		TOTP:  true,
+	})
 }
 
 func (s *Server) loginGet(w http.ResponseWriter, r *http.Request) {
@@ -30,88 +87,246 @@ func (s *Server) loginGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.panelTemplate(w, r, http.StatusOK, panelLoginTemplate, &loginPage{
-		Title: "Login",
-	})
+	s.serveLogin(w, r, http.StatusOK, "")
 }
 
 func (s *Server) loginPost(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
-		s.panelTemplate(w, r, http.StatusBadRequest, panelLoginTemplate, &loginPage{
-			Title: "Login",
-			Error: err.Error(),
-		})
+		s.serveLogin(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !s.passwordLoginEnabled(r.Context()) {
+		s.serveLogin(w, r, http.StatusForbidden, "Password login is disabled.")
+		return
+	}
+
+	if lockout := s.loginLimiter.lockedOut(clientIP(r)); lockout > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(lockout.Seconds())+1))
+		s.serveLogin(w, r, http.StatusTooManyRequests, fmt.Sprintf("Too many failed attempts, try again in %s.", lockout.Round(time.Second)))
+		return
+	}
+
+	if r.Form.Has("code") {
+		s.loginTOTPPost(w, r)
 		return
 	}
 
 	username := r.FormValue("username")
 	password := r.FormValue("password")
-	correctPassword := bcrypt.CompareHashAndPassword([]byte(s.c.Login.Password), []byte(password)) == nil
 
-	if username != s.c.Login.Username || !correctPassword {
-		s.panelTemplate(w, r, http.StatusUnauthorized, panelLoginTemplate, &loginPage{
-			Title: "Login",
-			Error: "Invalid credentials.",
+	var user *core.User
+	if username != "" {
+		user, _ = s.getUserByUsername(r.Context(), username)
+	}
+
+	if user == nil || user.Password == "" || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		s.loginFailed(r)
+		s.serveLogin(w, r, http.StatusUnauthorized, "Invalid credentials.")
+		return
+	}
+
+	if user.TOTP != "" {
+		// The password is correct, but the second factor is still missing.
+		id := rand.Text()
+		s.totpSessions.Set(id, user.Username)
+		http.SetCookie(w, &http.Cookie{
+			Name:     totpCookieName,
+			Value:    id,
+			MaxAge:   int(totpSessionExpiry / time.Second),
+			Secure:   isSecure(r),
+			HttpOnly: true,
+			Path:     loginPath,
+			SameSite: http.SameSiteStrictMode,
 		})
+
+		s.serveLoginTOTP(w, r, http.StatusOK, "")
 		return
 	}
 
-	expiration := time.Now().Add(time.Hour * 24 * 7)
+	s.loginSucceeded(w, r, user)
+}
 
+// loginTOTPPost verifies the one-time password of a login whose password has
+// been verified already.
+func (s *Server) loginTOTPPost(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(totpCookieName)
+	if err != nil {
+		s.serveLogin(w, r, http.StatusBadRequest, "Login expired, please try again.")
+		return
+	}
+
+	username, ok := s.totpSessions.GetIfPresent(cookie.Value)
+	if !ok {
+		s.serveLogin(w, r, http.StatusBadRequest, "Login expired, please try again.")
+		return
+	}
+
+	user, err := s.getUserByUsername(r.Context(), username)
+	if err != nil {
+		s.serveLogin(w, r, http.StatusBadRequest, "Login expired, please try again.")
+		return
+	}
+
+	code := strings.TrimSpace(r.FormValue("code"))
+
+	// Each code can only be used once per user, in order to prevent replays.
+	_, used := s.totpUsed.GetIfPresent(user.Username + ":" + code)
+	if used || !totp.Validate(code, user.TOTP) {
+		s.loginFailed(r)
+		s.serveLoginTOTP(w, r, http.StatusUnauthorized, "Invalid code.")
+		return
+	}
+
+	s.totpUsed.Set(user.Username+":"+code, true)
+	s.totpSessions.Invalidate(cookie.Value)
+	http.SetCookie(w, &http.Cookie{
+		Name:     totpCookieName,
+		MaxAge:   -1,
+		Secure:   isSecure(r),
+		HttpOnly: true,
+		Path:     loginPath,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	s.loginSucceeded(w, r, user)
+}
+
+func (s *Server) loginSucceeded(w http.ResponseWriter, r *http.Request, user *core.User) {
+	s.loginLimiter.succeed(clientIP(r))
+
+	err := s.createSession(w, r, user)
+	if err != nil {
+		s.serveLogin(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, loginRedirect(r), http.StatusSeeOther)
+}
+
+func (s *Server) loginFailed(r *http.Request) {
+	ip := clientIP(r)
+	ipLockout, globalLockout := s.loginLimiter.fail(ip)
+
+	if ipLockout > 0 {
+		s.log.Warnw("login locked out", "ip", ip, "duration", ipLockout)
+		s.n.Notify(fmt.Sprintf("🔐 #login locked out for %s for %s after repeated failed attempts", ip, ipLockout))
+	}
+
+	if globalLockout > 0 {
+		s.log.Warnw("password login locked out", "duration", globalLockout)
+		s.n.Notify(fmt.Sprintf("🔐 #login password and TOTP login locked out for everyone for %s after too many failed attempts, passkeys still work", globalLockout))
+	}
+}
+
+// createSession creates a new session, and sets its cookie, once the user has
+// been authenticated.
+func (s *Server) createSession(w http.ResponseWriter, r *http.Request, user *core.User) error {
+	now := time.Now()
+	secret := uuid.New().String()
 	session := &core.Token{
-		ID:      uuid.New().String(),
-		Type:    core.TokenTypeSession,
-		Expiry:  expiration,
-		Created: time.Now(),
+		ID:        core.HashToken(secret),
+		Type:      core.TokenTypeSession,
+		Username:  user.Username,
+		Expiry:    now.Add(sessionExpiry),
+		Created:   now,
+		UserAgent: r.UserAgent(),
+		IP:        clientIP(r),
+		LastSeen:  now,
 	}
 	if err := s.core.DB().CreateToken(r.Context(), session); err != nil {
-		s.panelTemplate(w, r, http.StatusInternalServerError, panelLoginTemplate, &loginPage{
-			Title: "Login",
-			Error: err.Error(),
-		})
+		return err
+	}
+
+	setSessionCookie(w, r, secret, session.Expiry)
+	return nil
+}
+
+// refreshSession records the device details of the session, and extends its
+// expiry, as it is being used.
+func (s *Server) refreshSession(w http.ResponseWriter, r *http.Request, secret string, session *core.Token) {
+	now := time.Now()
+	if now.Sub(session.LastSeen) < sessionSeenInterval &&
+		session.UserAgent == r.UserAgent() &&
+		session.IP == clientIP(r) {
 		return
 	}
 
+	session.UserAgent = r.UserAgent()
+	session.IP = clientIP(r)
+	session.LastSeen = now
+	session.Expiry = now.Add(sessionExpiry)
+	if maxExpiry := session.Created.Add(sessionMaxExpiry); session.Expiry.After(maxExpiry) {
+		session.Expiry = maxExpiry
+	}
+
+	if err := s.core.DB().UpdateToken(r.Context(), session); err != nil {
+		s.log.Errorw("failed to update session", "err", err)
+		return
+	}
+
+	setSessionCookie(w, r, secret, session.Expiry)
+}
+
+func setSessionCookie(w http.ResponseWriter, r *http.Request, secret string, expiry time.Time) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     sessionCookieName,
-		Value:    session.ID,
-		Expires:  expiration,
-		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		Value:    secret,
+		Expires:  expiry,
+		Secure:   isSecure(r),
 		HttpOnly: true,
 		Path:     "/",
 		SameSite: http.SameSiteLaxMode,
 	})
+}
 
+// loginRedirect returns where to redirect to after logging in or out. Only
+// paths on this website are allowed, such that the redirect can neither run
+// scripts nor lead to another website.
+func loginRedirect(r *http.Request) string {
 	redirect := r.URL.Query().Get("redirect")
-	if redirect == "" {
-		redirect = "/"
+	if !isLocalPath(redirect) {
+		return "/"
+	}
+	return redirect
+}
+
+// isLocalPath returns whether the URL is an absolute path without a scheme
+// or a host. Browsers treat "//" and "/\" as the start of a host, and ignore
+// control characters such as tabs in URLs.
+func isLocalPath(redirect string) bool {
+	if !strings.HasPrefix(redirect, "/") ||
+		strings.HasPrefix(redirect, "//") ||
+		strings.ContainsRune(redirect, '\\') ||
+		strings.ContainsFunc(redirect, unicode.IsControl) {
+		return false
 	}
 
-	http.Redirect(w, r, redirect, http.StatusSeeOther)
+	u, err := url.Parse(redirect)
+	return err == nil && u.Scheme == "" && u.Host == ""
+}
+
+func isSecure(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
 }
 
 func (s *Server) logoutGet(w http.ResponseWriter, r *http.Request) {
 	cookie, err := r.Cookie(sessionCookieName)
 	if err == nil && cookie.Value != "" {
-		_ = s.core.DB().DeleteToken(r.Context(), cookie.Value)
+		_ = s.core.DB().DeleteToken(r.Context(), core.HashToken(cookie.Value))
 	}
 
 	http.SetCookie(w, &http.Cookie{
 		Name:     sessionCookieName,
 		Value:    "",
 		MaxAge:   -1,
-		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		Secure:   isSecure(r),
 		Path:     "/",
 		HttpOnly: true,
 	})
 
-	redirect := r.URL.Query().Get("redirect")
-	if redirect == "" {
-		redirect = "/"
-	}
-
-	http.Redirect(w, r, redirect, http.StatusSeeOther)
+	http.Redirect(w, r, loginRedirect(r), http.StatusSeeOther)
 }
 
 func (s *Server) withLoggedIn(next http.Handler) http.Handler {
@@ -122,19 +337,31 @@ func (s *Server) withLoggedIn(next http.Handler) http.Handler {
 			return
 		}
 
-		session, err := s.core.DB().GetToken(r.Context(), cookie.Value, core.TokenTypeSession)
+		session, err := s.core.DB().GetToken(r.Context(), core.HashToken(cookie.Value), core.TokenTypeSession)
 		if err != nil {
 			next.ServeHTTP(w, r)
 			return
 		}
 
 		if time.Now().After(session.Expiry) {
-			_ = s.core.DB().DeleteToken(r.Context(), cookie.Value)
+			_ = s.core.DB().DeleteToken(r.Context(), session.ID)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Sessions of deleted users are deleted as well, but role changes
+		// apply immediately.
+		user, err := s.getUserByUsername(r.Context(), session.Username)
+		if err != nil {
 			next.ServeHTTP(w, r)
 			return
 		}
 
+		s.refreshSession(w, r, cookie.Value, session)
+
 		ctx := context.WithValue(r.Context(), loggedInContextKey, true)
+		ctx = context.WithValue(ctx, sessionContextKey, session)
+		ctx = context.WithValue(ctx, userContextKey, user)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -158,3 +385,9 @@ func (s *Server) isLoggedIn(r *http.Request) bool {
 
 	return false
 }
+
+// getSession returns the session of the logged in user, if any.
+func (s *Server) getSession(r *http.Request) *core.Token {
+	session, _ := r.Context().Value(sessionContextKey).(*core.Token)
+	return session
+}
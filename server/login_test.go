@@ -0,0 +1,28 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginRedirect(t *testing.T) {
+	for redirect, expected := range map[string]string{
+		"":                          "/",
+		"/panel":                    "/panel",
+		"/auth?client_id=x&state=y": "/auth?client_id=x&state=y",
+		"javascript:alert(1)":       "/",
+		"https://evil.example/":     "/",
+		"//evil.example/":           "/",
+		"/\\evil.example/":          "/",
+		"/\t/evil.example/":         "/",
+		"\\/evil.example/":          "/",
+		"panel":                     "/",
+	} {
+		r := httptest.NewRequest(http.MethodGet, loginPath+"?redirect="+url.QueryEscape(redirect), nil)
+		assert.Equal(t, expected, loginRedirect(r), redirect)
+	}
+}
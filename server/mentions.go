@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/samber/lo"
+	"go.hacdias.com/eagle/core"
+)
+
+// moderateMention applies the moderation rules to a new mention.
+func (s *Server) moderateMention(ctx context.Context, m *core.Mention) core.MentionAction {
+	rules, err := s.core.DB().GetMentionRules(ctx)
+	if err != nil {
+		s.log.Errorw("failed to get mention rules", "err", err)
+		return core.MentionPending
+	}
+
+	approved := false
+	if author := m.VerifiedAuthorURL(); author != "" {
+		approved, err = s.core.DB().IsApprovedAuthor(ctx, core.NormalizeAuthorURL(author))
+		if err != nil {
+			s.log.Errorw("failed to check approved author", "err", err)
+		}
+	}
+
+	return rules.Moderate(m, approved)
+}
+
+// receiveMention publishes the mention right away if it was approved by the
+// moderation rules, or stores it to wait for approval otherwise.
+func (s *Server) receiveMention(ctx context.Context, e *core.Entry, m *core.Mention, action core.MentionAction) error {
+	if action != core.MentionApprove {
+		err := s.core.DB().CreateMention(ctx, m)
+		if err != nil {
+			return err
+		}
+
+		if source := lo.Ternary(m.Source != "", m.Source, m.URL); source != "" {
+			s.n.Notify(fmt.Sprintf("💬 #mention pending approval for %q: %q", e.Permalink, source))
+		} else {
+			s.n.Notify(fmt.Sprintf("💬 #mention pending approval for %q", e.Permalink))
+		}
+		return nil
+	}
+
+	err := s.publishMention(ctx, m)
+	if err != nil {
+		return err
+	}
+
+	go s.mentionsPublished([]*core.Mention{m})
+	return nil
+}
+
+// publishMention adds the mention to its entry, unless it is private. The
+// website must be built afterwards with [Server.mentionsPublished].
+func (s *Server) publishMention(ctx context.Context, m *core.Mention) error {
+	if !m.Private {
+		if err := s.core.AddOrUpdateWebmention(m.EntryID, m, ""); err != nil {
+			return fmt.Errorf("error adding or updating webmention: %w", err)
+		}
+	}
+
+	s.mentionApproved(ctx, m)
+	return nil
+}
+
+// mentionsPublished builds the website with the published mentions. Then,
+// the webmentions of the entries that received new replies are sent again,
+// such that the replies propagate to the posts they reply to (Salmention).
+func (s *Server) mentionsPublished(mm []*core.Mention) {
+	mm = lo.Filter(mm, func(m *core.Mention, _ int) bool { return !m.Private })
+	if len(mm) == 0 {
+		return
+	}
+
+	s.build(false)
+
+	ids := lo.Uniq(lo.FilterMap(mm, func(m *core.Mention, _ int) (string, bool) {
+		return m.EntryID, !m.IsInteraction()
+	}))
+
+	for _, id := range ids {
+		e, err := s.core.GetEntry(id)
+		if err != nil {
+			s.log.Errorw("failed to get entry for salmention", "id", id, "err", err)
+			continue
+		}
+
+		err = s.core.SendWebmentions(e)
+		if err != nil {
+			s.log.Errorw("failed to send salmentions", "id", id, "err", err)
+		}
+	}
+}
@@ -2,12 +2,14 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
@@ -16,9 +18,11 @@ import (
 	"unicode/utf8"
 
 	"github.com/gabriel-vasile/mimetype"
+	"github.com/google/uuid"
 	"github.com/samber/lo"
 	"github.com/samber/lo/mutable"
 	"go.hacdias.com/eagle/core"
+	"go.hacdias.com/eagle/services/media"
 	"go.hacdias.com/indielib/indieauth"
 	"go.hacdias.com/indielib/micropub"
 	"go.hacdias.com/maze"
@@ -27,15 +31,22 @@ import (
 )
 
 const (
-	panelPath         = "/panel"
-	panelBrowsePath   = panelPath + "/browse"
-	panelEditPath     = panelPath + "/edit"
-	panelNewPath      = panelPath + "/new"
-	panelMentionsPath = panelPath + "/mentions"
-	panelTokensPath   = panelPath + "/tokens"
-	panelNewTokenPath = panelTokensPath + "/new"
-	panelCachePath    = panelPath + "/cache"
-	panelQueuePath    = panelPath + "/queue"
+	panelPath          = "/panel"
+	panelBrowsePath    = panelPath + "/browse"
+	panelEditPath      = panelPath + "/edit"
+	panelNewPath       = panelPath + "/new"
+	panelMentionsPath  = panelPath + "/mentions"
+	panelRulesPath     = panelMentionsPath + "/rules"
+	panelPublishedPath = panelMentionsPath + "/published"
+	panelSentPath      = panelMentionsPath + "/sent"
+	panelTokensPath    = panelPath + "/tokens"
+	panelNewTokenPath  = panelTokensPath + "/new"
+	panelCachePath     = panelPath + "/cache"
+	panelQueuePath     = panelPath + "/queue"
+	panelMediaPath     = panelPath + "/media"
+
+	// maxMediaSize is the maximum size of the media uploaded via the panel.
+	maxMediaSize = 20 << 20
 )
 
 func (s *Server) servePanel(w http.ResponseWriter, r *http.Request, data *panelPage) {
@@ -55,11 +66,10 @@ func (s *Server) getSyndicators() []Syndicator {
 }
 
 type panelPage struct {
-	Title         string
-	Actions       []string
-	Success       string
-	MediaLocation string
-	MediaPhoto    *core.Photo
+	Title       string
+	Actions     []string
+	Success     string
+	MediaUpload *media.Upload
 }
 
 func (s *Server) panelGet(w http.ResponseWriter, r *http.Request) {
@@ -73,10 +83,21 @@ func (s *Server) panelPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user := s.getUser(r)
 	if r.Form.Get("action") != "" {
+		if !user.Can(core.PermissionAdmin) {
+			s.panelError(w, r, http.StatusForbidden, errNotAllowed)
+			return
+		}
+
 		s.panelPostAction(w, r)
 		return
-	} else if err := r.ParseMultipartForm(20 << 20); err == nil {
+	} else if err := r.ParseMultipartForm(maxMediaSize); err == nil {
+		if !user.Can(core.PermissionMedia) {
+			s.panelError(w, r, http.StatusForbidden, errNotAllowed)
+			return
+		}
+
 		s.panelPostUpload(w, r)
 		return
 	}
@@ -85,14 +106,7 @@ func (s *Server) panelPost(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) panelPostAction(w http.ResponseWriter, r *http.Request) {
-	actions := r.Form["action"]
-
-	var err error
-	for _, actionName := range actions {
-		if fn, ok := s.actions[actionName]; ok {
-			err = errors.Join(err, fn())
-		}
-	}
+	err := s.runActions(r.Form["action"])
 	if err != nil {
 		s.panelError(w, r, http.StatusInternalServerError, err)
 		return
@@ -102,6 +116,17 @@ func (s *Server) panelPostAction(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, r.URL.Path+"?success=action", http.StatusSeeOther)
 }
 
+// runActions runs the actions with the given names. Unknown actions are ignored.
+func (s *Server) runActions(actions []string) error {
+	var err error
+	for _, actionName := range actions {
+		if fn, ok := s.actions[actionName]; ok {
+			err = errors.Join(err, fn())
+		}
+	}
+	return err
+}
+
 func (s *Server) panelPostUpload(w http.ResponseWriter, r *http.Request) {
 	file, filename, ext, err := parseMediaRequest(w, r)
 	if err != nil {
@@ -109,15 +134,14 @@ func (s *Server) panelPostUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	mediaLocation, mediaPhoto, err := s.media.UploadMedia(filename, ext, bytes.NewReader(file))
+	upload, err := s.media.UploadMedia(filename, ext, bytes.NewReader(file))
 	if err != nil {
 		s.panelError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
 	s.servePanel(w, r, &panelPage{
-		MediaLocation: mediaLocation,
-		MediaPhoto:    mediaPhoto,
+		MediaUpload: upload,
 	})
 }
 
@@ -129,6 +153,10 @@ type browserPage struct {
 
 func (s *Server) panelBrowserGet(w http.ResponseWriter, r *http.Request) {
 	filename := filepath.Clean(strings.TrimPrefix(r.URL.Path, panelBrowsePath))
+	if core.IsHiddenPath(filename) {
+		s.panelError(w, r, http.StatusForbidden, errNotAllowed)
+		return
+	}
 
 	info, err := s.core.Stat(filename)
 	if err != nil {
@@ -152,6 +180,9 @@ func (s *Server) panelBrowserGet(w http.ResponseWriter, r *http.Request) {
 		s.panelError(w, r, http.StatusBadRequest, err)
 		return
 	}
+	infos = lo.Filter(infos, func(info fs.FileInfo, _ int) bool {
+		return !core.IsHiddenPath(info.Name())
+	})
 
 	// Bonus: reverse the order in the posts directory to have the latest at the top.
 	if strings.HasPrefix(filename, path.Join("/", core.ContentDirectory, core.PostsSection)) {
@@ -186,6 +217,11 @@ func (s *Server) panelBrowserPost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	filename = filepath.Join(filename, dirname)
+	if core.IsHiddenPath(filename) {
+		s.panelError(w, r, http.StatusForbidden, errNotAllowed)
+		return
+	}
+
 	err = s.core.MkdirAll(filename)
 	if err != nil {
 		s.panelError(w, r, http.StatusInternalServerError, err)
@@ -208,6 +244,11 @@ type editPage struct {
 func (s *Server) panelEditGet(w http.ResponseWriter, r *http.Request) {
 	filename := filepath.Clean(strings.TrimPrefix(r.URL.Path, panelEditPath))
 
+	if !s.canEditFile(s.getUser(r), filename) {
+		s.panelError(w, r, http.StatusForbidden, errNotAllowed)
+		return
+	}
+
 	info, err := s.core.Stat(filename)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -292,38 +333,75 @@ func (s *Server) panelEditPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	req.Content = string(normalizeLineEndings([]byte(req.Content)))
+	err = s.saveFile(s.getUser(r), filename, req.Content, postSaveEntryOptions{
+		author:            s.getCommitAuthor(r),
+		syndicators:       req.Syndicators,
+		syndicationStatus: req.SyndicationStatus,
+	})
+	if errors.Is(err, errNotAllowed) {
+		s.panelError(w, r, http.StatusForbidden, err)
+		return
+	} else if errors.Is(err, errInvalidEntry) {
+		s.panelError(w, r, http.StatusBadRequest, err)
+		return
+	} else if err != nil {
+		s.panelError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	http.Redirect(w, r, r.URL.Path+"?success=true", http.StatusSeeOther)
+}
+
+// errInvalidEntry is returned by [Server.saveFile] when the file is an entry
+// whose content cannot be parsed.
+var errInvalidEntry = errors.New("invalid entry")
+
+// canEditFile returns whether the user can edit the file: either they can edit
+// all files, or it is a post they can edit. Hidden files cannot be edited.
+func (s *Server) canEditFile(user *core.User, filename string) bool {
+	if core.IsHiddenPath(filename) {
+		return false
+	}
+
+	if user.Can(core.PermissionFiles) {
+		return true
+	}
+
+	e, err := s.core.GetEntryByFilename(filename)
+	return err == nil && e.IsPost() && canEditEntry(user, e)
+}
+
+// saveFile writes the content to the file on behalf of the user. If the file
+// is a post, it is saved as an entry instead, such that the hooks run.
+func (s *Server) saveFile(user *core.User, filename, content string, options postSaveEntryOptions) error {
+	if !s.canEditFile(user, filename) {
+		return errNotAllowed
+	}
+
+	content = string(normalizeLineEndings([]byte(content)))
 
 	if oldEntry, err := s.core.GetEntryByFilename(filename); err == nil && oldEntry.IsPost() {
-		previousLinks, _ := s.core.GetEntryLinks(oldEntry, true)
+		options.previousLinks, _ = s.core.GetEntryLinks(oldEntry, true)
 
-		e, err := s.core.GetEntryFromContent(oldEntry.ID, req.Content)
+		e, err := s.core.GetEntryFromContent(oldEntry.ID, content)
 		if err != nil {
-			s.panelError(w, r, http.StatusBadRequest, err)
-			return
+			return fmt.Errorf("%w: %w", errInvalidEntry, err)
 		}
 
-		err = s.saveEntryWithHooks(e, postSaveEntryOptions{
-			syndicators:       req.Syndicators,
-			syndicationStatus: req.SyndicationStatus,
-			previousLinks:     previousLinks,
-		})
+		// Users who cannot edit the entries of others cannot give theirs away.
+		if !canEditEntry(user, e) {
+			return errNotAllowed
+		}
+
+		err = s.saveEntryWithHooks(e, options)
 		if err != nil {
-			s.panelError(w, r, http.StatusInternalServerError, err)
-			return
+			return err
 		}
 	} else if err != nil && !errors.Is(err, os.ErrNotExist) && !errors.Is(err, core.ErrIgnoredEntry) {
-		s.panelError(w, r, http.StatusBadRequest, fmt.Errorf("error getting entry by filename: %w", err))
-		return
-	}
-
-	err = s.core.WriteFile(filename, []byte(req.Content), "editor: update "+filename)
-	if err != nil {
-		s.panelError(w, r, http.StatusInternalServerError, err)
-		return
+		return fmt.Errorf("%w: error getting entry by filename: %w", errInvalidEntry, err)
 	}
 
-	http.Redirect(w, r, r.URL.Path+"?success=true", http.StatusSeeOther)
+	return s.core.WriteFileAs(options.author, filename, []byte(content), "editor: update "+filename)
 }
 
 type newPage struct {
@@ -399,6 +477,7 @@ func (s *Server) panelNewPost(w http.ResponseWriter, r *http.Request) {
 	e.Title = req.Title
 	e.Categories = []string{req.Category}
 	e.Tags = req.Tags
+	e.Author = s.getUser(r).Username
 
 	if len(req.Photos) > 0 {
 		if len(e.Photos) != 0 {
@@ -431,6 +510,7 @@ func (s *Server) panelNewPost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err = s.saveEntryWithHooks(e, postSaveEntryOptions{
+		author:            s.getCommitAuthor(r),
 		isNew:             true,
 		syndicators:       req.Syndicators,
 		syndicationStatus: req.SyndicationStatus,
@@ -464,17 +544,19 @@ func (s *Server) updateEntryWithPhotos(e *core.Entry) error {
 			}
 
 			ext := filepath.Ext(url)
-			location, photo, err := s.media.UploadMedia(filename, ext, bytes.NewBuffer(data))
+			upload, err := s.media.UploadMedia(filename, ext, bytes.NewBuffer(data))
 			if err != nil {
 				return fmt.Errorf("failed to upload photo: %w", err)
 			}
 
-			if photo != nil {
+			if photo := upload.Photo; photo != nil {
 				e.Photos[i].URL = photo.URL
 				e.Photos[i].Width = photo.Width
 				e.Photos[i].Height = photo.Height
+				e.Photos[i].Exif = photo.Exif
+				e.Photos[i].Renditions = photo.Renditions
 			} else {
-				e.Photos[i].URL = location
+				e.Photos[i].URL = upload.Location
 			}
 
 			s.mediaCache.Invalidate(url)
@@ -485,8 +567,10 @@ func (s *Server) updateEntryWithPhotos(e *core.Entry) error {
 }
 
 type mentionsPage struct {
-	Title    string
-	Mentions []*core.Mention
+	Title     string
+	Mentions  []*core.Mention
+	Rules     core.MentionRules
+	RuleTypes []core.MentionRuleType
 }
 
 func (s *Server) panelMentionsGet(w http.ResponseWriter, r *http.Request) {
@@ -496,9 +580,17 @@ func (s *Server) panelMentionsGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	rules, err := s.core.DB().GetMentionRules(r.Context())
+	if err != nil {
+		s.panelError(w, r, http.StatusInternalServerError, fmt.Errorf("error getting mention rules: %w", err))
+		return
+	}
+
 	s.panelTemplate(w, r, http.StatusOK, panelMentionsTemplate, &mentionsPage{
-		Title:    "Mentions",
-		Mentions: mentions,
+		Title:     "Mentions",
+		Mentions:  mentions,
+		Rules:     rules,
+		RuleTypes: core.MentionRuleTypes,
 	})
 }
 
@@ -510,70 +602,361 @@ func (s *Server) panelMentionsPost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	action := r.Form.Get("action")
-	id := r.Form.Get("id")
+	ids := r.Form["id"]
+
+	if action != "approve" && action != "delete" {
+		s.panelError(w, r, http.StatusBadRequest, fmt.Errorf("invalid action: %s", action))
+		return
+	}
+
+	err = s.moderateMentions(r.Context(), action, ids)
+	if err != nil {
+		s.panelError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	http.Redirect(w, r, r.URL.Path, http.StatusFound)
+}
 
-	switch action {
-	case "approve":
-		e, err := s.core.DB().GetMention(r.Context(), id)
+// moderateMentions approves, or deletes, the pending mentions with the given
+// IDs. The action must be either "approve" or "delete".
+func (s *Server) moderateMentions(ctx context.Context, action string, ids []string) error {
+	published := []*core.Mention{}
+	defer func() {
+		go s.mentionsPublished(published)
+	}()
+
+	for _, id := range ids {
+		m, err := s.core.DB().GetMention(ctx, id)
 		if err != nil {
-			s.panelError(w, r, http.StatusInternalServerError, err)
-			return
+			return err
 		}
 
-		if !e.Private {
-			if err := s.core.AddOrUpdateWebmention(e.EntryID, e, ""); err != nil {
-				s.panelError(w, r, http.StatusInternalServerError, fmt.Errorf("error adding or updating webmention: %w", err))
-				return
+		if action == "approve" {
+			err = s.publishMention(ctx, m)
+			if err != nil {
+				return err
 			}
 
-			go func() {
-				_ = s.core.Build(false)
-			}()
+			published = append(published, m)
+		} else {
+			s.mentionDeleted(ctx, m)
+		}
+
+		err = s.core.DB().DeleteMention(ctx, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) panelMentionRulesPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		s.panelError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	switch r.Form.Get("action") {
+	case "create":
+		rule := &core.MentionRule{
+			ID:      uuid.New().String(),
+			Type:    core.MentionRuleType(r.Form.Get("type")),
+			Value:   strings.TrimSpace(r.Form.Get("value")),
+			Created: time.Now(),
 		}
 
-		fallthrough
+		if !lo.Contains(core.MentionRuleTypes, rule.Type) {
+			s.panelError(w, r, http.StatusBadRequest, fmt.Errorf("invalid rule type: %s", rule.Type))
+			return
+		}
+
+		if rule.Type == core.MentionRuleAllowApproved {
+			rule.Value = ""
+		} else if rule.Value == "" {
+			s.panelError(w, r, http.StatusBadRequest, errors.New("rule value is required"))
+			return
+		}
+
+		err = s.core.DB().CreateMentionRule(r.Context(), rule)
 	case "delete":
-		err := s.core.DB().DeleteMention(r.Context(), id)
+		err = s.core.DB().DeleteMentionRule(r.Context(), r.Form.Get("id"))
+	default:
+		s.panelError(w, r, http.StatusBadRequest, fmt.Errorf("invalid action: %s", r.Form.Get("action")))
+		return
+	}
+	if err != nil {
+		s.panelError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	http.Redirect(w, r, panelMentionsPath, http.StatusFound)
+}
+
+type publishedEntry struct {
+	Entry        *core.Entry
+	Replies      int
+	Interactions int
+	Hidden       int
+}
+
+type publishedSection struct {
+	Name     string
+	Hidden   bool
+	Mentions []*core.Mention
+}
+
+type publishedPage struct {
+	Title    string
+	Entries  []*publishedEntry
+	Entry    *core.Entry
+	Sections []*publishedSection
+}
+
+func (s *Server) panelPublishedGet(w http.ResponseWriter, r *http.Request) {
+	if id := r.URL.Query().Get("entry"); id != "" {
+		e, err := s.core.GetEntry(id)
+		if err != nil {
+			s.panelError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		sidecar, err := s.core.GetSidecar(e)
 		if err != nil {
 			s.panelError(w, r, http.StatusInternalServerError, err)
 			return
 		}
-	default:
+
+		s.panelTemplate(w, r, http.StatusOK, panelPublishedTemplate, &publishedPage{
+			Title: "Published Mentions",
+			Entry: e,
+			Sections: []*publishedSection{
+				{Name: "Replies", Mentions: sidecar.Replies},
+				{Name: "Interactions", Mentions: sidecar.Interactions},
+				{Name: "Hidden", Hidden: true, Mentions: sidecar.Hidden},
+			},
+		})
+		return
+	}
+
+	ee, err := s.core.GetEntries(false)
+	if err != nil {
+		s.panelError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	entries := []*publishedEntry{}
+	for _, e := range ee {
+		sidecar, err := s.core.GetSidecar(e)
+		if err != nil {
+			s.panelError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		if len(sidecar.Replies)+len(sidecar.Interactions)+len(sidecar.Hidden) == 0 {
+			continue
+		}
+
+		entries = append(entries, &publishedEntry{
+			Entry:        e,
+			Replies:      len(sidecar.Replies),
+			Interactions: len(sidecar.Interactions),
+			Hidden:       len(sidecar.Hidden),
+		})
+	}
+
+	s.panelTemplate(w, r, http.StatusOK, panelPublishedTemplate, &publishedPage{
+		Title:   "Published Mentions",
+		Entries: entries,
+	})
+}
+
+func (s *Server) panelPublishedPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		s.panelError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	e, err := s.core.GetEntry(r.Form.Get("entry"))
+	if err != nil {
+		s.panelError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	id := r.Form.Get("id")
+	action := r.Form.Get("action")
+
+	err = s.core.UpdateSidecar(e, func(sidecar *core.Sidecar) (*core.Sidecar, error) {
+		m, _, err := sidecar.FindMention(id)
+		if err != nil {
+			return nil, err
+		}
+
+		switch action {
+		case "hide":
+			return sidecar, sidecar.HideMention(id, true)
+		case "show":
+			return sidecar, sidecar.HideMention(id, false)
+		case "delete":
+			_, err = sidecar.DeleteMention(id)
+			return sidecar, err
+		case "edit":
+			m.Name = r.Form.Get("name")
+			m.Author = r.Form.Get("author")
+			m.AuthorURL = r.Form.Get("author_url")
+			m.AuthorPhoto = r.Form.Get("author_photo")
+			m.Content = r.Form.Get("content")
+			return sidecar, nil
+		case "block":
+			rule := &core.MentionRule{
+				ID:      uuid.New().String(),
+				Type:    core.MentionRuleBlockAuthor,
+				Value:   lo.Ternary(m.AuthorURL != "", m.AuthorURL, m.Author),
+				Created: time.Now(),
+			}
+			if rule.Value == "" {
+				return nil, errors.New("mention has no author to block")
+			}
+
+			err = s.core.DB().CreateMentionRule(r.Context(), rule)
+			if err != nil {
+				return nil, err
+			}
+
+			return sidecar, sidecar.HideMention(id, true)
+		default:
+			return nil, fmt.Errorf("invalid action: %s", action)
+		}
+	})
+	if errors.Is(err, core.ErrMentionNotFound) {
+		s.panelError(w, r, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		s.panelError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if action == "delete" {
+		err = s.core.DB().DeleteCommentEmail(r.Context(), id)
+		if err != nil {
+			s.log.Errorw("failed to delete comment email", "id", id, "err", err)
+		}
+	}
+
+	go s.build(false)
+	http.Redirect(w, r, panelPublishedPath+"?"+url.Values{"entry": {e.ID}}.Encode(), http.StatusSeeOther)
+}
+
+type sentSource struct {
+	Source   string
+	Attempts []*core.WebmentionAttempt
+}
+
+type sentPage struct {
+	Title   string
+	Sources []*sentSource
+}
+
+func (s *Server) panelSentGet(w http.ResponseWriter, r *http.Request) {
+	attempts, err := s.core.DB().GetWebmentionAttempts(r.Context(), r.URL.Query().Get("source"))
+	if err != nil {
+		s.panelError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Only the latest attempt of each source and target is shown. The attempts
+	// are sorted from newest to oldest.
+	sources := []*sentSource{}
+	bySource := map[string]*sentSource{}
+	seen := map[[2]string]bool{}
+
+	for _, attempt := range attempts {
+		key := [2]string{attempt.Source, attempt.Target}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		source, ok := bySource[attempt.Source]
+		if !ok {
+			source = &sentSource{Source: attempt.Source}
+			bySource[attempt.Source] = source
+			sources = append(sources, source)
+		}
+		source.Attempts = append(source.Attempts, attempt)
+	}
+
+	s.panelTemplate(w, r, http.StatusOK, panelSentTemplate, &sentPage{
+		Title:   "Sent Webmentions",
+		Sources: sources,
+	})
+}
+
+func (s *Server) panelSentPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		s.panelError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if action := r.Form.Get("action"); action != "resend" {
 		s.panelError(w, r, http.StatusBadRequest, fmt.Errorf("invalid action: %s", action))
 		return
 	}
 
-	http.Redirect(w, r, r.URL.Path, http.StatusFound)
+	source := r.Form.Get("source")
+	err = s.core.ResendWebmention(r.Context(), source, r.Form.Get("target"))
+	if err != nil {
+		s.panelError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	http.Redirect(w, r, panelSentPath+"?"+url.Values{"source": {source}}.Encode(), http.StatusSeeOther)
 }
 
 type tokenPage struct {
-	Title         string
+	Title string
+	// Session is the ID of the current session.
+	Session       string
 	Sessions      []*core.Token
 	Tokens        []*core.Token
 	RefreshTokens []*core.Token
 }
 
+// panelTokensGet lists the sessions and tokens of the logged in user. Each user
+// only manages their own.
 func (s *Server) panelTokensGet(w http.ResponseWriter, r *http.Request) {
-	sessions, err := s.core.DB().GetTokensByType(r.Context(), core.TokenTypeSession)
+	usernames := s.usernames(s.getUser(r))
+
+	sessions, err := s.core.DB().GetTokensByType(r.Context(), core.TokenTypeSession, usernames...)
 	if err != nil {
 		s.panelError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	tokens, err := s.core.DB().GetTokensByType(r.Context(), core.TokenTypeAccess)
+	tokens, err := s.core.DB().GetTokensByType(r.Context(), core.TokenTypeAccess, usernames...)
 	if err != nil {
 		s.panelError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	refreshTokens, err := s.core.DB().GetTokensByType(r.Context(), core.TokenTypeRefresh)
+	refreshTokens, err := s.core.DB().GetTokensByType(r.Context(), core.TokenTypeRefresh, usernames...)
 	if err != nil {
 		s.panelError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
+	var current string
+	if session := s.getSession(r); session != nil {
+		current = session.ID
+	}
+
 	s.panelTemplate(w, r, http.StatusOK, panelTokensTemplate, &tokenPage{
 		Title:         "Tokens",
+		Session:       current,
 		Sessions:      sessions,
 		Tokens:        tokens,
 		RefreshTokens: refreshTokens,
@@ -586,6 +969,8 @@ func (s *Server) panelTokensPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	usernames := s.usernames(s.getUser(r))
+
 	switch r.Form.Get("action") {
 	case "revoke":
 		id := r.Form.Get("id")
@@ -594,7 +979,18 @@ func (s *Server) panelTokensPost(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if err := s.core.DB().DeleteToken(r.Context(), id); err != nil {
+		token, err := s.core.DB().GetTokenByID(r.Context(), id)
+		if err != nil {
+			s.panelError(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		if !lo.Contains(usernames, token.Username) {
+			s.panelError(w, r, http.StatusNotFound, errors.New("token not found"))
+			return
+		}
+
+		if err := s.revokeToken(r.Context(), token); err != nil {
 			s.panelError(w, r, http.StatusInternalServerError, err)
 			return
 		}
@@ -611,7 +1007,37 @@ func (s *Server) panelTokensPost(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if err := s.core.DB().DeleteAllTokensByType(r.Context(), tokenType); err != nil {
+		if tokenType == core.TokenTypeAccess {
+			// JWT access tokens must be added to the denylist.
+			tokens, err := s.core.DB().GetTokensByType(r.Context(), tokenType, usernames...)
+			if err != nil {
+				s.panelError(w, r, http.StatusInternalServerError, err)
+				return
+			}
+
+			for _, token := range tokens {
+				if err := s.revokeToken(r.Context(), token); err != nil {
+					s.panelError(w, r, http.StatusInternalServerError, err)
+					return
+				}
+			}
+		}
+
+		if err := s.core.DB().DeleteAllTokensByType(r.Context(), tokenType, usernames...); err != nil {
+			s.panelError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		http.Redirect(w, r, panelTokensPath, http.StatusSeeOther)
+
+	case "revoke-others":
+		session := s.getSession(r)
+		if session == nil {
+			s.panelError(w, r, http.StatusBadRequest, errors.New("missing session"))
+			return
+		}
+
+		if err := s.core.DB().DeleteOtherTokensByType(r.Context(), core.TokenTypeSession, session.ID, usernames...); err != nil {
 			s.panelError(w, r, http.StatusInternalServerError, err)
 			return
 		}
@@ -660,7 +1086,7 @@ func (s *Server) panelNewTokenPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	signed, err := s.generateToken(r.Context(), clientID, scope, expiry)
+	signed, err := s.generateToken(r.Context(), &clientMetadata{ClientID: clientID}, s.getUser(r).Username, scope, expiry)
 	if err != nil {
 		s.panelError(w, r, http.StatusInternalServerError, err)
 		return
@@ -730,6 +1156,55 @@ func (s *Server) panelQueuePost(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type mediaPage struct {
+	Title   string
+	Query   string
+	Files   []*mediaFile
+	Success string
+}
+
+type mediaFile struct {
+	*core.MediaFile
+	Preview string
+}
+
+func (s *Server) panelMediaGet(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+
+	files, err := s.core.DB().GetMediaFiles(r.Context(), query, 200)
+	if err != nil {
+		s.panelError(w, r, http.StatusInternalServerError, fmt.Errorf("error getting media files: %w", err))
+		return
+	}
+
+	s.panelTemplate(w, r, http.StatusOK, panelMediaTemplate, &mediaPage{
+		Title: "Media",
+		Query: query,
+		Files: lo.Map(files, func(f *core.MediaFile, _ int) *mediaFile {
+			return &mediaFile{MediaFile: f, Preview: s.media.PreviewURL(f)}
+		}),
+		Success: r.URL.Query().Get("success"),
+	})
+}
+
+func (s *Server) panelMediaPost(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		s.panelError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	switch r.Form.Get("action") {
+	case "delete":
+		if err := s.media.DeleteMedia(r.Context(), r.Form.Get("id")); err != nil {
+			s.panelError(w, r, http.StatusInternalServerError, fmt.Errorf("error deleting media file: %w", err))
+			return
+		}
+		http.Redirect(w, r, panelMediaPath+"?success=deleted", http.StatusSeeOther)
+	default:
+		s.panelError(w, r, http.StatusBadRequest, errors.New("invalid action"))
+	}
+}
+
 func normalizeLineEndings(d []byte) []byte {
 	// replace CR LF \r\n (windows) with LF \n (unix)
 	d = bytes.ReplaceAll(d, []byte{13, 10}, []byte{10})
@@ -739,9 +1214,9 @@ func normalizeLineEndings(d []byte) []byte {
 }
 
 func parseMediaRequest(w http.ResponseWriter, r *http.Request) ([]byte, string, string, error) {
-	r.Body = http.MaxBytesReader(w, r.Body, 20<<20)
+	r.Body = http.MaxBytesReader(w, r.Body, maxMediaSize)
 
-	err := r.ParseMultipartForm(20 << 20)
+	err := r.ParseMultipartForm(maxMediaSize)
 	if err != nil {
 		return nil, "", "", err
 	}
@@ -0,0 +1,374 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.hacdias.com/eagle/core"
+)
+
+const (
+	passkeyCookieName    = "eagle-passkey"
+	passkeySessionExpiry = time.Minute * 5
+
+	loginPasskeyBeginPath          = loginPath + "/passkey/begin"
+	loginPasskeyFinishPath         = loginPath + "/passkey/finish"
+	panelPasskeysPath              = panelPath + "/passkeys"
+	panelPasskeyRegisterBeginPath  = panelPasskeysPath + "/register/begin"
+	panelPasskeyRegisterFinishPath = panelPasskeysPath + "/register/finish"
+)
+
+// passkeyUser is a panel user, as seen by WebAuthn.
+type passkeyUser struct {
+	user        *core.User
+	id          []byte
+	name        string
+	credentials []webauthn.Credential
+}
+
+func (u *passkeyUser) WebAuthnID() []byte                         { return u.id }
+func (u *passkeyUser) WebAuthnName() string                       { return u.name }
+func (u *passkeyUser) WebAuthnDisplayName() string                { return u.name }
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
+
+// passkeyUserID returns the WebAuthn user handle of the user. The owner from
+// the configuration keeps the handle from before there were multiple users.
+func (s *Server) passkeyUserID(user *core.User) []byte {
+	id := s.c.ID()
+	if !s.isConfigUser(user.Username) {
+		id += "#" + user.Username
+	}
+
+	sum := sha256.Sum256([]byte(id))
+	return sum[:]
+}
+
+func (s *Server) getPasskeys(ctx context.Context, user *core.User) ([]*core.Passkey, error) {
+	return s.core.DB().GetPasskeysByUsername(ctx, s.usernames(user)...)
+}
+
+func (s *Server) getPasskeyUser(ctx context.Context, user *core.User) (*passkeyUser, []*core.Passkey, error) {
+	passkeys, err := s.getPasskeys(ctx, user)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pu := &passkeyUser{
+		user: user,
+		id:   s.passkeyUserID(user),
+		name: user.Username,
+	}
+
+	for _, passkey := range passkeys {
+		var credential webauthn.Credential
+		err = json.Unmarshal([]byte(passkey.Credential), &credential)
+		if err != nil {
+			return nil, nil, err
+		}
+		pu.credentials = append(pu.credentials, credential)
+	}
+
+	return pu, passkeys, nil
+}
+
+// getPasskeyUserByHandle returns the user with the given WebAuthn user handle,
+// as used by discoverable logins.
+func (s *Server) getPasskeyUserByHandle(ctx context.Context, handle []byte) (*passkeyUser, []*core.Passkey, error) {
+	users, err := s.core.DB().GetUsers(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, user := range append([]*core.User{s.configUser()}, users...) {
+		if bytes.Equal(handle, s.passkeyUserID(user)) {
+			return s.getPasskeyUser(ctx, user)
+		}
+	}
+
+	return nil, nil, errors.New("unknown user")
+}
+
+// savePasskeySession stores the data of an ongoing WebAuthn ceremony, which is
+// identified by a short-lived cookie.
+func (s *Server) savePasskeySession(w http.ResponseWriter, r *http.Request, session *webauthn.SessionData) {
+	id := rand.Text()
+	s.passkeySessions.Set(id, session)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     passkeyCookieName,
+		Value:    id,
+		MaxAge:   int(passkeySessionExpiry / time.Second),
+		Secure:   isSecure(r),
+		HttpOnly: true,
+		Path:     panelPath,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// popPasskeySession returns, and removes, the data of the ongoing WebAuthn
+// ceremony. Each ceremony can only be finished once.
+func (s *Server) popPasskeySession(w http.ResponseWriter, r *http.Request) (*webauthn.SessionData, error) {
+	cookie, err := r.Cookie(passkeyCookieName)
+	if err != nil {
+		return nil, errors.New("passkey session not found")
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     passkeyCookieName,
+		MaxAge:   -1,
+		Secure:   isSecure(r),
+		HttpOnly: true,
+		Path:     panelPath,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	// Invalidate also returns the expired sessions that were not cleaned up
+	// yet, such that they must be checked first.
+	session, ok := s.passkeySessions.GetIfPresent(cookie.Value)
+	if _, invalidated := s.passkeySessions.Invalidate(cookie.Value); !ok || !invalidated {
+		return nil, errors.New("passkey session expired")
+	}
+
+	return session, nil
+}
+
+func (s *Server) loginPasskeyBeginPost(w http.ResponseWriter, r *http.Request) {
+	assertion, session, err := s.webauthn.BeginDiscoverableLogin()
+	if err != nil {
+		s.serveErrorJSON(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	s.savePasskeySession(w, r, session)
+	s.serveJSON(w, http.StatusOK, assertion)
+}
+
+func (s *Server) loginPasskeyFinishPost(w http.ResponseWriter, r *http.Request) {
+	session, err := s.popPasskeySession(w, r)
+	if err != nil {
+		s.serveErrorJSON(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	var (
+		user     *passkeyUser
+		passkeys []*core.Passkey
+	)
+
+	_, credential, err := s.webauthn.FinishPasskeyLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+		var err error
+		user, passkeys, err = s.getPasskeyUserByHandle(r.Context(), userHandle)
+		return user, err
+	}, *session, r)
+	if err != nil {
+		s.log.Warnw("passkey login failed", "err", err)
+		s.serveErrorJSON(w, http.StatusUnauthorized, "access_denied", "invalid passkey")
+		return
+	}
+
+	if s.passkeyCloned(user, credential) {
+		s.serveErrorJSON(w, http.StatusUnauthorized, "access_denied", "invalid passkey")
+		return
+	}
+
+	// Store the updated signature counter, and other authenticator data.
+	id := base64.RawURLEncoding.EncodeToString(credential.ID)
+	for _, passkey := range passkeys {
+		if passkey.ID != id {
+			continue
+		}
+
+		data, err := json.Marshal(credential)
+		if err != nil {
+			s.serveErrorJSON(w, http.StatusInternalServerError, "server_error", err.Error())
+			return
+		}
+
+		passkey.Credential = string(data)
+		passkey.LastUsed = time.Now()
+		err = s.core.DB().UpdatePasskey(r.Context(), passkey)
+		if err != nil {
+			s.serveErrorJSON(w, http.StatusInternalServerError, "server_error", err.Error())
+			return
+		}
+	}
+
+	err = s.createSession(w, r, user.user)
+	if err != nil {
+		s.serveErrorJSON(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	s.serveJSON(w, http.StatusOK, map[string]string{
+		"redirect": loginRedirect(r),
+	})
+}
+
+// passkeyCloned returns whether the signature counter of the authenticator went
+// back, which means that it may have been cloned, and notifies it if so.
+func (s *Server) passkeyCloned(user *passkeyUser, credential *webauthn.Credential) bool {
+	if !credential.Authenticator.CloneWarning {
+		return false
+	}
+
+	id := base64.RawURLEncoding.EncodeToString(credential.ID)
+	s.log.Warnw("passkey login rejected, authenticator may be cloned", "username", user.user.Username, "id", id)
+	s.n.Notify(fmt.Sprintf("🔐 #login rejected a passkey login of %s, as its authenticator may have been cloned: check the passkey %s", user.user.Username, id))
+	return true
+}
+
+func (s *Server) panelPasskeyRegisterBeginPost(w http.ResponseWriter, r *http.Request) {
+	user, _, err := s.getPasskeyUser(r.Context(), s.getUser(r))
+	if err != nil {
+		s.serveErrorJSON(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	creation, session, err := s.webauthn.BeginRegistration(
+		user,
+		webauthn.WithExclusions(webauthn.Credentials(user.credentials).CredentialDescriptors()),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+	)
+	if err != nil {
+		s.serveErrorJSON(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	s.savePasskeySession(w, r, session)
+	s.serveJSON(w, http.StatusOK, creation)
+}
+
+func (s *Server) panelPasskeyRegisterFinishPost(w http.ResponseWriter, r *http.Request) {
+	session, err := s.popPasskeySession(w, r)
+	if err != nil {
+		s.serveErrorJSON(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	user, _, err := s.getPasskeyUser(r.Context(), s.getUser(r))
+	if err != nil {
+		s.serveErrorJSON(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	credential, err := s.webauthn.FinishRegistration(user, *session, r)
+	if err != nil {
+		s.serveErrorJSON(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	data, err := json.Marshal(credential)
+	if err != nil {
+		s.serveErrorJSON(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	name := strings.TrimSpace(r.URL.Query().Get("name"))
+	if name == "" {
+		name = "Passkey"
+	}
+
+	err = s.core.DB().CreatePasskey(r.Context(), &core.Passkey{
+		ID:         base64.RawURLEncoding.EncodeToString(credential.ID),
+		Username:   user.user.Username,
+		Name:       name,
+		Credential: string(data),
+		Created:    time.Now(),
+	})
+	if err != nil {
+		s.serveErrorJSON(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	s.serveJSON(w, http.StatusOK, map[string]string{
+		"redirect": panelPasskeysPath,
+	})
+}
+
+type passkeysPage struct {
+	Title    string
+	Passkeys []*core.Passkey
+	Password bool
+}
+
+func (s *Server) panelPasskeysGet(w http.ResponseWriter, r *http.Request) {
+	user := s.getUser(r)
+	passkeys, err := s.getPasskeys(r.Context(), user)
+	if err != nil {
+		s.panelError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.panelTemplate(w, r, http.StatusOK, panelPasskeysTemplate, &passkeysPage{
+		Title:    "Passkeys",
+		Passkeys: passkeys,
+		Password: user.Password != "",
+	})
+}
+
+func (s *Server) panelPasskeysPost(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		s.panelError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	user := s.getUser(r)
+	passkeys, err := s.getPasskeys(r.Context(), user)
+	if err != nil {
+		s.panelError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	id := r.Form.Get("id")
+	var passkey *core.Passkey
+	for _, p := range passkeys {
+		if p.ID == id {
+			passkey = p
+			break
+		}
+	}
+	if passkey == nil {
+		s.panelError(w, r, http.StatusNotFound, errors.New("passkey not found"))
+		return
+	}
+
+	switch r.Form.Get("action") {
+	case "rename":
+		name := strings.TrimSpace(r.Form.Get("name"))
+		if name == "" {
+			s.panelError(w, r, http.StatusBadRequest, errors.New("missing name"))
+			return
+		}
+
+		passkey.Name = name
+		err = s.core.DB().UpdatePasskey(r.Context(), passkey)
+	case "delete":
+		if user.Password == "" && len(passkeys) == 1 {
+			s.panelError(w, r, http.StatusBadRequest, errors.New("cannot delete the last passkey while password login is disabled"))
+			return
+		}
+
+		err = s.core.DB().DeletePasskey(r.Context(), passkey.ID)
+	default:
+		s.panelError(w, r, http.StatusBadRequest, errors.New("invalid action"))
+		return
+	}
+
+	if err != nil {
+		s.panelError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	http.Redirect(w, r, panelPasskeysPath, http.StatusSeeOther)
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/maypok86/otter/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.hacdias.com/eagle/core"
+	"go.uber.org/zap"
+)
+
+// testClock is a clock for the caches, which only moves when told to.
+type testClock struct {
+	now atomic.Int64
+}
+
+func (c *testClock) NowNano() int64 {
+	return c.now.Load()
+}
+
+func (c *testClock) Tick(time.Duration) <-chan time.Time {
+	return nil
+}
+
+type recordingNotifier struct {
+	messages []string
+}
+
+func (n *recordingNotifier) Notify(msg string) {
+	n.messages = append(n.messages, msg)
+}
+
+func TestPasskeySession(t *testing.T) {
+	clock := &testClock{}
+	s := &Server{
+		passkeySessions: otter.Must(&otter.Options[string, *webauthn.SessionData]{
+			MaximumSize:      10,
+			ExpiryCalculator: otter.ExpiryWriting[string, *webauthn.SessionData](passkeySessionExpiry),
+			Clock:            clock,
+		}),
+	}
+
+	save := func() *http.Cookie {
+		w := httptest.NewRecorder()
+		s.savePasskeySession(w, httptest.NewRequest(http.MethodPost, loginPasskeyBeginPath, nil), &webauthn.SessionData{Challenge: "challenge"})
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		return cookies[0]
+	}
+
+	pop := func(cookie *http.Cookie) (*webauthn.SessionData, error) {
+		r := httptest.NewRequest(http.MethodPost, loginPasskeyFinishPath, nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		return s.popPasskeySession(httptest.NewRecorder(), r)
+	}
+
+	_, err := pop(nil)
+	assert.Error(t, err)
+
+	// Sessions can only be used once.
+	cookie := save()
+	session, err := pop(cookie)
+	require.NoError(t, err)
+	assert.Equal(t, "challenge", session.Challenge)
+
+	_, err = pop(cookie)
+	assert.Error(t, err)
+
+	// Sessions expire.
+	cookie = save()
+	clock.now.Add(int64(passkeySessionExpiry + time.Second))
+	_, err = pop(cookie)
+	assert.Error(t, err)
+}
+
+func TestPasskeyCloned(t *testing.T) {
+	n := &recordingNotifier{}
+	s := &Server{log: zap.NewNop().Sugar(), n: n}
+	user := &passkeyUser{user: &core.User{Username: "alice"}}
+
+	credential := &webauthn.Credential{ID: []byte("passkey")}
+	assert.False(t, s.passkeyCloned(user, credential))
+	assert.Empty(t, n.messages)
+
+	credential.Authenticator.CloneWarning = true
+	assert.True(t, s.passkeyCloned(user, credential))
+	require.Len(t, n.messages, 1)
+	assert.Contains(t, n.messages[0], "alice")
+}
+
+func TestDeleteLastPasskey(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+
+	alice, err := s.getUserByUsername(ctx, "alice")
+	require.NoError(t, err)
+	require.Empty(t, alice.Password)
+
+	for _, id := range []string{"a", "b"} {
+		require.NoError(t, s.core.DB().CreatePasskey(ctx, &core.Passkey{ID: id, Username: "alice", Name: id, Credential: "{}"}))
+	}
+
+	remove := func(id string) int {
+		return testPanelRequest(s, alice, http.MethodPost, panelPasskeysPath, url.Values{"action": {"delete"}, "id": {id}}).Code
+	}
+
+	assert.Equal(t, http.StatusSeeOther, remove("a"))
+
+	// Without a password, the last passkey is the only way to log in.
+	assert.Equal(t, http.StatusBadRequest, remove("b"))
+
+	passkeys, err := s.getPasskeys(ctx, alice)
+	require.NoError(t, err)
+	require.Len(t, passkeys, 1)
+	assert.Equal(t, "b", passkeys[0].ID)
+
+	// Other users' passkeys cannot be deleted.
+	owner := s.configUser()
+	assert.Equal(t, http.StatusNotFound, testPanelRequest(s, owner, http.MethodPost, panelPasskeysPath, url.Values{"action": {"delete"}, "id": {"b"}}).Code)
+}
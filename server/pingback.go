@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	urlpkg "net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"go.hacdias.com/eagle/core"
+	"go.hacdias.com/eagle/pingback"
+	"go.hacdias.com/eagle/xray"
+	"go.hacdias.com/indielib/microformats"
+)
+
+const (
+	pingbackPath = "/pingback"
+)
+
+// errPingbackSource is the fault of every pingback whose source could not be
+// verified, such that the callers cannot learn what fetching it found.
+var errPingbackSource = &pingback.Fault{Code: pingback.FaultGeneric, Message: "The source URI could not be verified."}
+
+func (s *Server) pingbackPost(w http.ResponseWriter, r *http.Request) {
+	source, target, err := pingback.ParseRequest(r.Body)
+	if err != nil {
+		pingback.WriteFault(w, err)
+		return
+	}
+
+	err = s.receivePingback(r.Context(), source, target)
+	if err != nil {
+		s.log.Infow("rejected pingback", "source", source, "target", target, "err", err)
+		pingback.WriteFault(w, err)
+		return
+	}
+
+	pingback.WriteResponse(w, "Pingback received and waiting for moderation.")
+}
+
+func (s *Server) receivePingback(ctx context.Context, source, target string) error {
+	s.log.Infow("received pingback", "source", source, "target", target)
+
+	targetURL, err := urlpkg.Parse(target)
+	if err != nil || targetURL.Host != s.core.BaseURL().Host {
+		return &pingback.Fault{Code: pingback.FaultTargetInvalid, Message: "The target URI is not on this website."}
+	}
+
+	e, err := s.core.GetEntryByPermalink(target)
+	if err != nil || e.Deleted() || e.Draft {
+		return &pingback.Fault{Code: pingback.FaultTargetNotFound, Message: "The target URI does not exist."}
+	}
+
+	sourceURL, err := urlpkg.Parse(source)
+	if err != nil || (sourceURL.Scheme != "http" && sourceURL.Scheme != "https") || core.IsPrivateURL(source) {
+		return errPingbackSource
+	}
+
+	if registered, err := s.isMentionRegistered(ctx, e, source); err != nil {
+		return err
+	} else if registered {
+		return &pingback.Fault{Code: pingback.FaultAlreadyRegistered, Message: "The pingback has already been registered."}
+	}
+
+	doc, err := s.pingback.FetchSource(source, target)
+	if err != nil {
+		s.log.Infow("pingback source not verified", "source", source, "target", target, "err", err)
+		return errPingbackSource
+	}
+
+	mention := &core.Mention{
+		ID: uuid.New().String(),
+		Post: xray.Post{
+			Name:      doc.Title,
+			Content:   doc.Excerpt,
+			Author:    sourceURL.Hostname(),
+			AuthorURL: (&urlpkg.URL{Scheme: sourceURL.Scheme, Host: sourceURL.Host}).String(),
+			Date:      time.Now(),
+			URL:       source,
+			Type:      microformats.TypeMention,
+		},
+		EntryID: e.ID,
+	}
+
+	action := s.moderateMention(ctx, mention)
+	if action == core.MentionBlock {
+		s.log.Infow("discarded blocked pingback", "source", source, "target", target)
+		return nil
+	}
+
+	return s.receiveMention(ctx, e, mention, action)
+}
+
+// isMentionRegistered returns whether a mention of the entry from the URL is
+// published, or waiting for approval.
+func (s *Server) isMentionRegistered(ctx context.Context, e *core.Entry, url string) (bool, error) {
+	pending, err := s.core.DB().IsMentionPending(ctx, e.ID, url)
+	if err != nil || pending {
+		return pending, err
+	}
+
+	sidecar, err := s.core.GetSidecar(e)
+	if err != nil {
+		return false, err
+	}
+
+	mentions := lo.Flatten([][]*core.Mention{sidecar.Replies, sidecar.Interactions, sidecar.Hidden})
+	return lo.ContainsBy(mentions, func(m *core.Mention) bool {
+		return strings.TrimSuffix(m.URL, "/") == strings.TrimSuffix(url, "/")
+	}), nil
+}
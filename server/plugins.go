@@ -54,12 +54,32 @@ type Photo struct {
 	MimeType string
 	Width    int
 	Height   int
+	Exif     *core.Exif
+}
+
+type Video struct {
+	Data     []byte
+	Title    string
+	MimeType string
+	Width    int
+	Height   int
+	Duration float64
+	Poster   *Photo
+}
+
+type Audio struct {
+	Data     []byte
+	Title    string
+	MimeType string
+	Duration float64
 }
 
 type SyndicationContext struct {
 	Thumbnail *Photo
 	Status    string
 	Photos    []*Photo
+	Videos    []*Video
+	Audio     []*Audio
 }
 
 type Syndicator struct {
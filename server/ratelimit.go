@@ -0,0 +1,87 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/maypok86/otter/v2"
+	"go.hacdias.com/eagle/core"
+)
+
+// rateLimiter limits the number of requests per IP address in fixed windows
+// of time.
+type rateLimiter struct {
+	conf    core.RateLimit
+	windows *otter.Cache[string, *atomic.Int64]
+}
+
+func newRateLimiter(conf core.RateLimit) *rateLimiter {
+	return &rateLimiter{
+		conf: conf,
+		windows: otter.Must(&otter.Options[string, *atomic.Int64]{
+			MaximumSize:      100_000,
+			ExpiryCalculator: otter.ExpiryCreating[string, *atomic.Int64](conf.Window),
+		}),
+	}
+}
+
+// allow records a request from the IP address, and returns whether it is
+// within the limit.
+func (l *rateLimiter) allow(ip string) bool {
+	requests, _ := l.windows.SetIfAbsent(ip, &atomic.Int64{})
+	return requests.Add(1) <= int64(l.conf.Requests)
+}
+
+// withRateLimit returns a middleware that calls onLimit, which must respond
+// with 429 Too Many Requests, when the client exceeds the rate limit. A zero
+// limit disables it.
+func withRateLimit(conf core.RateLimit, onLimit http.HandlerFunc) func(http.Handler) http.Handler {
+	if conf.Requests == 0 {
+		return func(next http.Handler) http.Handler {
+			return next
+		}
+	}
+
+	limiter := newRateLimiter(conf)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !limiter.allow(clientIP(r)) {
+				w.Header().Set("Retry-After", strconv.Itoa(max(1, int(conf.Window.Seconds()))))
+				onLimit(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP returns the IP address of the client. If the server trusts the
+// proxy headers, RemoteAddr has been set from them already.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// withProxyWarning warns once if a request comes from a loopback or private
+// address while TrustProxy is off. That usually means that Eagle runs behind a
+// reverse proxy, in which case all clients share the address of the proxy,
+// and the limits per IP address apply to everyone at once. Onion services are
+// ignored, as Tor connects from the loopback address.
+func (s *Server) withProxyWarning(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip := net.ParseIP(clientIP(r)); ip != nil && (ip.IsLoopback() || ip.IsPrivate()) && !strings.HasSuffix(r.Host, ".onion") {
+			s.proxyWarning.Do(func() {
+				s.log.Warnw("request from a private address while trustProxy is disabled: if Eagle is behind a reverse proxy, enable trustProxy, or all clients share the same rate limits and login lockouts", "ip", ip.String())
+			})
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.hacdias.com/eagle/core"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(core.RateLimit{Requests: 2, Window: time.Hour})
+	assert.True(t, l.allow("1.1.1.1"))
+	assert.True(t, l.allow("1.1.1.1"))
+	assert.False(t, l.allow("1.1.1.1"))
+	assert.True(t, l.allow("2.2.2.2"))
+}
+
+func TestCORS(t *testing.T) {
+	handler := withCORS([]string{"https://example.com"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	serve := func(method, origin string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/search.json", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve(http.MethodGet, "https://example.com")
+	assert.Equal(t, http.StatusTeapot, w.Code)
+	assert.Equal(t, "https://example.com", w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = serve(http.MethodGet, "https://other.com")
+	assert.Equal(t, http.StatusTeapot, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = serve(http.MethodOptions, "https://example.com")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "GET, OPTIONS", w.Header().Get("Access-Control-Allow-Methods"))
+}
+
+func TestProxyWarning(t *testing.T) {
+	observed, logs := observer.New(zap.WarnLevel)
+	s := &Server{log: zap.New(observed).Sugar()}
+	handler := s.withProxyWarning(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	do := func(remoteAddr, host string) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = remoteAddr
+		r.Host = host
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	do("1.1.1.1:1234", "example.com")
+	do("127.0.0.1:1234", "example.onion")
+	assert.Zero(t, logs.Len())
+
+	do("10.0.0.1:1234", "example.com")
+	do("127.0.0.1:1234", "example.com")
+	assert.Equal(t, 1, logs.Len())
+}
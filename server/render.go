@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"html/template"
 	"net/http"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
+	"go.hacdias.com/eagle/core"
 )
 
 const (
@@ -16,17 +18,22 @@ const (
 	errorTemplate  string = "error.html"
 
 	// Our templates.
-	panelTemplate         string = "panel.html"
-	panelErrorTemplate    string = "error.html"
-	panelAuthTemplate     string = "authorization.html"
-	panelLoginTemplate    string = "login.html"
-	panelMentionsTemplate string = "mentions.html"
-	panelTokensTemplate   string = "tokens.html"
-	panelNewTokenTemplate string = "new-token.html"
-	panelEditorTemplate   string = "editor.html"
-	panelNewTemplate      string = "new.html"
-	panelBrowserTemplate  string = "browser.html"
-	panelQueueTemplate    string = "queue.html"
+	panelTemplate          string = "panel.html"
+	panelErrorTemplate     string = "error.html"
+	panelAuthTemplate      string = "authorization.html"
+	panelLoginTemplate     string = "login.html"
+	panelMentionsTemplate  string = "mentions.html"
+	panelPublishedTemplate string = "published.html"
+	panelSentTemplate      string = "sent.html"
+	panelTokensTemplate    string = "tokens.html"
+	panelPasskeysTemplate  string = "passkeys.html"
+	panelNewTokenTemplate  string = "new-token.html"
+	panelEditorTemplate    string = "editor.html"
+	panelNewTemplate       string = "new.html"
+	panelBrowserTemplate   string = "browser.html"
+	panelQueueTemplate     string = "queue.html"
+	panelMediaTemplate     string = "media.html"
+	panelUsersTemplate     string = "users.html"
 )
 
 type errorPage struct {
@@ -46,9 +53,23 @@ func (s *Server) serveErrorHTML(w http.ResponseWriter, r *http.Request, code int
 		data.Message = err.Error()
 	}
 
+	s.serveErrorPage(w, r, data)
+}
+
+// serveMessageHTML renders a message to the visitor using the error template,
+// for pages such as confirmations that have no template of their own.
+func (s *Server) serveMessageHTML(w http.ResponseWriter, r *http.Request, title, message string) {
+	s.serveErrorPage(w, r, &errorPage{
+		Title:   title,
+		Status:  http.StatusOK,
+		Message: message,
+	})
+}
+
+func (s *Server) serveErrorPage(w http.ResponseWriter, r *http.Request, data *errorPage) {
 	doc, err := s.getDocument("404.html")
 	if err != nil {
-		w.WriteHeader(code)
+		w.WriteHeader(data.Status)
 		_, _ = w.Write([]byte(data.Message))
 		return
 	}
@@ -56,7 +77,7 @@ func (s *Server) serveErrorHTML(w http.ResponseWriter, r *http.Request, code int
 	txt := doc.Find("title").Text()
 	txt = strings.Replace(txt, "404 Page not found", data.Title, 1) // Hugo 404.html Title
 	doc.Find("title").SetText(txt)
-	s.renderDocument(w, r, doc, code, errorTemplate, data)
+	s.renderDocument(w, r, doc, data.Status, errorTemplate, data)
 }
 
 func (s *Server) getDocument(path string) (*goquery.Document, error) {
@@ -109,10 +130,45 @@ func (s *Server) panelError(w http.ResponseWriter, r *http.Request, code int, re
 	s.panelTemplate(w, r, code, panelErrorTemplate, data)
 }
 
-func (s *Server) panelTemplate(w http.ResponseWriter, r *http.Request, code int, template string, data any) {
+// panelTemplateFuncs returns the functions available to the panel templates,
+// which depend on the logged in user:
+//
+//   - can returns whether the user has the given permission.
+//   - csrfToken returns the CSRF token of the session.
+//   - csrfField returns the hidden form input with the CSRF token.
+//   - cspNonce returns the nonce that the inline scripts must carry.
+func panelTemplateFuncs(user *core.User, csrfToken, nonce string) template.FuncMap {
+	return template.FuncMap{
+		"can": func(p string) bool {
+			return user != nil && user.Can(core.Permission(p))
+		},
+		"csrfToken": func() string {
+			return csrfToken
+		},
+		"csrfField": func() template.HTML {
+			return csrfField(csrfToken)
+		},
+		"cspNonce": func() string {
+			return nonce
+		},
+	}
+}
+
+func (s *Server) panelTemplate(w http.ResponseWriter, r *http.Request, code int, name string, data any) {
+	// The panel templates are never executed directly, such that they can be
+	// cloned with the functions of the request.
+	t, err := panelTemplates.Clone()
+	if err != nil {
+		s.log.Errorw("failed to clone templates", "url", r.URL.Path, "err", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	nonce := s.setPanelHeaders(w)
+	t.Funcs(panelTemplateFuncs(s.getUser(r), s.csrfToken(r), nonce))
+
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(code)
-	err := panelTemplates.ExecuteTemplate(w, template, data)
+	err = t.ExecuteTemplate(w, name, data)
 	if err != nil {
 		s.log.Errorw("failed to execute template", "url", r.URL.Path, "err", err)
 	}
@@ -127,6 +183,13 @@ func (s *Server) serveJSON(w http.ResponseWriter, code int, data any) {
 	}
 }
 
+// serveServerErrorJSON logs the error, and responds with a generic one, such
+// that the internal errors are not disclosed.
+func (s *Server) serveServerErrorJSON(w http.ResponseWriter, r *http.Request, err error) {
+	s.log.Errorw("request failed", "url", r.URL.Path, "err", err)
+	s.serveErrorJSON(w, http.StatusInternalServerError, "server_error", "internal server error")
+}
+
 func (s *Server) serveErrorJSON(w http.ResponseWriter, code int, err, errDescription string) {
 	s.serveJSON(w, code, map[string]string{
 		"error":             err,
@@ -1,11 +1,14 @@
 package server
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"go.hacdias.com/eagle/core"
 	"go.hacdias.com/eagle/log"
+	"go.hacdias.com/eagle/pingback"
 )
 
 func (s *Server) makeRouter() http.Handler {
@@ -13,6 +16,12 @@ func (s *Server) makeRouter() http.Handler {
 	r.Use(s.withRecoverer)
 	r.Use(log.WithZap)
 	r.Use(withCleanPath)
+
+	if s.c.TrustProxy {
+		r.Use(middleware.RealIP)
+	} else {
+		r.Use(s.withProxyWarning)
+	}
 	r.Use(middleware.GetHead)
 	r.Use(s.withSecurityHeaders)
 
@@ -21,7 +30,14 @@ func (s *Server) makeRouter() http.Handler {
 	}
 
 	if s.c.Comments.Redirect != "" {
-		r.Post(commentsPath, s.commentsPost)
+		r.With(withRateLimit(s.c.Comments.RateLimit, func(w http.ResponseWriter, r *http.Request) {
+			s.serveErrorHTML(w, r, http.StatusTooManyRequests, errors.New("too many comments, try again later"))
+		})).Post(commentsPath, s.commentsPost)
+
+		if s.mailer != nil {
+			r.Get(commentsVerifyPath, s.commentsVerifyGet)
+			r.Get(commentsUnsubscribePath, s.commentsUnsubscribeGet)
+		}
 	}
 
 	if s.c.WebhookSecret != "" {
@@ -32,8 +48,23 @@ func (s *Server) makeRouter() http.Handler {
 		r.Post(webmentionPath, s.webmentionPost)
 	}
 
-	if s.meilisearch != nil {
+	if s.c.Webmentions.Pingback {
+		r.With(withRateLimit(s.c.Webmentions.PingbackRateLimit, func(w http.ResponseWriter, r *http.Request) {
+			pingback.WriteFault(w, &pingback.Fault{Code: pingback.FaultGeneric, Message: "Too many pingbacks, try again later."})
+		})).Post(pingbackPath, s.pingbackPost)
+	}
+
+	if s.search != nil {
 		r.Get(searchPath, s.searchGet)
+		r.Group(func(r chi.Router) {
+			// Preflight requests are answered by withCORS.
+			r.Use(withCORS(s.c.Search.API.AllowedOrigins))
+			r.Use(withRateLimit(s.c.Search.API.RateLimit, func(w http.ResponseWriter, r *http.Request) {
+				s.serveErrorJSON(w, http.StatusTooManyRequests, "too_many_requests", "rate limit exceeded")
+			}))
+			r.Options(searchAPIPath, s.searchAPIGet)
+			r.Get(searchAPIPath, s.searchAPIGet)
+		})
 	}
 
 	if s.c.Site.Params.Author.Handle != "" {
@@ -48,6 +79,7 @@ func (s *Server) makeRouter() http.Handler {
 	r.Post(authPath, s.authPost)
 	r.Post(tokenPath, s.tokenPost)
 	r.Post(tokenVerifyPath, s.tokenVerifyPost)
+	r.Post(tokenRevokePath, s.tokenRevokePost)
 
 	// Panel Assets
 	r.Get("/panel/assets*", http.StripPrefix("/panel", http.FileServer(http.FS(panelAssetsFS))).ServeHTTP)
@@ -59,35 +91,12 @@ func (s *Server) makeRouter() http.Handler {
 		// Login
 		r.Get(loginPath, s.loginGet)
 		r.Post(loginPath, s.loginPost)
+		r.Post(loginPasskeyBeginPath, s.loginPasskeyBeginPost)
+		r.Post(loginPasskeyFinishPath, s.loginPasskeyFinishPost)
 		r.Get(logoutPath, s.logoutGet)
 
-		// Admin only pages.
-		r.Group(func(r chi.Router) {
-			r.Use(s.mustLoggedIn)
-
-			// IndieAuth Server (Part II)
-			r.Get(authPath, s.authGet)
-			r.Post(authAcceptPath, s.authAcceptPost)
-
-			// Panel
-			r.Get(panelPath, s.panelGet)
-			r.Post(panelPath, s.panelPost)
-			r.Get(panelMentionsPath, s.panelMentionsGet)
-			r.Post(panelMentionsPath, s.panelMentionsPost)
-			r.Get(panelTokensPath, s.panelTokensGet)
-			r.Post(panelTokensPath, s.panelTokensPost)
-			r.Get(panelNewTokenPath, s.panelNewTokenGet)
-			r.Post(panelNewTokenPath, s.panelNewTokenPost)
-			r.Get(panelBrowsePath+"*", s.panelBrowserGet)
-			r.Post(panelBrowsePath+"*", s.panelBrowserPost)
-			r.Get(panelEditPath+"*", s.panelEditGet)
-			r.Post(panelEditPath+"*", s.panelEditPost)
-			r.Get(panelNewPath, s.panelNewGet)
-			r.Post(panelNewPath, s.panelNewPost)
-			r.Post(panelCachePath, s.panelCachePost)
-			r.Get(panelQueuePath, s.panelQueueGet)
-			r.Post(panelQueuePath, s.panelQueuePost)
-		})
+		// Logged in pages. What each user can access depends on their role.
+		r.Group(s.panelRouter)
 	})
 
 	// IndieAuth-protected Pages
@@ -97,6 +106,9 @@ func (s *Server) makeRouter() http.Handler {
 		// IndieAuth Server (Part III)
 		r.Get(tokenPath, s.tokenGet) // Backwards compatible token verification endpoint
 		r.Get(userInfoPath, s.userInfoGet)
+
+		// Admin API
+		r.Route(apiPath, s.apiRouter)
 	})
 
 	// Do not server Hugo's 404.html as 200 OK.
@@ -122,6 +134,68 @@ func (s *Server) makeRouter() http.Handler {
 	return r
 }
 
+// panelRouter registers the pages that require the user to be logged in.
+func (s *Server) panelRouter(r chi.Router) {
+	r.Use(s.mustLoggedIn)
+	r.Use(s.mustCSRF)
+
+	// IndieAuth Server (Part II)
+	r.Get(authPath, s.authGet)
+	r.Post(authAcceptPath, s.authAcceptPost)
+
+	// Panel
+	r.Get(panelPath, s.panelGet)
+	r.Post(panelPath, s.panelPost)
+	r.Get(panelPasskeysPath, s.panelPasskeysGet)
+	r.Post(panelPasskeysPath, s.panelPasskeysPost)
+	r.Post(panelPasskeyRegisterBeginPath, s.panelPasskeyRegisterBeginPost)
+	r.Post(panelPasskeyRegisterFinishPath, s.panelPasskeyRegisterFinishPost)
+	r.Get(panelTokensPath, s.panelTokensGet)
+	r.Post(panelTokensPath, s.panelTokensPost)
+	r.Get(panelNewTokenPath, s.panelNewTokenGet)
+	r.Post(panelNewTokenPath, s.panelNewTokenPost)
+	r.Get(panelEditPath+"*", s.panelEditGet)
+	r.Post(panelEditPath+"*", s.panelEditPost)
+
+	r.Group(func(r chi.Router) {
+		r.Use(s.mustPermission(core.PermissionEntries))
+		r.Get(panelNewPath, s.panelNewGet)
+		r.Post(panelNewPath, s.panelNewPost)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(s.mustPermission(core.PermissionFiles))
+		r.Get(panelBrowsePath+"*", s.panelBrowserGet)
+		r.Post(panelBrowsePath+"*", s.panelBrowserPost)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(s.mustPermission(core.PermissionMedia))
+		r.Post(panelCachePath, s.panelCachePost)
+		r.Get(panelMediaPath, s.panelMediaGet)
+		r.Post(panelMediaPath, s.panelMediaPost)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(s.mustPermission(core.PermissionMentions))
+		r.Get(panelMentionsPath, s.panelMentionsGet)
+		r.Post(panelMentionsPath, s.panelMentionsPost)
+		r.Post(panelRulesPath, s.panelMentionRulesPost)
+		r.Get(panelPublishedPath, s.panelPublishedGet)
+		r.Post(panelPublishedPath, s.panelPublishedPost)
+		r.Get(panelSentPath, s.panelSentGet)
+		r.Post(panelSentPath, s.panelSentPost)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(s.mustPermission(core.PermissionAdmin))
+		r.Get(panelQueuePath, s.panelQueueGet)
+		r.Post(panelQueuePath, s.panelQueuePost)
+		r.Get(panelUsersPath, s.panelUsersGet)
+		r.Post(panelUsersPath, s.panelUsersPost)
+	})
+}
+
 func (s *Server) everythingBagelHandler(w http.ResponseWriter, r *http.Request) {
 	if url, ok := s.redirects[r.URL.Path]; ok {
 		http.Redirect(w, r, url, http.StatusMovedPermanently)
@@ -133,6 +207,10 @@ func (s *Server) everythingBagelHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if s.c.Webmentions.Pingback {
+		w.Header().Set("X-Pingback", s.c.AbsoluteURL(pingbackPath))
+	}
+
 	nfw := &notFoundResponseWriter{ResponseWriter: w}
 	s.staticFs.ServeHTTP(nfw, r)
 
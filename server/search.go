@@ -1,56 +1,147 @@
 package server
 
 import (
+	"html/template"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"strconv"
+	"time"
 
 	"go.hacdias.com/eagle/core"
 )
 
 const (
-	searchPath = "/search/"
+	searchPath    = "/search/"
+	searchAPIPath = "/search.json"
 )
 
+// searchFacetParams maps the search facets to their query parameters.
+var searchFacetParams = map[string]string{
+	core.SearchFacetTags:       "tag",
+	core.SearchFacetCategories: "category",
+	core.SearchFacetSection:    "section",
+	core.SearchFacetKind:       "kind",
+	core.SearchFacetLocation:   "location",
+}
+
 type searchPage struct {
-	Entries  core.Entries
-	Query    string
+	// Entries is kept for compatibility with templates that do not show the
+	// snippets in Results.
+	Entries core.Entries
+	Results []*core.SearchResult
+	Total   int
+	Query   string
+
+	// Filters as given in the query parameters.
+	Tag      string
+	Category string
+	Section  string
+	Kind     string
+	Location string
+	From     string
+	To       string
+	Sort     string
+
+	// Facets are the values of each facet among the results, with the URL
+	// that toggles filtering by them.
+	Facets map[string][]searchFacet
+
+	Page     int
 	Previous string
 	Next     string
 }
 
-func (s *Server) searchGet(w http.ResponseWriter, r *http.Request) {
-	page := 0
-	if v := r.URL.Query().Get("page"); v != "" {
+type searchFacet struct {
+	core.SearchFacetValue
+	URL    string
+	Active bool
+}
+
+// runSearch runs the search in the query parameters of the request, such
+// that the HTML page and the JSON API return the same results. On failure,
+// it returns the HTTP status code of the error.
+func (s *Server) runSearch(r *http.Request) (*searchPage, int, error) {
+	rq := r.URL.Query()
+
+	data := &searchPage{
+		Query:    rq.Get("query"),
+		Tag:      rq.Get("tag"),
+		Category: rq.Get("category"),
+		Section:  rq.Get("section"),
+		Kind:     rq.Get("kind"),
+		Location: rq.Get("location"),
+		From:     rq.Get("from"),
+		To:       rq.Get("to"),
+		Sort:     rq.Get("sort"),
+	}
+
+	if v := rq.Get("page"); v != "" {
 		p, _ := strconv.Atoi(v)
 		if p >= 0 {
-			page = p
+			data.Page = p
 		}
 	}
 
-	data := &searchPage{
-		Query: r.URL.Query().Get("query"),
+	query := &core.SearchQuery{
+		Query:    data.Query,
+		Tag:      data.Tag,
+		Category: data.Category,
+		Section:  data.Section,
+		Kind:     data.Kind,
+		Location: data.Location,
+		Page:     data.Page,
+		Limit:    s.c.Site.Pagination.PagerSize,
 	}
 
-	if data.Query != "" {
-		ee, err := s.meilisearch.Search(int64(page), int64(s.c.Site.Pagination.PagerSize), data.Query)
-		if err != nil {
-			s.serveErrorHTML(w, r, http.StatusInternalServerError, err)
-			return
-		}
+	switch data.Sort {
+	case core.SearchSortNewest, core.SearchSortOldest:
+		query.Sort = data.Sort
+	default:
+		query.Sort = core.SearchSortRelevance
+	}
 
-		rq := r.URL.Query()
-		rq.Set("page", strconv.Itoa(page+1))
-		if len(ee) == s.c.Site.Pagination.PagerSize {
-			data.Next = r.URL.Path + "?" + rq.Encode()
-		}
+	var err error
+	query.From, query.To, err = parseSearchDates(data.From, data.To)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
 
-		if page != 0 {
-			rq.Set("page", strconv.Itoa(page-1))
-			data.Previous = r.URL.Path + "?" + rq.Encode()
-		}
+	if query.Query == "" && !query.Filtered() {
+		return data, http.StatusOK, nil
+	}
 
-		data.Entries = ee
+	results, err := s.search.Search(query)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	pq := r.URL.Query()
+	pq.Set("page", strconv.Itoa(data.Page+1))
+	if (data.Page+1)*query.Limit < results.Total {
+		data.Next = r.URL.Path + "?" + pq.Encode()
+	}
+
+	if data.Page != 0 {
+		pq.Set("page", strconv.Itoa(data.Page-1))
+		data.Previous = r.URL.Path + "?" + pq.Encode()
+	}
+
+	data.Results = results.Hits
+	data.Total = results.Total
+	for _, result := range results.Hits {
+		data.Entries = append(data.Entries, result.Entry)
+	}
+
+	data.Facets = searchFacets(r.URL, results.Facets)
+	return data, http.StatusOK, nil
+}
+
+func (s *Server) searchGet(w http.ResponseWriter, r *http.Request) {
+	data, code, err := s.runSearch(r)
+	if err != nil {
+		s.serveErrorHTML(w, r, code, err)
+		return
 	}
 
 	doc, err := s.getDocument(filepath.Join(r.URL.Path, "index.html"))
@@ -61,3 +152,115 @@ func (s *Server) searchGet(w http.ResponseWriter, r *http.Request) {
 
 	s.renderDocument(w, r, doc, http.StatusOK, searchTemplate, data)
 }
+
+type searchAPIResponse struct {
+	Query    string                             `json:"query"`
+	Page     int                                `json:"page"`
+	Total    int                                `json:"total"`
+	Results  []searchAPIResult                  `json:"results"`
+	Facets   map[string][]core.SearchFacetValue `json:"facets"`
+	Previous string                             `json:"previous,omitempty"`
+	Next     string                             `json:"next,omitempty"`
+}
+
+type searchAPIResult struct {
+	Permalink string        `json:"permalink"`
+	Title     string        `json:"title"`
+	Summary   string        `json:"summary"`
+	Date      time.Time     `json:"date,omitzero"`
+	Tags      []string      `json:"tags"`
+	Snippet   template.HTML `json:"snippet"`
+}
+
+func (s *Server) searchAPIGet(w http.ResponseWriter, r *http.Request) {
+	data, code, err := s.runSearch(r)
+	if err != nil {
+		if code == http.StatusInternalServerError {
+			s.log.Errorw("failed to search", "err", err)
+			s.serveErrorJSON(w, code, "server_error", "the search failed")
+		} else {
+			s.serveErrorJSON(w, code, "invalid_request", err.Error())
+		}
+		return
+	}
+
+	res := &searchAPIResponse{
+		Query:    data.Query,
+		Page:     data.Page,
+		Total:    data.Total,
+		Results:  []searchAPIResult{},
+		Facets:   map[string][]core.SearchFacetValue{},
+		Previous: data.Previous,
+		Next:     data.Next,
+	}
+
+	for _, result := range data.Results {
+		res.Results = append(res.Results, searchAPIResult{
+			Permalink: result.Permalink,
+			Title:     result.Title,
+			Summary:   result.Summary(),
+			Date:      result.Date,
+			Tags:      append([]string{}, result.Tags...),
+			Snippet:   result.Snippet,
+		})
+	}
+
+	for facet, values := range data.Facets {
+		for _, value := range values {
+			res.Facets[facet] = append(res.Facets[facet], value.SearchFacetValue)
+		}
+	}
+
+	s.serveJSON(w, http.StatusOK, res)
+}
+
+// parseSearchDates parses the from and to dates, in the YYYY-MM-DD format.
+// Both are inclusive.
+func parseSearchDates(from, to string) (time.Time, time.Time, error) {
+	var fromTime, toTime time.Time
+	var err error
+
+	if from != "" {
+		fromTime, err = time.Parse(time.DateOnly, from)
+		if err != nil {
+			return fromTime, toTime, err
+		}
+	}
+
+	if to != "" {
+		toTime, err = time.Parse(time.DateOnly, to)
+		if err != nil {
+			return fromTime, toTime, err
+		}
+		toTime = toTime.Add(24*time.Hour - time.Second)
+	}
+
+	return fromTime, toTime, nil
+}
+
+// searchFacets adds the URLs that toggle the filter by each facet value to
+// the facets. Changing the filters resets the page.
+func searchFacets(u *url.URL, facets map[string][]core.SearchFacetValue) map[string][]searchFacet {
+	links := map[string][]searchFacet{}
+	for facet, values := range facets {
+		param := searchFacetParams[facet]
+		for _, value := range values {
+			q := u.Query()
+			q.Del("page")
+
+			active := q.Get(param) == value.Value
+			if active {
+				q.Del(param)
+			} else {
+				q.Set(param, value.Value)
+			}
+
+			links[facet] = append(links[facet], searchFacet{
+				SearchFacetValue: value,
+				URL:              u.Path + "?" + q.Encode(),
+				Active:           active,
+			})
+		}
+	}
+	return links
+}
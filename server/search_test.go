@@ -0,0 +1,50 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.hacdias.com/eagle/core"
+	"go.uber.org/zap"
+)
+
+type failingSearchIndex struct {
+	core.SearchIndex
+}
+
+func (failingSearchIndex) Search(q *core.SearchQuery) (*core.SearchResults, error) {
+	return nil, errors.New("index /data/search.db is corrupted")
+}
+
+func TestSearchAPIErrors(t *testing.T) {
+	s := &Server{
+		c:      &core.Config{},
+		log:    zap.NewNop().Sugar(),
+		search: failingSearchIndex{},
+	}
+
+	do := func(query string) (int, map[string]string) {
+		w := httptest.NewRecorder()
+		s.searchAPIGet(w, httptest.NewRequest(http.MethodGet, "/search.json?"+query, nil))
+
+		var res map[string]string
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		return w.Code, res
+	}
+
+	code, res := do("query=cats&from=yesterday")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "invalid_request", res["error"])
+	assert.NotEmpty(t, res["error_description"])
+
+	// The internal errors are not disclosed.
+	code, res = do("query=cats")
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.Equal(t, "server_error", res["error"])
+	assert.NotContains(t, res["error_description"], "corrupted")
+}
@@ -20,13 +20,14 @@ import (
 	"time"
 
 	"github.com/go-chi/jwtauth/v5"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/maypok86/otter/v2"
 	"github.com/robfig/cron/v3"
 	"github.com/samber/lo"
 	"go.hacdias.com/eagle/core"
 	"go.hacdias.com/eagle/log"
+	"go.hacdias.com/eagle/pingback"
 	"go.hacdias.com/eagle/services/media"
-	"go.hacdias.com/eagle/services/meilisearch"
 	"go.hacdias.com/indielib/indieauth"
 
 	"go.uber.org/zap"
@@ -37,7 +38,7 @@ type contextKey string
 var (
 	//go:embed templates/*.html
 	panelTemplatesFS embed.FS
-	panelTemplates   = template.Must(template.ParseFS(panelTemplatesFS, "templates/*.html"))
+	panelTemplates   = template.Must(template.New("").Funcs(panelTemplateFuncs(nil, "", "")).ParseFS(panelTemplatesFS, "templates/*.html"))
 
 	//go:embed assets/*
 	panelAssetsFS embed.FS
@@ -48,8 +49,11 @@ type Server struct {
 	c *core.Config
 
 	log         *zap.SugaredLogger
+	httpClient  *http.Client
 	ias         *indieauth.Server
 	jwtAuth     *jwtauth.JWTAuth
+	denylist    *tokenDenylist
+	webauthn    *webauthn.WebAuthn
 	actions     map[string]func() error
 	plugins     map[string]Plugin
 	syndicators map[string]SyndicationPlugin
@@ -59,14 +63,34 @@ type Server struct {
 	redirects map[string]string
 	gone      map[string]bool
 
+	// postSave tracks the post save hooks running in the background, such
+	// that they finish before the server stops.
+	postSave sync.WaitGroup
+
+	proxyWarning sync.Once
+
+	// entriesMu is locked while the entries are saved, such that the updates
+	// that reload them do not lose any edits.
+	entriesMu sync.Mutex
+
 	serversMu    sync.Mutex
 	servers      map[string]*http.Server
 	onionAddress string
-	meilisearch  *meilisearch.Meilisearch
+	searchMu     sync.Mutex
+	search       core.SearchIndex
+	mailer       core.Mailer
+	pingback     *pingback.Client
+	spam         core.SpamFilter
 	core         *core.Core
 
 	media      *media.Media
 	mediaCache *otter.Cache[string, []byte]
+	clients    *otter.Cache[string, *clientMetadata]
+
+	loginLimiter    *loginLimiter
+	totpSessions    *otter.Cache[string, string]
+	totpUsed        *otter.Cache[string, bool]
+	passkeySessions *otter.Cache[string, *webauthn.SessionData]
 
 	staticFsLock sync.RWMutex
 	staticFs     *staticFs
@@ -79,31 +103,42 @@ func NewServer(c *core.Config) (*Server, error) {
 		return nil, err
 	}
 
+	// The server only fetches URLs given by third parties, such as pingback
+	// sources and IndieAuth clients, which must not reach private addresses.
+	httpClient := core.NewPublicHTTPClient(time.Second * 30)
+
 	s := &Server{
 		c: c,
 
-		log:     log.S().Named("server"),
-		ias:     indieauth.NewServer(false, &http.Client{Timeout: time.Second * 30}),
-		jwtAuth: jwtauth.New("HS256", []byte(base64.StdEncoding.EncodeToString([]byte(c.TokensSecret))), nil),
-		actions: map[string]func() error{},
+		log:        log.S().Named("server"),
+		httpClient: httpClient,
+		ias:        indieauth.NewServer(false, httpClient),
+		jwtAuth:    jwtauth.New("HS256", []byte(base64.StdEncoding.EncodeToString([]byte(c.TokensSecret))), nil),
+		actions:    map[string]func() error{},
 
 		cron: cron.New(),
 
 		redirects: map[string]string{},
 		gone:      map[string]bool{},
 
-		servers: map[string]*http.Server{},
-		core:    co,
-		media:   media.NewMedia(&c.Media),
+		servers:  map[string]*http.Server{},
+		pingback: pingback.New(httpClient),
+		core:     co,
+		media:    media.NewMedia(&c.Media, co.DB()),
 	}
 
 	co.BuildHook = s.buildHook
+	s.media.UseQueue(co.Queue())
+	s.media.TranscodeHook = s.transcodeHook
 
 	err = errors.Join(
 		s.initMediaCache(),
 		s.initNotifier(),
+		s.initLogin(),
+		s.initIndieAuth(),
+		s.initComments(),
 		s.initTemplates(),
-		s.initMeilisearch(),
+		s.initSearch(),
 		s.initPlugins(),
 		s.initQueuePlugins(),
 		s.initSyndicators(),
@@ -118,7 +153,7 @@ func NewServer(c *core.Config) (*Server, error) {
 
 func (s *Server) Start() error {
 	go func() {
-		s.indexAll()
+		s.indexAll(false)
 	}()
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -145,7 +180,11 @@ func (s *Server) Start() error {
 	errCh := make(chan error)
 
 	// Start server(s)
-	err = s.startServer(errCh, router)
+	if s.c.TLS != nil {
+		err = s.startTLSServer(errCh, router)
+	} else {
+		err = s.startServer(errCh, router)
+	}
 	if err != nil {
 		return err
 	}
@@ -199,6 +238,7 @@ func (s *Server) Stop() error {
 		err = errors.Join(err, srv.Shutdown(ctx))
 	}
 
+	s.postSave.Wait()
 	return errors.Join(err, s.core.Close())
 }
 
@@ -229,29 +269,51 @@ func (s *Server) loadGone() error {
 	return nil
 }
 
-func (s *Server) indexAll() {
-	if s.meilisearch == nil {
+// indexAll brings the search index up to date with all entries, or rebuilds
+// it if rebuild is true.
+func (s *Server) indexAll(rebuild bool) {
+	if s.search == nil {
 		return
 	}
 
+	s.searchMu.Lock()
+	defer s.searchMu.Unlock()
+
 	entries, err := s.core.GetEntries(false)
 	if err != nil {
 		s.log.Errorw("failed to get entries", "err", err)
 		return
 	}
 
-	err = s.meilisearch.ResetIndex()
+	start := time.Now()
+	updated, removed, err := core.SyncSearchIndex(s.search, entries, rebuild)
 	if err != nil {
-		s.log.Errorw("failed to reset meilisearch index", "err", err)
+		s.log.Errorw("failed to sync search index", "err", err)
+		return
 	}
+	s.log.Infow("search index synced", "updated", updated, "removed", removed, "duration", time.Since(start))
+}
 
-	start := time.Now()
-	err = s.meilisearch.Add(entries...)
-	if err != nil {
-		s.log.Errorw("failed to add to meilisearch index", "err", err)
+// indexEntry adds the entry to the search index, or removes it if it is not
+// searchable. It waits for any ongoing [Server.indexAll], such that the change
+// is neither lost by a rebuild nor races with it.
+func (s *Server) indexEntry(e *core.Entry) {
+	if s.search == nil {
+		return
 	}
-	s.log.Infof("meilisearch update took %dms", time.Since(start).Milliseconds())
 
+	s.searchMu.Lock()
+	defer s.searchMu.Unlock()
+
+	var err error
+	if e.Searchable() {
+		err = s.search.Add(e)
+	} else {
+		err = s.search.Remove(e.ID)
+	}
+	if err != nil {
+		s.log.Errorw("search sync failed", "err", err)
+	}
 }
 
 func (s *Server) withRecoverer(next http.Handler) http.Handler {
@@ -283,15 +345,6 @@ func withCleanPath(next http.Handler) http.Handler {
 	})
 }
 
-func (s *Server) withSecurityHeaders(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Referrer-Policy", "no-referrer")
-		w.Header().Set("X-Frame-Options", "SAMEORIGIN")
-		w.Header().Set("X-XSS-Protection", "1; mode=block")
-		next.ServeHTTP(w, r)
-	})
-}
-
 func (s *Server) syncStorage() {
 	changedFiles, err := s.core.Sync()
 	if err != nil {
@@ -422,6 +475,62 @@ func (s *Server) build(clean bool) {
 	}
 }
 
+// transcodeHook replaces the original video or audio file by its transcoded
+// rendition in the entries that were saved before it was transcoded. They are
+// committed by Eagle itself.
+func (s *Server) transcodeHook(original string, upload *media.Upload) {
+	ee, err := s.core.GetEntries(false)
+	if err != nil {
+		s.log.Errorw("failed to get entries", "err", err)
+		return
+	}
+
+	options := postSaveEntryOptions{
+		author: s.systemCommitAuthor(),
+	}
+
+	for _, e := range ee {
+		// The entries are only matched here, and replaced once reloaded.
+		if !replaceTranscodedMedia(e, original, upload) {
+			continue
+		}
+
+		_, err = s.updateEntryWithHooks(e.ID, options, func(e *core.Entry) bool {
+			return replaceTranscodedMedia(e, original, upload)
+		})
+		if err != nil {
+			s.log.Errorw("failed to save entry", "id", e.ID, "err", err)
+		}
+	}
+}
+
+// replaceTranscodedMedia replaces the videos or audio of the entry whose URL is
+// the original by the transcoded upload, keeping their titles. It returns
+// whether the entry was changed.
+func replaceTranscodedMedia(e *core.Entry, original string, upload *media.Upload) bool {
+	changed := false
+
+	for i := range e.Videos {
+		if upload.Video != nil && e.Videos[i].URL == original {
+			title := e.Videos[i].Title
+			e.Videos[i] = *upload.Video
+			e.Videos[i].Title = title
+			changed = true
+		}
+	}
+
+	for i := range e.Audio {
+		if upload.Audio != nil && e.Audio[i].URL == original {
+			title := e.Audio[i].Title
+			e.Audio[i] = *upload.Audio
+			e.Audio[i].Title = title
+			changed = true
+		}
+	}
+
+	return changed
+}
+
 func (s *Server) buildHook(dir string) {
 	s.log.Infof("received new public directory: %s", dir)
 
@@ -2,15 +2,21 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"html/template"
 	"net/url"
 	"path/filepath"
 	"time"
 
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/maypok86/otter/v2"
+	"go.hacdias.com/eagle/core"
 	"go.hacdias.com/eagle/log"
+	"go.hacdias.com/eagle/services/bayes"
 	"go.hacdias.com/eagle/services/meilisearch"
+	"go.hacdias.com/eagle/services/smtp"
+	"go.hacdias.com/eagle/services/sqlitesearch"
 	"go.hacdias.com/eagle/services/telegram"
 )
 
@@ -27,6 +33,46 @@ func (s *Server) initMediaCache() error {
 	return err
 }
 
+func (s *Server) initLogin() error {
+	passkeys, err := s.getPasskeys(context.Background(), s.configUser())
+	if err != nil {
+		return err
+	}
+
+	if s.c.Login.Password == "" && len(passkeys) == 0 {
+		return errors.New("login.password is empty and no passkeys are registered")
+	}
+
+	s.webauthn, err = webauthn.New(&webauthn.Config{
+		RPID:          s.core.BaseURL().Hostname(),
+		RPDisplayName: s.c.Site.Title,
+		RPOrigins:     []string{s.c.Site.BaseURL},
+	})
+	if err != nil {
+		return err
+	}
+
+	s.loginLimiter = newLoginLimiter()
+
+	s.totpSessions = otter.Must(&otter.Options[string, string]{
+		MaximumSize:      1000,
+		ExpiryCalculator: otter.ExpiryWriting[string, string](totpSessionExpiry),
+	})
+
+	// Codes are valid for up to three periods of 30 seconds, including the
+	// allowed skew.
+	s.totpUsed = otter.Must(&otter.Options[string, bool]{
+		MaximumSize:      1000,
+		ExpiryCalculator: otter.ExpiryWriting[string, bool](time.Second * 90),
+	})
+
+	s.passkeySessions, err = otter.New(&otter.Options[string, *webauthn.SessionData]{
+		MaximumSize:      1000,
+		ExpiryCalculator: otter.ExpiryWriting[string, *webauthn.SessionData](passkeySessionExpiry),
+	})
+	return err
+}
+
 func (s *Server) initNotifier() error {
 	var err error
 	if s.c.Notifications.Telegram != nil {
@@ -58,10 +104,21 @@ func (s *Server) initTemplates() error {
 	return nil
 }
 
-func (s *Server) initMeilisearch() error {
+func (s *Server) initComments() error {
+	s.spam = bayes.NewBayes(s.core.DB())
+	if s.c.Comments.SMTP != nil {
+		s.mailer = smtp.NewSMTP(s.c.Comments.SMTP)
+	}
+	return nil
+}
+
+func (s *Server) initSearch() error {
 	var err error
-	if s.c.Meilisearch != nil {
-		s.meilisearch, err = meilisearch.NewMeilisearch(s.c.Meilisearch.Endpoint, s.c.Meilisearch.Key, s.core)
+	switch s.c.Search.Backend {
+	case core.SearchMeilisearch:
+		s.search, err = meilisearch.NewMeilisearch(s.c.Meilisearch.Endpoint, s.c.Meilisearch.Key, s.core)
+	case core.SearchSQLite:
+		s.search, err = sqlitesearch.NewSQLiteSearch(s.core)
 	}
 	return err
 }
@@ -118,8 +175,8 @@ func (s *Server) initActions() error {
 			go s.syncStorage()
 			return nil
 		},
-		"Reset Index": func() error {
-			s.indexAll()
+		"Rebuild Search Index": func() error {
+			go s.indexAll(true)
 			return nil
 		},
 		"Reload Redirects": s.loadRedirects,
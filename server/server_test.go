@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.hacdias.com/eagle/core"
+	"go.hacdias.com/eagle/services/media"
+	"go.uber.org/zap"
+)
+
+// newTestServer returns a server with a core on temporary directories, without
+// git, search nor plugins. The owner from the configuration is "owner", and
+// the database has the author "alice" and the moderator "mod".
+func newTestServer(t *testing.T) *Server {
+	c := &core.Config{
+		ServerConfig: core.ServerConfig{
+			Development:     true,
+			SourceDirectory: t.TempDir(),
+			PublicDirectory: t.TempDir(),
+			DataDirectory:   t.TempDir(),
+			TokensSecret:    "secret",
+			Login:           core.Login{Username: "owner"},
+		},
+		Site: core.SiteConfig{BaseURL: "https://example.com"},
+	}
+
+	co, err := core.NewCore(c)
+	require.NoError(t, err)
+	s := &Server{
+		c:        c,
+		log:      zap.NewNop().Sugar(),
+		core:     co,
+		jwtAuth:  jwtauth.New("HS256", []byte("secret"), nil),
+		denylist: &tokenDenylist{ids: map[string]time.Time{}},
+		actions:  map[string]func() error{},
+	}
+
+	t.Cleanup(func() {
+		s.postSave.Wait()
+		_ = co.Close()
+	})
+
+	for _, user := range []*core.User{
+		{Username: "alice", Role: core.RoleAuthor, URL: "https://example.com/authors/alice/"},
+		{Username: "mod", Role: core.RoleModerator, URL: "https://example.com/authors/mod/"},
+	} {
+		require.NoError(t, co.DB().CreateUser(context.Background(), user))
+	}
+
+	return s
+}
+
+// writeTestFile writes the file to the source directory of the server.
+func writeTestFile(t *testing.T, s *Server, filename, content string) {
+	filename = filepath.Join(s.c.SourceDirectory, filename)
+	require.NoError(t, os.MkdirAll(filepath.Dir(filename), 0777))
+	require.NoError(t, os.WriteFile(filename, []byte(content), 0666))
+}
+
+// testAccessToken returns a JWT access token of the user with the scope.
+func testAccessToken(t *testing.T, s *Server, username, scope string) string {
+	_, signed, err := s.jwtAuth.Encode(map[string]any{
+		jwt.SubjectKey:    accessTokenSubject,
+		jwt.JwtIDKey:      username + ":" + scope,
+		jwt.IssuedAtKey:   time.Now().Unix(),
+		jwt.ExpirationKey: time.Now().Add(time.Hour).Unix(),
+		"username":        username,
+		"scope":           scope,
+	})
+	require.NoError(t, err)
+	return signed
+}
+
+// testAPIRequest makes a request to the API with the token.
+func testAPIRequest(s *Server, method, path, token, body string) *httptest.ResponseRecorder {
+	r := chi.NewRouter()
+	r.Group(func(r chi.Router) {
+		r.Use(s.mustIndieAuth)
+		r.Route(apiPath, s.apiRouter)
+	})
+
+	req := httptest.NewRequest(method, apiPath+path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// withFakeHugo replaces the hugo binary by one that builds nothing, such that
+// the entries can be saved.
+func withFakeHugo(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hugo"), []byte("#!/bin/sh\nexit 0\n"), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// withTestUser logs in the requests as the user, without the database.
+func withTestUser(user *core.User, session *core.Token) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), loggedInContextKey, true)
+			ctx = context.WithValue(ctx, sessionContextKey, session)
+			ctx = context.WithValue(ctx, userContextKey, user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func TestReplaceTranscodedMedia(t *testing.T) {
+	e := &core.Entry{FrontMatter: core.FrontMatter{
+		Videos: []core.Video{
+			{URL: "https://media.example.com/clip.mov", Title: "Clip"},
+			{URL: "https://media.example.com/other.mov"},
+		},
+		Audio: []core.Audio{{URL: "https://media.example.com/clip.mov"}},
+	}}
+
+	assert.False(t, replaceTranscodedMedia(e, "https://media.example.com/none.mov", &media.Upload{Video: &core.Video{}}))
+
+	assert.True(t, replaceTranscodedMedia(e, "https://media.example.com/clip.mov", &media.Upload{Video: &core.Video{
+		URL:      "https://media.example.com/video/clip.mp4",
+		MimeType: "video/mp4",
+		Poster:   "image:clip-poster",
+	}}))
+	assert.Equal(t, core.Video{
+		URL:      "https://media.example.com/video/clip.mp4",
+		Title:    "Clip",
+		MimeType: "video/mp4",
+		Poster:   "image:clip-poster",
+	}, e.Videos[0])
+	assert.Equal(t, "https://media.example.com/other.mov", e.Videos[1].URL)
+	assert.Equal(t, "https://media.example.com/clip.mov", e.Audio[0].URL)
+}
+
+func TestTranscodeHook(t *testing.T) {
+	withFakeHugo(t)
+	s := newTestServer(t)
+
+	writeTestFile(t, s, s.core.EntryFilenameFromID("/clip/"), "---\ntitle: Clip\nvideos:\n  - url: https://media.example.com/clip.mov\n    title: My Clip\n---\n\nA clip.\n")
+	writeTestFile(t, s, s.core.EntryFilenameFromID("/other/"), "---\ntitle: Other\n---\n\nNo clip.\n")
+
+	s.transcodeHook("https://media.example.com/clip.mov", &media.Upload{Video: &core.Video{
+		URL:      "https://media.example.com/video/clip.mp4",
+		MimeType: "video/mp4",
+	}})
+
+	e, err := s.core.GetEntry("/clip/")
+	require.NoError(t, err)
+	assert.Equal(t, []core.Video{{
+		URL:      "https://media.example.com/video/clip.mp4",
+		Title:    "My Clip",
+		MimeType: "video/mp4",
+	}}, e.Videos)
+	assert.Equal(t, "A clip.", strings.TrimSpace(e.Content))
+
+	// Entries are only saved if they changed.
+	saved, err := s.updateEntryWithHooks("/other/", postSaveEntryOptions{}, func(e *core.Entry) bool {
+		return false
+	})
+	require.NoError(t, err)
+	assert.False(t, saved)
+
+	assert.Equal(t, &core.CommitAuthor{Name: "Eagle", Email: "eagle@example.com"}, s.systemCommitAuthor())
+}
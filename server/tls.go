@@ -0,0 +1,139 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// newCertManager returns the manager of the certificates of the host of the
+// website, which are obtained and renewed on demand, and stored in the data
+// directory.
+func (s *Server) newCertManager() (*autocert.Manager, error) {
+	base, err := url.Parse(s.c.Site.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if base.Scheme != "https" {
+		return nil, errors.New("tls: baseURL must use https")
+	}
+
+	client := &acme.Client{
+		DirectoryURL: s.c.TLS.DirectoryURL,
+	}
+
+	if s.c.TLS.CACertificate != "" {
+		pem, err := os.ReadFile(s.c.TLS.CACertificate)
+		if err != nil {
+			return nil, err
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls: no certificates found in %s", s.c.TLS.CACertificate)
+		}
+
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+		client.HTTPClient = &http.Client{Transport: transport}
+	}
+
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(filepath.Join(s.c.DataDirectory, "certificates")),
+		HostPolicy: autocert.HostWhitelist(base.Hostname()),
+		Email:      s.c.TLS.Email,
+		Client:     client,
+	}, nil
+}
+
+// startTLSServer serves the website over HTTPS on the TLS port, with HTTP/2,
+// and answers the TLS-ALPN-01 challenges. The HTTP port answers the HTTP-01
+// challenges, and redirects everything else to HTTPS.
+func (s *Server) startTLSServer(errCh chan error, h http.Handler) error {
+	m, err := s.newCertManager()
+	if err != nil {
+		return err
+	}
+
+	base, err := url.Parse(s.c.Site.BaseURL)
+	if err != nil {
+		return err
+	}
+
+	httpLn, err := net.Listen("tcp", ":"+strconv.Itoa(s.c.Port))
+	if err != nil {
+		return err
+	}
+
+	httpsLn, err := net.Listen("tcp", ":"+strconv.Itoa(s.c.TLS.Port))
+	if err != nil {
+		_ = httpLn.Close()
+		return err
+	}
+
+	httpSrv := &http.Server{
+		Handler:           m.HTTPHandler(httpsRedirect(base.Hostname(), s.c.TLS.Port)),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	s.registerServer(httpSrv, "http")
+
+	// The configuration of the manager enables HTTP/2 and the TLS-ALPN-01
+	// challenges.
+	httpsSrv := &http.Server{
+		Handler:           h,
+		TLSConfig:         m.TLSConfig(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	s.registerServer(httpsSrv, "public")
+
+	go func() {
+		s.log.Infof("listening on %s", httpLn.Addr().String())
+		errCh <- httpSrv.Serve(httpLn)
+	}()
+
+	go func() {
+		s.log.Infof("listening on %s with TLS", httpsLn.Addr().String())
+		errCh <- httpsSrv.ServeTLS(httpsLn, "", "")
+	}()
+
+	return nil
+}
+
+// httpsRedirect permanently redirects the requests to the same path over HTTPS,
+// on the given host and port. The host of the request is not used, as it is
+// chosen by the client.
+func httpsRedirect(hostname string, port int) http.Handler {
+	host := hostname
+	if port != 443 {
+		host = net.JoinHostPort(hostname, strconv.Itoa(port))
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := url.URL{
+			Scheme:   "https",
+			Host:     host,
+			Path:     r.URL.Path,
+			RawPath:  r.URL.RawPath,
+			RawQuery: r.URL.RawQuery,
+		}
+
+		http.Redirect(w, r, target.String(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.hacdias.com/eagle/core"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/acme"
+)
+
+func TestHTTPSRedirect(t *testing.T) {
+	for _, c := range []struct {
+		port     int
+		url      string
+		location string
+	}{
+		{443, "http://example.com/", "https://example.com/"},
+		{443, "http://example.com:80/a%2Fb?q=1", "https://example.com/a%2Fb?q=1"},
+		{8443, "http://example.com:8080/path/", "https://example.com:8443/path/"},
+		{443, "http://evil.com/path", "https://example.com/path"},
+	} {
+		w := httptest.NewRecorder()
+		httpsRedirect("example.com", c.port).ServeHTTP(w, httptest.NewRequest(http.MethodPost, c.url, nil))
+		assert.Equal(t, http.StatusPermanentRedirect, w.Code, c.url)
+		assert.Equal(t, c.location, w.Header().Get("Location"), c.url)
+	}
+}
+
+func TestCertManager(t *testing.T) {
+	s := &Server{
+		c: &core.Config{
+			ServerConfig: core.ServerConfig{
+				DataDirectory: t.TempDir(),
+				TLS:           &core.TLS{Port: 443},
+			},
+			Site: core.SiteConfig{BaseURL: "http://example.com"},
+		},
+	}
+
+	_, err := s.newCertManager()
+	assert.Error(t, err)
+
+	s.c.Site.BaseURL = "https://example.com"
+	m, err := s.newCertManager()
+	require.NoError(t, err)
+
+	assert.NoError(t, m.HostPolicy(context.Background(), "example.com"))
+	assert.Error(t, m.HostPolicy(context.Background(), "other.com"))
+
+	protos := m.TLSConfig().NextProtos
+	assert.Contains(t, protos, "h2")
+	assert.Contains(t, protos, acme.ALPNProto)
+}
+
+// TestACME obtains a certificate from a local ACME test server, such as Pebble
+// (https://github.com/letsencrypt/pebble). It is skipped unless the directory
+// is given in EAGLE_TEST_ACME_DIRECTORY, with the certificate of the server in
+// EAGLE_TEST_ACME_CA. The test server must validate the challenges of
+// EAGLE_TEST_ACME_HOST (default localhost) on ports 5002 (HTTP-01) and 5001
+// (TLS-ALPN-01), which are the defaults of Pebble.
+func TestACME(t *testing.T) {
+	directory := os.Getenv("EAGLE_TEST_ACME_DIRECTORY")
+	if directory == "" {
+		t.Skip("EAGLE_TEST_ACME_DIRECTORY not set")
+	}
+
+	host := os.Getenv("EAGLE_TEST_ACME_HOST")
+	if host == "" {
+		host = "localhost"
+	}
+
+	tlsConfig := &core.TLS{
+		Port:          5001,
+		DirectoryURL:  directory,
+		CACertificate: os.Getenv("EAGLE_TEST_ACME_CA"),
+	}
+
+	s := &Server{
+		c: &core.Config{
+			ServerConfig: core.ServerConfig{
+				DataDirectory: t.TempDir(),
+				Port:          5002,
+				TLS:           tlsConfig,
+			},
+			Site: core.SiteConfig{BaseURL: "https://" + host},
+		},
+		log:     zap.NewNop().Sugar(),
+		servers: map[string]*http.Server{},
+	}
+
+	errCh := make(chan error, 2)
+	err := s.startTLSServer(errCh, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto))
+	}))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		for _, srv := range s.servers {
+			_ = srv.Close()
+		}
+	})
+
+	// The plain HTTP requests are redirected.
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	res, err := client.Get("http://127.0.0.1:5002/path")
+	require.NoError(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusPermanentRedirect, res.StatusCode)
+	assert.Equal(t, "https://"+net.JoinHostPort(host, "5001")+"/path", res.Header.Get("Location"))
+
+	// The certificate is obtained on the first handshake, and HTTP/2 is
+	// negotiated.
+	dialer := &net.Dialer{Timeout: time.Minute}
+	conn, err := tls.DialWithDialer(dialer, "tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(tlsConfig.Port)), &tls.Config{
+		ServerName:         host,
+		NextProtos:         []string{"h2", "http/1.1"},
+		InsecureSkipVerify: true, // Issued by the test server's own root.
+	})
+	require.NoError(t, err)
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	state := conn.ConnectionState()
+	assert.Equal(t, "h2", state.NegotiatedProtocol)
+	require.NotEmpty(t, state.PeerCertificates)
+	assert.NoError(t, state.PeerCertificates[0].VerifyHostname(host))
+}
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+	"github.com/maypok86/otter/v2"
+	"go.hacdias.com/eagle/core"
+)
+
+const (
+	accessTokenSubject string = "Eagle Access Token"
+
+	tokenRevokePath = tokenPath + "/revoke"
+)
+
+var errInvalidToken = errors.New("invalid token")
+
+// tokenDenylist keeps the IDs of the revoked JWT access tokens in memory, so
+// that they can be verified without the database.
+type tokenDenylist struct {
+	mu  sync.RWMutex
+	ids map[string]time.Time
+}
+
+func (d *tokenDenylist) add(id string, expiry time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	for id, expiry := range d.ids {
+		if !expiry.IsZero() && expiry.Before(now) {
+			delete(d.ids, id)
+		}
+	}
+
+	d.ids[id] = expiry
+}
+
+func (d *tokenDenylist) has(id string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	_, ok := d.ids[id]
+	return ok
+}
+
+func (s *Server) initIndieAuth() error {
+	tokens, err := s.core.DB().GetDeniedTokens(context.Background())
+	if err != nil {
+		return err
+	}
+
+	s.denylist = &tokenDenylist{ids: map[string]time.Time{}}
+	for _, token := range tokens {
+		s.denylist.ids[token.ID] = token.Expiry
+	}
+
+	s.clients = otter.Must(&otter.Options[string, *clientMetadata]{
+		MaximumSize:      1000,
+		ExpiryCalculator: otter.ExpiryWriting[string, *clientMetadata](time.Minute * 10),
+	})
+
+	return nil
+}
+
+// verifyAccessToken returns the access token with the given secret, which is
+// either a JWT or a stored token, if it is valid.
+func (s *Server) verifyAccessToken(ctx context.Context, secret string) (*core.Token, error) {
+	if strings.Count(secret, ".") == 2 {
+		return s.verifyJWTAccessToken(secret)
+	}
+
+	token, err := s.core.DB().GetToken(ctx, core.HashToken(secret), core.TokenTypeAccess)
+	if err != nil {
+		return nil, errInvalidToken
+	}
+
+	if !token.Expiry.IsZero() && token.Expiry.Before(time.Now()) {
+		return nil, errors.New("token expired")
+	}
+
+	return token, nil
+}
+
+func (s *Server) verifyJWTAccessToken(secret string) (*core.Token, error) {
+	// Expiry is validated as part of the verification.
+	jwtToken, err := jwtauth.VerifyToken(s.jwtAuth, secret)
+	if err != nil {
+		return nil, errInvalidToken
+	}
+
+	if subject, _ := jwtToken.Subject(); subject != accessTokenSubject {
+		return nil, errInvalidToken
+	}
+
+	id, _ := jwtToken.JwtID()
+	if id == "" || s.denylist.has(id) {
+		return nil, errInvalidToken
+	}
+
+	token := &core.Token{
+		ID:       id,
+		Type:     core.TokenTypeAccess,
+		Username: getString(jwtToken, "username"),
+		ClientID: getString(jwtToken, "client_id"),
+		Scope:    getString(jwtToken, "scope"),
+		JWT:      true,
+	}
+	token.Created, _ = jwtToken.IssuedAt()
+	token.Expiry, _ = jwtToken.Expiration()
+	return token, nil
+}
+
+// generateJWTAccessToken issues a signed JWT access token. The token is stored
+// as well, by its JWT ID, so that it can be listed and revoked.
+func (s *Server) generateJWTAccessToken(ctx context.Context, token *core.Token) (string, error) {
+	claims := map[string]any{
+		jwt.SubjectKey:  accessTokenSubject,
+		jwt.JwtIDKey:    token.ID,
+		jwt.IssuedAtKey: token.Created.Unix(),
+		"username":      token.Username,
+		"client_id":     token.ClientID,
+		"scope":         token.Scope,
+	}
+	if !token.Expiry.IsZero() {
+		claims[jwt.ExpirationKey] = token.Expiry.Unix()
+	}
+
+	_, signed, err := s.jwtAuth.Encode(claims)
+	if err != nil {
+		return "", err
+	}
+
+	token.JWT = true
+	return signed, s.core.DB().CreateToken(ctx, token)
+}
+
+// revokeToken deletes the token and, if it is a JWT, adds it to the denylist.
+func (s *Server) revokeToken(ctx context.Context, token *core.Token) error {
+	if token.JWT {
+		err := s.core.DB().DenyToken(ctx, &core.DeniedToken{
+			ID:     token.ID,
+			Expiry: token.Expiry,
+		})
+		if err != nil {
+			return err
+		}
+		s.denylist.add(token.ID, token.Expiry)
+	}
+
+	return s.core.DB().DeleteToken(ctx, token.ID)
+}
+
+// revokeTokenSecret revokes the access or refresh token with the given secret.
+// Invalid tokens are ignored.
+func (s *Server) revokeTokenSecret(ctx context.Context, secret string) error {
+	token, err := s.verifyAccessToken(ctx, secret)
+	if err == nil {
+		return s.revokeToken(ctx, token)
+	}
+
+	token, err = s.core.DB().GetToken(ctx, core.HashToken(secret), core.TokenTypeRefresh)
+	if err == nil {
+		return s.revokeToken(ctx, token)
+	}
+
+	return nil
+}
+
+// tokenRevokePost implements the token revocation endpoint, as specified by
+// RFC 7009. Since IndieAuth clients are public, no client authentication is
+// required: knowing the token is enough to revoke it.
+//
+// https://datatracker.ietf.org/doc/html/rfc7009
+func (s *Server) tokenRevokePost(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		s.serveErrorJSON(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	secret := r.Form.Get("token")
+	if secret == "" {
+		s.serveErrorJSON(w, http.StatusBadRequest, "invalid_request", "missing token")
+		return
+	}
+
+	// The token type hint is optional, and all token types are checked anyway.
+	if err := s.revokeTokenSecret(r.Context(), secret); err != nil {
+		s.serveErrorJSON(w, http.StatusServiceUnavailable, "server_error", err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
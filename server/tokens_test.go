@@ -0,0 +1,60 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyJWTAccessToken(t *testing.T) {
+	s := &Server{
+		jwtAuth:  jwtauth.New("HS256", []byte("secret"), nil),
+		denylist: &tokenDenylist{ids: map[string]time.Time{}},
+	}
+
+	encode := func(claims map[string]any) string {
+		_, signed, err := s.jwtAuth.Encode(claims)
+		require.NoError(t, err)
+		return signed
+	}
+
+	expiry := time.Now().Add(time.Hour)
+	signed := encode(map[string]any{
+		jwt.SubjectKey:    accessTokenSubject,
+		jwt.JwtIDKey:      "id",
+		jwt.IssuedAtKey:   time.Now().Unix(),
+		jwt.ExpirationKey: expiry.Unix(),
+		"client_id":       "https://example.com/",
+		"scope":           "create update",
+	})
+
+	token, err := s.verifyJWTAccessToken(signed)
+	require.NoError(t, err)
+	assert.Equal(t, "id", token.ID)
+	assert.Equal(t, "https://example.com/", token.ClientID)
+	assert.Equal(t, "create update", token.Scope)
+	assert.Equal(t, expiry.Unix(), token.Expiry.Unix())
+	assert.True(t, token.JWT)
+
+	s.denylist.add("id", expiry)
+	_, err = s.verifyJWTAccessToken(signed)
+	assert.ErrorIs(t, err, errInvalidToken)
+
+	// Authorization codes are signed with the same key.
+	_, err = s.verifyJWTAccessToken(encode(map[string]any{
+		jwt.SubjectKey: authCodeSubject,
+		jwt.JwtIDKey:   "other",
+	}))
+	assert.ErrorIs(t, err, errInvalidToken)
+
+	_, err = s.verifyJWTAccessToken(encode(map[string]any{
+		jwt.SubjectKey:    accessTokenSubject,
+		jwt.JwtIDKey:      "expired",
+		jwt.ExpirationKey: time.Now().Add(-time.Hour).Unix(),
+	}))
+	assert.ErrorIs(t, err, errInvalidToken)
+}
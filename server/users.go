@@ -0,0 +1,237 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.hacdias.com/eagle/core"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	userContextKey contextKey = "user"
+
+	panelUsersPath = panelPath + "/users"
+
+	// usersPath is where the default profile URLs of the users are, which
+	// are their IndieAuth identity. The website must serve them.
+	usersPath = "/authors/"
+)
+
+// errNotAllowed is returned when the user does not have the permission to do
+// something.
+var errNotAllowed = errors.New("you are not allowed to do this")
+
+// configUser returns the owner defined in the configuration, whose profile is
+// the website itself.
+func (s *Server) configUser() *core.User {
+	return &core.User{
+		Username: s.c.Login.Username,
+		Name:     s.c.Site.Params.Author.Name,
+		Email:    s.c.Site.Params.Author.Email,
+		URL:      s.c.ID(),
+		Role:     core.RoleOwner,
+		Password: s.c.Login.Password,
+		TOTP:     s.c.Login.TOTP,
+	}
+}
+
+// isConfigUser returns whether the username is the one of the owner defined
+// in the configuration. Tokens and passkeys from before there were multiple
+// users have no username and belong to them.
+func (s *Server) isConfigUser(username string) bool {
+	return username == "" || username == s.c.Login.Username
+}
+
+// usernames returns the usernames under which the passkeys and tokens of the
+// user are stored. The owner from the configuration also owns the ones from
+// before there were multiple users, which have no username.
+func (s *Server) usernames(user *core.User) []string {
+	if s.isConfigUser(user.Username) {
+		return []string{"", user.Username}
+	}
+
+	return []string{user.Username}
+}
+
+// getUserByUsername returns the user with the given username, either the owner
+// from the configuration, or one from the database.
+func (s *Server) getUserByUsername(ctx context.Context, username string) (*core.User, error) {
+	if s.isConfigUser(username) {
+		return s.configUser(), nil
+	}
+
+	return s.core.DB().GetUser(ctx, username)
+}
+
+// getUser returns the user that is logged in, or authorized by the token.
+func (s *Server) getUser(r *http.Request) *core.User {
+	user, _ := r.Context().Value(userContextKey).(*core.User)
+	return user
+}
+
+// getCommitAuthor returns the author of the commits made in the request. The
+// owner from the configuration uses the git identity of the repository.
+func (s *Server) getCommitAuthor(r *http.Request) *core.CommitAuthor {
+	user := s.getUser(r)
+	if user == nil || s.isConfigUser(user.Username) {
+		return nil
+	}
+
+	return user.CommitAuthor()
+}
+
+// systemCommitAuthor returns the author of the commits made by Eagle itself,
+// such as from the background jobs.
+func (s *Server) systemCommitAuthor() *core.CommitAuthor {
+	host := "localhost"
+	if u, err := url.Parse(s.c.Site.BaseURL); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+
+	return &core.CommitAuthor{
+		Name:  "Eagle",
+		Email: "eagle@" + host,
+	}
+}
+
+// canEditEntry returns whether the user can edit the entry: either they can
+// edit all entries, or it is their own.
+func canEditEntry(user *core.User, e *core.Entry) bool {
+	return user.Can(core.PermissionAllEntries) ||
+		(user.Can(core.PermissionEntries) && e.Author == user.Username)
+}
+
+// mustPermission only allows the logged in users with the given permission.
+// It must be used after [Server.mustLoggedIn].
+func (s *Server) mustPermission(p core.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := s.getUser(r)
+			if user == nil || !user.Can(p) {
+				s.panelError(w, r, http.StatusForbidden, errNotAllowed)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type usersPage struct {
+	Title string
+	Owner *core.User
+	Users []*core.User
+	Roles []core.Role
+}
+
+func (s *Server) panelUsersGet(w http.ResponseWriter, r *http.Request) {
+	users, err := s.core.DB().GetUsers(r.Context())
+	if err != nil {
+		s.panelError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.panelTemplate(w, r, http.StatusOK, panelUsersTemplate, &usersPage{
+		Title: "Users",
+		Owner: s.configUser(),
+		Users: users,
+		Roles: core.Roles,
+	})
+}
+
+func (s *Server) panelUsersPost(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		s.panelError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	username := strings.TrimSpace(r.Form.Get("username"))
+	if s.isConfigUser(username) {
+		s.panelError(w, r, http.StatusBadRequest, errors.New("the owner from the configuration cannot be changed"))
+		return
+	}
+
+	var (
+		user *core.User
+		err  error
+	)
+
+	switch r.Form.Get("action") {
+	case "create":
+		user = &core.User{
+			Username: username,
+			Created:  time.Now(),
+		}
+	case "update":
+		user, err = s.core.DB().GetUser(r.Context(), username)
+		if err != nil {
+			s.panelError(w, r, http.StatusNotFound, err)
+			return
+		}
+	case "delete":
+		err = s.core.DB().DeleteUser(r.Context(), username)
+		if err != nil {
+			s.panelError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		http.Redirect(w, r, panelUsersPath, http.StatusSeeOther)
+		return
+	default:
+		s.panelError(w, r, http.StatusBadRequest, errors.New("invalid action"))
+		return
+	}
+
+	user.Name = strings.TrimSpace(r.Form.Get("name"))
+	user.Email = strings.TrimSpace(r.Form.Get("email"))
+	user.URL = strings.TrimSpace(r.Form.Get("url"))
+	user.Role = core.Role(r.Form.Get("role"))
+	if user.URL == "" {
+		user.URL = s.c.AbsoluteURL(usersPath + user.Username + "/")
+	}
+
+	// The password is only changed if given.
+	if password := r.Form.Get("password"); password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			s.panelError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		user.Password = string(hash)
+	}
+
+	// The TOTP secret is never shown back, and is thus only replaced if given,
+	// or removed through the explicit checkbox.
+	if secret := strings.TrimSpace(r.Form.Get("totp")); secret != "" {
+		user.TOTP = secret
+	} else if r.Form.Get("disable_totp") == "true" {
+		user.TOTP = ""
+	}
+
+	if user.Password == "" {
+		s.panelError(w, r, http.StatusBadRequest, errors.New("password is required"))
+		return
+	}
+
+	if err := user.Validate(); err != nil {
+		s.panelError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if r.Form.Get("action") == "create" {
+		err = s.core.DB().CreateUser(r.Context(), user)
+	} else {
+		err = s.core.DB().UpdateUser(r.Context(), user)
+	}
+	if err != nil {
+		s.panelError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	http.Redirect(w, r, panelUsersPath, http.StatusSeeOther)
+}
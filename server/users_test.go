@@ -0,0 +1,223 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.hacdias.com/eagle/core"
+)
+
+func TestCanEditEntry(t *testing.T) {
+	e := &core.Entry{FrontMatter: core.FrontMatter{Author: "alice"}}
+
+	for _, c := range []struct {
+		user    *core.User
+		canEdit bool
+	}{
+		{&core.User{Username: "owner", Role: core.RoleOwner}, true},
+		{&core.User{Username: "bob", Role: core.RoleEditor}, true},
+		{&core.User{Username: "alice", Role: core.RoleAuthor}, true},
+		{&core.User{Username: "bob", Role: core.RoleAuthor}, false},
+		{&core.User{Username: "alice", Role: core.RoleModerator}, false},
+	} {
+		assert.Equal(t, c.canEdit, canEditEntry(c.user, e), "%s (%s)", c.user.Username, c.user.Role)
+	}
+}
+
+func TestCanEditHiddenFile(t *testing.T) {
+	s := &Server{}
+	owner := &core.User{Username: "owner", Role: core.RoleOwner}
+
+	assert.False(t, s.canEditFile(owner, "/.git/config"))
+	assert.False(t, s.canEditFile(owner, "/content/.hidden/index.md"))
+	assert.True(t, s.canEditFile(owner, "/content/about/index.md"))
+}
+
+func TestUsersTemplateHidesTOTP(t *testing.T) {
+	s := newCSRFTestServer()
+	secret := "JBSWY3DPEHPK3PXP"
+
+	w := httptest.NewRecorder()
+	s.panelTemplate(w, httptest.NewRequest(http.MethodGet, panelUsersPath, nil), http.StatusOK, panelUsersTemplate, &usersPage{
+		Title: "Users",
+		Owner: s.configUser(),
+		Users: []*core.User{{Username: "alice", Role: core.RoleAuthor, TOTP: secret}},
+		Roles: core.Roles,
+	})
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), secret)
+	assert.Contains(t, w.Body.String(), "name='disable_totp'")
+}
+
+// testPanelRequest makes a request to the panel as the user, with a valid CSRF
+// token.
+func testPanelRequest(s *Server, user *core.User, method, path string, form url.Values) *httptest.ResponseRecorder {
+	session := &core.Token{ID: "session-" + user.Username, Type: core.TokenTypeSession, Username: user.Username}
+
+	r := chi.NewRouter()
+	r.Use(withTestUser(user, session))
+	r.Group(s.panelRouter)
+
+	req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(csrfHeaderName, s.csrfToken(req.WithContext(context.WithValue(req.Context(), sessionContextKey, session))))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRoutePermissions(t *testing.T) {
+	s := newTestServer(t)
+
+	alice, err := s.getUserByUsername(context.Background(), "alice")
+	require.NoError(t, err)
+	mod, err := s.getUserByUsername(context.Background(), "mod")
+	require.NoError(t, err)
+
+	for _, user := range []*core.User{alice, mod} {
+		for _, req := range []struct{ method, path string }{
+			{http.MethodGet, panelQueuePath},
+			{http.MethodPost, panelQueuePath},
+			{http.MethodGet, panelUsersPath},
+			{http.MethodPost, panelUsersPath},
+			{http.MethodGet, panelBrowsePath + "/content/"},
+			{http.MethodPost, panelBrowsePath + "/content/"},
+		} {
+			w := testPanelRequest(s, user, req.method, req.path, url.Values{})
+			assert.Equal(t, http.StatusForbidden, w.Code, "%s: %s %s", user.Username, req.method, req.path)
+		}
+
+		// Everyone manages their own sessions and tokens.
+		w := testPanelRequest(s, user, http.MethodGet, panelTokensPath, nil)
+		assert.Equal(t, http.StatusOK, w.Code, user.Username)
+	}
+
+	w := testPanelRequest(s, mod, http.MethodGet, panelNewPath, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = testPanelRequest(s, mod, http.MethodGet, panelMediaPath, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = testPanelRequest(s, alice, http.MethodGet, panelMentionsPath, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// The tokens have all the scopes, but the users lack the permissions.
+	all := strings.Join([]string{
+		scopeEntriesRead, scopeEntriesWrite, scopeFilesRead, scopeFilesWrite,
+		scopeActionsRun, scopeBuild, scopeMentionsModerate, scopeQueueManage,
+	}, " ")
+
+	for _, c := range []struct {
+		username string
+		method   string
+		path     string
+	}{
+		{"alice", http.MethodGet, "/actions"},
+		{"alice", http.MethodPost, "/build"},
+		{"alice", http.MethodGet, "/files/content"},
+		{"alice", http.MethodPut, "/files/content/index.md"},
+		{"alice", http.MethodGet, "/mentions"},
+		{"alice", http.MethodGet, "/queue"},
+		{"mod", http.MethodGet, "/entries"},
+		{"mod", http.MethodPost, "/entries"},
+		{"mod", http.MethodGet, "/files/content"},
+		{"mod", http.MethodGet, "/queue"},
+	} {
+		w := testAPIRequest(s, c.method, c.path, testAccessToken(t, s, c.username, all), "")
+		assert.Equal(t, http.StatusForbidden, w.Code, "%s: %s %s", c.username, c.method, c.path)
+		assert.Contains(t, w.Body.String(), "insufficient_scope")
+	}
+
+	w = testAPIRequest(s, http.MethodGet, "/actions", testAccessToken(t, s, "owner", all), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAuthorCannotEditOthersEntries(t *testing.T) {
+	s := newTestServer(t)
+
+	alice, err := s.getUserByUsername(context.Background(), "alice")
+	require.NoError(t, err)
+
+	ownerPost := "content/posts/2024/01/01/owner/index.md"
+	alicePost := "content/posts/2024/01/01/alice/index.md"
+	writeTestFile(t, s, ownerPost, "---\nauthor: owner\n---\n\nOwner's post.\n")
+	writeTestFile(t, s, alicePost, "---\nauthor: alice\n---\n\nAlice's post.\n")
+
+	// Editing the post of another user.
+	w := testPanelRequest(s, alice, http.MethodPost, panelEditPath+"/"+ownerPost, url.Values{
+		"content": {"---\nauthor: alice\n---\n\nMine now.\n"},
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Giving away their own post.
+	w = testPanelRequest(s, alice, http.MethodPost, panelEditPath+"/"+alicePost, url.Values{
+		"content": {"---\nauthor: owner\n---\n\nAlice's post.\n"},
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	token := testAccessToken(t, s, "alice", scopeEntriesWrite)
+
+	w = testAPIRequest(s, http.MethodPut, "/entries/posts/2024/01/01/owner", token, `{"source": "---\nauthor: alice\n---\n\nMine now.\n"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = testAPIRequest(s, http.MethodPut, "/entries/posts/2024/01/01/alice", token, `{"source": "---\nauthor: owner\n---\n\nAlice's post.\n"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Nothing was written.
+	for filename, content := range map[string]string{
+		ownerPost: "Owner's post.",
+		alicePost: "author: alice",
+	} {
+		data, err := os.ReadFile(filepath.Join(s.c.SourceDirectory, filename))
+		require.NoError(t, err)
+		assert.Contains(t, string(data), content)
+	}
+}
+
+func TestTokenMe(t *testing.T) {
+	s := newTestServer(t)
+
+	r := chi.NewRouter()
+	r.Post(tokenVerifyPath, s.tokenVerifyPost)
+	r.With(s.mustIndieAuth).Get(tokenPath, s.tokenGet)
+
+	for username, me := range map[string]string{
+		"owner": s.c.ID(),
+		"alice": "https://example.com/authors/alice/",
+	} {
+		token := testAccessToken(t, s, username, scopeEntriesRead)
+
+		req := httptest.NewRequest(http.MethodGet, tokenPath, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var res tokenResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		assert.Equal(t, me, res.Me, username)
+
+		req = httptest.NewRequest(http.MethodPost, tokenVerifyPath, strings.NewReader(url.Values{"token": {token}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var info map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+		assert.Equal(t, true, info["active"], username)
+		assert.Equal(t, me, info["me"], username)
+	}
+}
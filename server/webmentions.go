@@ -3,94 +3,18 @@ package server
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net/http"
-	"net/url"
-	"strings"
-	"time"
 
 	"github.com/google/uuid"
-	"github.com/microcosm-cc/bluemonday"
 	"go.hacdias.com/eagle/core"
 	"go.hacdias.com/eagle/xray"
 )
 
 const (
 	webmentionPath = "/webmention"
-	commentsPath   = "/comments"
 )
 
-func (s *Server) commentsPost(w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseForm(); err != nil {
-		s.serveErrorHTML(w, r, http.StatusBadRequest, fmt.Errorf("parse form failed: %w", err))
-		return
-	}
-
-	// Anti-spam prevention with user-defined captcha value.
-	if s.c.Comments.Captcha != "" && s.c.Comments.Captcha != strings.ToLower(r.Form.Get("captcha")) {
-		s.serveErrorHTML(w, r, http.StatusBadRequest, errors.New("anti-spam verification failed"))
-		return
-	}
-
-	name := r.Form.Get("name")
-	website := r.Form.Get("website")
-	content := r.Form.Get("content")
-	target := r.Form.Get("target")
-
-	if target == "" {
-		s.serveErrorHTML(w, r, http.StatusBadRequest, errors.New("target entry is missing"))
-		return
-	}
-
-	e, err := s.core.GetEntry(target)
-	if err != nil {
-		s.serveErrorHTML(w, r, http.StatusBadRequest, fmt.Errorf("target entry is invalid: %w", err))
-		return
-	}
-
-	// Sanitize things just in case, specially the content.
-	sanitize := bluemonday.StrictPolicy()
-	name = sanitize.Sanitize(name)
-	website = sanitize.Sanitize(website)
-	content = sanitize.Sanitize(content)
-
-	if len(name) == 0 || len(content) == 0 {
-		s.serveErrorHTML(w, r, http.StatusBadRequest, errors.New("name and content are required"))
-		return
-	}
-
-	if len(content) > 1000 || len(name) > 200 || len(website) > 200 {
-		s.serveErrorHTML(w, r, http.StatusBadRequest, errors.New("content, name, or website outside of limits"))
-		return
-	}
-
-	if _, err := url.Parse(website); err != nil {
-		s.serveErrorHTML(w, r, http.StatusBadRequest, fmt.Errorf("website url is invalid: %w", err))
-		return
-	}
-
-	s.log.Infow("received comment entry", "name", name, "website", website, "content", content)
-
-	err = s.core.DB().CreateMention(r.Context(), &core.Mention{
-		ID: uuid.New().String(),
-		Post: xray.Post{
-			Author:    name,
-			AuthorURL: website,
-			Content:   content,
-			Date:      time.Now(),
-		},
-		EntryID: e.ID,
-	})
-	if err != nil {
-		s.panelError(w, r, http.StatusInternalServerError, err)
-		return
-	}
-
-	s.n.Notify(fmt.Sprintf("💬 #mention pending approval for %q", e.Permalink))
-	http.Redirect(w, r, s.c.Comments.Redirect, http.StatusSeeOther)
-}
-
 type webmentionPayload struct {
 	Source  string         `json:"source"`
 	Secret  string         `json:"secret"`
@@ -146,10 +70,14 @@ func (s *Server) handleWebmention(payload *webmentionPayload) {
 		mention.Source = payload.Source
 	}
 
-	err = s.core.DB().CreateMention(context.Background(), mention)
+	action := s.moderateMention(context.Background(), mention)
+	if action == core.MentionBlock {
+		s.log.Infow("discarded blocked webmention", "target", payload.Target, "source", payload.Source)
+		return
+	}
+
+	err = s.receiveMention(context.Background(), e, mention, action)
 	if err != nil {
 		s.log.Errorw("failed to add webmention", "target", payload.Target, "err", err)
-	} else {
-		s.n.Notify(fmt.Sprintf("💬 #mention pending approval for %q: %q", e.Permalink, payload.Source))
 	}
 }
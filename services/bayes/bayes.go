@@ -0,0 +1,97 @@
+package bayes
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"slices"
+
+	"go.hacdias.com/eagle/core"
+)
+
+var (
+	_ core.SpamFilter = &Bayes{}
+)
+
+const (
+	// interestingTokens is how many tokens, the ones whose probability is the
+	// furthest from neutral, are combined into the score.
+	interestingTokens = 15
+
+	// The strength and probability of the prior belief about tokens, which
+	// keeps rarely seen tokens close to neutral.
+	priorStrength    = 1.0
+	priorProbability = 0.5
+)
+
+// Bayes is a naive Bayesian [core.SpamFilter], stored in the database and
+// trained from the moderation decisions.
+type Bayes struct {
+	db *core.Database
+}
+
+func NewBayes(db *core.Database) *Bayes {
+	return &Bayes{
+		db: db,
+	}
+}
+
+// Score returns the spam probability of the mention. It is neutral, 0.5, until
+// there is at least a spam and a legitimate mention to learn from.
+func (b *Bayes) Score(ctx context.Context, m *core.Mention) (float64, error) {
+	tokens := core.SpamTokens(m)
+	counts, err := b.db.GetSpamTokens(ctx, append(tokens, core.SpamTotalToken)...)
+	if err != nil {
+		return 0, err
+	}
+
+	total, ok := counts[core.SpamTotalToken]
+	if !ok || total.Spam == 0 || total.Ham == 0 {
+		return priorProbability, nil
+	}
+
+	var probabilities []float64
+	for _, token := range tokens {
+		if count, ok := counts[token]; ok {
+			probabilities = append(probabilities, tokenProbability(count, total))
+		}
+	}
+
+	return combine(probabilities), nil
+}
+
+func (b *Bayes) Train(ctx context.Context, m *core.Mention, spam bool) error {
+	return b.db.TrainSpamTokens(ctx, spam, append(core.SpamTokens(m), core.SpamTotalToken)...)
+}
+
+// tokenProbability returns the probability of a mention with the token being
+// spam, adjusted towards the prior for rarely seen tokens, as per Robinson.
+func tokenProbability(count, total *core.SpamToken) float64 {
+	spamFrequency := float64(count.Spam) / float64(total.Spam)
+	hamFrequency := float64(count.Ham) / float64(total.Ham)
+	p := spamFrequency / (spamFrequency + hamFrequency)
+
+	n := float64(count.Spam + count.Ham)
+	return (priorStrength*priorProbability + n*p) / (priorStrength + n)
+}
+
+// combine combines the most interesting token probabilities with the naive
+// Bayes formula, in the log domain to avoid underflows.
+func combine(probabilities []float64) float64 {
+	if len(probabilities) == 0 {
+		return priorProbability
+	}
+
+	slices.SortFunc(probabilities, func(a, b float64) int {
+		return cmp.Compare(math.Abs(b-0.5), math.Abs(a-0.5))
+	})
+	probabilities = probabilities[:min(len(probabilities), interestingTokens)]
+
+	var eta float64
+	for _, p := range probabilities {
+		p = min(max(p, 0.01), 0.99)
+		eta += math.Log(1-p) - math.Log(p)
+	}
+
+	return 1 / (1 + math.Exp(eta))
+}
@@ -0,0 +1,30 @@
+package bayes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.hacdias.com/eagle/core"
+)
+
+func TestTokenProbability(t *testing.T) {
+	total := &core.SpamToken{Spam: 10, Ham: 10}
+	assert.InDelta(t, 0.5, tokenProbability(&core.SpamToken{Spam: 1, Ham: 1}, total), 0.001)
+	assert.InDelta(t, 0.75, tokenProbability(&core.SpamToken{Spam: 1}, total), 0.001)
+	assert.InDelta(t, 0.995, tokenProbability(&core.SpamToken{Spam: 99}, total), 0.001)
+	assert.Less(t, tokenProbability(&core.SpamToken{Ham: 5}, total), 0.2)
+}
+
+func TestCombine(t *testing.T) {
+	assert.Equal(t, 0.5, combine(nil))
+	assert.InDelta(t, 0.5, combine([]float64{0.9, 0.1}), 0.001)
+	assert.Greater(t, combine([]float64{0.9, 0.8, 0.4}), 0.9)
+	assert.Less(t, combine([]float64{0.1, 0.2, 0.6}), 0.1)
+
+	// Only the most interesting tokens count.
+	probabilities := []float64{0.99}
+	for range interestingTokens {
+		probabilities = append(probabilities, 0.01)
+	}
+	assert.Less(t, combine(probabilities), 0.01)
+}
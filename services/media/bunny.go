@@ -32,19 +32,28 @@ func (m *Bunny) BaseURL() string {
 	return m.conf.Base
 }
 
-func (m *Bunny) UploadMedia(filename string, data io.Reader) (string, error) {
+// bunnyPath returns the filename with a leading slash.
+func bunnyPath(filename string) string {
 	if !strings.HasPrefix(filename, "/") {
-		filename = "/" + filename
+		return "/" + filename
 	}
 
-	req, err := http.NewRequest(http.MethodPut, "https://storage.bunnycdn.com/"+m.conf.Zone+filename, data)
+	return filename
+}
+
+func (m *Bunny) do(method, filename string, data io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, "https://storage.bunnycdn.com/"+m.conf.Zone+bunnyPath(filename), data)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	req.Header.Set("AccessKey", m.conf.Key)
 
-	res, err := m.httpClient.Do(req)
+	return m.httpClient.Do(req)
+}
+
+func (m *Bunny) UploadMedia(filename string, data io.Reader) (string, error) {
+	res, err := m.do(http.MethodPut, filename, data)
 	if err != nil {
 		return "", err
 	}
@@ -56,5 +65,40 @@ func (m *Bunny) UploadMedia(filename string, data io.Reader) (string, error) {
 		return "", errors.New("status code is not ok")
 	}
 
-	return m.conf.Base + filename, nil
+	return m.conf.Base + bunnyPath(filename), nil
+}
+
+func (m *Bunny) MediaExists(filename string) (bool, error) {
+	res, err := m.do(http.MethodHead, filename, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, errors.New("status code is not ok")
+	}
+}
+
+func (m *Bunny) DeleteMedia(filename string) error {
+	res, err := m.do(http.MethodDelete, filename, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNotFound {
+		return errors.New("status code is not ok")
+	}
+
+	return nil
 }
@@ -0,0 +1,338 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"go.hacdias.com/eagle/core"
+)
+
+// decodeExif extracts the relevant EXIF metadata from the image data. It
+// returns nil if the image has no, or unreadable, EXIF metadata.
+func decodeExif(data []byte, keepGPS bool) *core.Exif {
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil && (x == nil || exif.IsCriticalError(err)) {
+		return nil
+	}
+
+	e := &core.Exif{
+		Make:            exifString(x, exif.Make),
+		Model:           exifString(x, exif.Model),
+		LensMake:        exifString(x, exif.LensMake),
+		LensModel:       exifString(x, exif.LensModel),
+		FocalLength:     exifFloat(x, exif.FocalLength),
+		FocalLength35mm: exifInt(x, exif.FocalLengthIn35mmFilm),
+		Aperture:        exifFloat(x, exif.FNumber),
+		ISO:             exifInt(x, exif.ISOSpeedRatings),
+	}
+
+	if tag, err := x.Get(exif.ExposureTime); err == nil {
+		if r, err := tag.Rat(0); err == nil {
+			e.ExposureTime = r.RatString()
+		}
+	}
+
+	if t, err := x.DateTime(); err == nil {
+		e.TakenAt = t
+	}
+
+	if keepGPS {
+		if lat, long, err := x.LatLong(); err == nil {
+			e.Latitude = lat
+			e.Longitude = long
+		}
+	}
+
+	if *e == (core.Exif{}) {
+		return nil
+	}
+
+	return e
+}
+
+func exifString(x *exif.Exif, name exif.FieldName) string {
+	tag, err := x.Get(name)
+	if err != nil {
+		return ""
+	}
+
+	s, err := tag.StringVal()
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(strings.TrimRight(s, "\x00"))
+}
+
+func exifFloat(x *exif.Exif, name exif.FieldName) float64 {
+	tag, err := x.Get(name)
+	if err != nil {
+		return 0
+	}
+
+	num, den, err := tag.Rat2(0)
+	if err != nil || den == 0 {
+		return 0
+	}
+
+	return float64(num) / float64(den)
+}
+
+func exifInt(x *exif.Exif, name exif.FieldName) int {
+	tag, err := x.Get(name)
+	if err != nil {
+		return 0
+	}
+
+	v, err := tag.Int(0)
+	if err != nil {
+		return 0
+	}
+
+	return v
+}
+
+const (
+	jpegMarkerSOI  = 0xD8
+	jpegMarkerEOI  = 0xD9
+	jpegMarkerSOS  = 0xDA
+	jpegMarkerAPP1 = 0xE1
+
+	tiffTagGPSInfo = 0x8825
+)
+
+var (
+	exifHeader   = []byte("Exif\x00\x00")
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+	// The XMP packets, which may also hold the GPS coordinates, are identified
+	// by the namespace of XMP in JPEG, and by the keyword of the iTXt chunk in
+	// PNG. Extended XMP continues the packet in other JPEG segments.
+	jpegXMPHeader         = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	jpegExtendedXMPHeader = []byte("http://ns.adobe.com/xmp/extension/\x00")
+	pngXMPKeyword         = []byte("XML:com.adobe.xmp\x00")
+)
+
+// webpFlagXMP is the flag of the VP8X chunk that announces the XMP chunk.
+const webpFlagXMP = 0x04
+
+// stripGPS removes the GPS information from the metadata of a JPEG, PNG or
+// WebP image. The GPS directory of the EXIF metadata is emptied in place, such
+// that no offsets within it have to be rewritten, and the XMP metadata, which
+// may repeat the coordinates, is dropped. Data in other formats is returned as
+// is. The original data is never modified.
+func stripGPS(data []byte) []byte {
+	switch {
+	case len(data) >= 4 && data[0] == 0xFF && data[1] == jpegMarkerSOI:
+		return stripJPEGGPS(data)
+	case bytes.HasPrefix(data, pngSignature):
+		return stripPNGGPS(data)
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return stripWebPGPS(data)
+	default:
+		return data
+	}
+}
+
+// stripJPEGGPS strips the GPS information from the APP1 Exif segments, and
+// drops the APP1 XMP segments.
+func stripJPEGGPS(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+	pos := 2
+
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		if marker == jpegMarkerEOI || marker == jpegMarkerSOS {
+			break
+		}
+
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:pos+4]))
+		if end > len(data) {
+			break
+		}
+
+		payload := data[pos+4 : end]
+		if marker == jpegMarkerAPP1 && (bytes.HasPrefix(payload, jpegXMPHeader) || bytes.HasPrefix(payload, jpegExtendedXMPHeader)) {
+			pos = end
+			continue
+		}
+
+		start := len(out)
+		out = append(out, data[pos:end]...)
+		if marker == jpegMarkerAPP1 && bytes.HasPrefix(payload, exifHeader) {
+			stripTiffGPS(out[start+4+len(exifHeader):])
+		}
+
+		pos = end
+	}
+
+	return append(out, data[pos:]...)
+}
+
+// stripPNGGPS strips the GPS information from the eXIf chunk, updating its
+// checksum, and drops the iTXt XMP chunk.
+func stripPNGGPS(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+	pos := len(pngSignature)
+
+	for pos+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		end := pos + 12 + length
+		if length < 0 || end > len(data) {
+			break
+		}
+
+		typ := string(data[pos+4 : pos+8])
+		if typ == "iTXt" && bytes.HasPrefix(data[pos+8:], pngXMPKeyword) {
+			pos = end
+			continue
+		}
+
+		start := len(out)
+		out = append(out, data[pos:end]...)
+		if typ == "eXIf" {
+			stripTiffGPS(out[start+8 : start+8+length])
+			binary.BigEndian.PutUint32(out[start+8+length:], crc32.ChecksumIEEE(out[start+4:start+8+length]))
+		}
+
+		pos = end
+		if typ == "IEND" {
+			break
+		}
+	}
+
+	return append(out, data[pos:]...)
+}
+
+// stripWebPGPS strips the GPS information from the EXIF chunk of the RIFF
+// container, whose payload may start with the Exif header of JPEG, and drops
+// the XMP chunk, updating the size of the container and the flags of the VP8X
+// chunk.
+func stripWebPGPS(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:12]...)
+	pos := 12
+	removed := 0
+
+	for pos+8 <= len(data) {
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		end := pos + 8 + size
+		if size < 0 || end > len(data) {
+			break
+		}
+
+		// Chunks are padded to an even size.
+		end = min(end+size%2, len(data))
+
+		fourcc := string(data[pos : pos+4])
+		if fourcc == "XMP " {
+			removed += end - pos
+			pos = end
+			continue
+		}
+
+		start := len(out)
+		out = append(out, data[pos:end]...)
+		switch fourcc {
+		case "EXIF":
+			stripTiffGPS(bytes.TrimPrefix(out[start+8:start+8+size], exifHeader))
+		case "VP8X":
+			if size > 0 {
+				out[start+8] &^= webpFlagXMP
+			}
+		}
+
+		pos = end
+	}
+
+	out = append(out, data[pos:]...)
+	if removed > 0 {
+		binary.LittleEndian.PutUint32(out[4:8], binary.LittleEndian.Uint32(data[4:8])-uint32(removed))
+	}
+	return out
+}
+
+func stripTiffGPS(tiff []byte) {
+	if len(tiff) < 8 {
+		return
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return
+	}
+
+	ifd0 := int(order.Uint32(tiff[4:8]))
+	for _, entry := range tiffEntries(tiff, order, ifd0) {
+		if order.Uint16(entry[0:2]) == tiffTagGPSInfo {
+			clearTiffDirectory(tiff, order, int(order.Uint32(entry[8:12])))
+			return
+		}
+	}
+}
+
+// tiffEntries returns the 12-byte entries of the directory at the offset.
+func tiffEntries(tiff []byte, order binary.ByteOrder, offset int) [][]byte {
+	if offset < 0 || offset+2 > len(tiff) {
+		return nil
+	}
+
+	n := int(order.Uint16(tiff[offset:]))
+	if offset+2+n*12 > len(tiff) {
+		return nil
+	}
+
+	entries := make([][]byte, 0, n)
+	for i := range n {
+		start := offset + 2 + i*12
+		entries = append(entries, tiff[start:start+12])
+	}
+
+	return entries
+}
+
+// clearTiffDirectory zeroes all the entries of the directory at the offset,
+// including the values stored outside of the entries, and marks the directory
+// as having no entries.
+func clearTiffDirectory(tiff []byte, order binary.ByteOrder, offset int) {
+	for _, entry := range tiffEntries(tiff, order, offset) {
+		size := tiffTypeSize(order.Uint16(entry[2:4])) * int(order.Uint32(entry[4:8]))
+		if size > 4 {
+			valueOffset := int(order.Uint32(entry[8:12]))
+			if valueOffset >= 0 && valueOffset+size <= len(tiff) {
+				clear(tiff[valueOffset : valueOffset+size])
+			}
+		}
+
+		clear(entry)
+	}
+
+	if offset >= 0 && offset+2 <= len(tiff) {
+		order.PutUint16(tiff[offset:], 0)
+	}
+}
+
+func tiffTypeSize(typ uint16) int {
+	switch typ {
+	case 1, 2, 6, 7: // BYTE, ASCII, SBYTE, UNDEFINED
+		return 1
+	case 3, 8: // SHORT, SSHORT
+		return 2
+	case 4, 9, 11: // LONG, SLONG, FLOAT
+		return 4
+	case 5, 10, 12: // RATIONAL, SRATIONAL, DOUBLE
+		return 8
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,204 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTiffWithGPS builds minimal EXIF metadata that contains the camera make
+// and a GPS position of 52.5N, 13.25E.
+func testTiffWithGPS() []byte {
+	le := binary.LittleEndian
+	tiff := make([]byte, 146)
+
+	copy(tiff[0:], "II")
+	le.PutUint16(tiff[2:], 42)
+	le.PutUint32(tiff[4:], 8)
+
+	putEntry := func(offset int, tag, typ uint16, count, value uint32) {
+		le.PutUint16(tiff[offset:], tag)
+		le.PutUint16(tiff[offset+2:], typ)
+		le.PutUint32(tiff[offset+4:], count)
+		le.PutUint32(tiff[offset+8:], value)
+	}
+
+	// IFD0 at 8, with 2 entries, ending at 38.
+	le.PutUint16(tiff[8:], 2)
+	putEntry(10, 0x010F, 2, 6, 38)
+	putEntry(22, tiffTagGPSInfo, 4, 1, 44)
+	copy(tiff[38:], "Canon\x00")
+
+	// GPS IFD at 44, with 4 entries, ending at 98.
+	le.PutUint16(tiff[44:], 4)
+	putEntry(46, 0x0001, 2, 2, 0)
+	copy(tiff[54:], "N\x00")
+	putEntry(58, 0x0002, 5, 3, 98)
+	putEntry(70, 0x0003, 2, 2, 0)
+	copy(tiff[78:], "E\x00")
+	putEntry(82, 0x0004, 5, 3, 122)
+
+	putRationals := func(offset int, values ...uint32) {
+		for i, v := range values {
+			le.PutUint32(tiff[offset+i*8:], v)
+			le.PutUint32(tiff[offset+i*8+4:], 1)
+		}
+	}
+	putRationals(98, 52, 30, 0)
+	putRationals(122, 13, 15, 0)
+
+	return tiff
+}
+
+// testXMPWithGPS is an XMP packet with GPS coordinates, as exported by
+// Lightroom and phones.
+const testXMPWithGPS = `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+	`<rdf:Description xmlns:exif="http://ns.adobe.com/exif/1.0/" exif:GPSLatitude="52,30.0N" exif:GPSLongitude="13,15.0E"/>` +
+	`</rdf:RDF></x:xmpmeta>`
+
+// testJPEGWithExif builds a minimal JPEG with the metadata of testTiffWithGPS.
+func testJPEGWithExif() []byte {
+	segment := append([]byte("Exif\x00\x00"), testTiffWithGPS()...)
+	data := []byte{0xFF, jpegMarkerSOI, 0xFF, jpegMarkerAPP1, 0, 0}
+	binary.BigEndian.PutUint16(data[4:], uint16(len(segment)+2))
+	data = append(data, segment...)
+	return append(data, 0xFF, jpegMarkerEOI)
+}
+
+func TestDecodeExif(t *testing.T) {
+	data := testJPEGWithExif()
+
+	exif := decodeExif(data, true)
+	require.NotNil(t, exif)
+	assert.Equal(t, "Canon", exif.Make)
+	assert.InDelta(t, 52.5, exif.Latitude, 0.0001)
+	assert.InDelta(t, 13.25, exif.Longitude, 0.0001)
+
+	exif = decodeExif(data, false)
+	require.NotNil(t, exif)
+	assert.Equal(t, "Canon", exif.Make)
+	assert.Zero(t, exif.Latitude)
+	assert.Zero(t, exif.Longitude)
+
+	assert.Nil(t, decodeExif([]byte("not an image"), true))
+}
+
+func TestStripGPS(t *testing.T) {
+	data := testJPEGWithExif()
+	stripped := stripGPS(data)
+
+	assert.Len(t, stripped, len(data))
+
+	exif := decodeExif(stripped, true)
+	require.NotNil(t, exif)
+	assert.Equal(t, "Canon", exif.Make)
+	assert.Zero(t, exif.Latitude)
+	assert.Zero(t, exif.Longitude)
+
+	// The original data must not be modified in place.
+	exif = decodeExif(data, true)
+	require.NotNil(t, exif)
+	assert.InDelta(t, 52.5, exif.Latitude, 0.0001)
+
+	gif := []byte("GIF89a")
+	assert.Equal(t, gif, stripGPS(gif))
+}
+
+func TestStripGPSXMP(t *testing.T) {
+	exif := testJPEGWithExif()
+	xmp := append(bytes.Clone(jpegXMPHeader), testXMPWithGPS...)
+
+	// The XMP segment goes between the Exif segment and the end of the image.
+	data := bytes.Clone(exif[:len(exif)-2])
+	data = append(data, 0xFF, jpegMarkerAPP1)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(xmp)+2))
+	data = append(data, xmp...)
+	data = append(data, 0xFF, jpegMarkerSOS, 0, 2, 0xFF, jpegMarkerEOI)
+
+	stripped := stripGPS(data)
+	assert.NotContains(t, string(stripped), "GPSLatitude")
+	assert.NotContains(t, string(stripped), "ns.adobe.com/xap")
+	assert.Contains(t, string(data), "GPSLatitude")
+
+	// The other segments, and the image data, are kept.
+	assert.Equal(t, stripGPS(exif)[:len(exif)-2], stripped[:len(exif)-2])
+	assert.Equal(t, []byte{0xFF, jpegMarkerSOS, 0, 2, 0xFF, jpegMarkerEOI}, stripped[len(exif)-2:])
+
+	decoded := decodeExif(stripped, true)
+	require.NotNil(t, decoded)
+	assert.Equal(t, "Canon", decoded.Make)
+	assert.Zero(t, decoded.Latitude)
+}
+
+func TestStripGPSPNG(t *testing.T) {
+	be := binary.BigEndian
+	chunk := func(typ string, payload []byte) []byte {
+		c := be.AppendUint32(nil, uint32(len(payload)))
+		c = append(c, typ...)
+		c = append(c, payload...)
+		return be.AppendUint32(c, crc32.ChecksumIEEE(c[4:]))
+	}
+
+	tiff := testTiffWithGPS()
+	data := bytes.Clone(pngSignature)
+	data = append(data, chunk("IHDR", make([]byte, 13))...)
+	data = append(data, chunk("eXIf", tiff)...)
+	data = append(data, chunk("iTXt", append(bytes.Clone(pngXMPKeyword), "\x00\x00\x00\x00"+testXMPWithGPS...))...)
+	data = append(data, chunk("IEND", nil)...)
+
+	stripped := stripGPS(data)
+	assert.NotContains(t, string(stripped), "GPSLatitude")
+	assert.Equal(t, chunk("IEND", nil), stripped[len(stripped)-12:])
+
+	start := len(pngSignature) + 25 + 8
+	exif := decodeExif(stripped[start:start+len(tiff)], true)
+	require.NotNil(t, exif)
+	assert.Equal(t, "Canon", exif.Make)
+	assert.Zero(t, exif.Latitude)
+	assert.Zero(t, exif.Longitude)
+
+	// The checksum of the chunk is updated.
+	end := start + len(tiff)
+	assert.Equal(t, crc32.ChecksumIEEE(stripped[start-4:end]), be.Uint32(stripped[end:]))
+	assert.NotEqual(t, data[end:end+4], stripped[end:end+4])
+}
+
+func TestStripGPSWebP(t *testing.T) {
+	le := binary.LittleEndian
+	chunk := func(fourcc string, payload []byte) []byte {
+		c := append([]byte(fourcc), le.AppendUint32(nil, uint32(len(payload)))...)
+		c = append(c, payload...)
+		if len(payload)%2 == 1 {
+			c = append(c, 0)
+		}
+		return c
+	}
+
+	for name, payload := range map[string][]byte{
+		"tiff":        testTiffWithGPS(),
+		"exif header": append([]byte("Exif\x00\x00"), testTiffWithGPS()...),
+	} {
+		body := []byte("WEBP")
+		body = append(body, chunk("VP8X", append([]byte{webpFlagXMP | 0x08}, make([]byte, 9)...))...)
+		body = append(body, chunk("VP8L", make([]byte, 5))...)
+		body = append(body, chunk("EXIF", payload)...)
+		body = append(body, chunk("XMP ", []byte(testXMPWithGPS))...)
+		data := append([]byte("RIFF"), le.AppendUint32(nil, uint32(len(body)))...)
+		data = append(data, body...)
+
+		stripped := stripGPS(data)
+		assert.NotContains(t, string(stripped), "GPSLatitude", name)
+		assert.EqualValues(t, len(stripped)-8, le.Uint32(stripped[4:8]), name)
+		assert.Equal(t, byte(0x08), stripped[20], name)
+
+		exif := decodeExif(bytes.TrimPrefix(stripped[len(stripped)-len(payload)-len(payload)%2:len(stripped)-len(payload)%2], exifHeader), true)
+		require.NotNil(t, exif, name)
+		assert.Equal(t, "Canon", exif.Make, name)
+		assert.Zero(t, exif.Latitude, name)
+		assert.Zero(t, exif.Longitude, name)
+	}
+}
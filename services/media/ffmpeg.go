@@ -0,0 +1,217 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.hacdias.com/eagle/core"
+)
+
+var (
+	_ Transcoder = &FFmpeg{}
+)
+
+const ffmpegTimeout = 30 * time.Minute
+
+// FFmpeg is a [Transcoder] that runs the local ffmpeg and ffprobe binaries.
+type FFmpeg struct {
+	path      string
+	probePath string
+}
+
+func NewFFmpeg(conf *core.FFmpeg) *FFmpeg {
+	f := &FFmpeg{
+		path:      conf.Path,
+		probePath: conf.ProbePath,
+	}
+
+	if f.path == "" {
+		f.path = "ffmpeg"
+	}
+
+	if f.probePath == "" {
+		f.probePath = "ffprobe"
+	}
+
+	return f
+}
+
+func (f *FFmpeg) Probe(reader io.Reader) (*MediaInfo, error) {
+	var info *MediaInfo
+	err := withTempInput(reader, func(dir, input string) error {
+		out, err := run(f.probePath, "-v", "error", "-print_format", "json", "-show_format", "-show_streams", input)
+		if err != nil {
+			return err
+		}
+
+		info, err = parseProbe(out)
+		return err
+	})
+	return info, err
+}
+
+func (f *FFmpeg) Transcode(reader io.Reader, format string) (io.Reader, error) {
+	var args []string
+	switch format {
+	case "mp4":
+		args = []string{
+			"-map", "0:v:0", "-map", "0:a:0?",
+			"-c:v", "libx264", "-preset", "medium", "-crf", "23", "-pix_fmt", "yuv420p",
+			// Limit to 1080p, keeping the dimensions even as required by H.264.
+			"-vf", "scale='min(1920,iw)':-2",
+			"-c:a", "aac", "-b:a", "128k",
+			"-movflags", "+faststart",
+		}
+	case "m4a":
+		args = []string{
+			"-vn",
+			"-c:a", "aac", "-b:a", "192k",
+			"-movflags", "+faststart",
+		}
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", format)
+	}
+
+	return f.convert(reader, format, args...)
+}
+
+func (f *FFmpeg) Poster(reader io.Reader) (io.Reader, error) {
+	// The thumbnail filter picks a representative frame from the beginning.
+	return f.convert(reader, "jpeg", "-vf", "thumbnail", "-frames:v", "1", "-q:v", "2")
+}
+
+func (f *FFmpeg) convert(reader io.Reader, ext string, args ...string) (io.Reader, error) {
+	var data []byte
+	err := withTempInput(reader, func(dir, input string) error {
+		output := filepath.Join(dir, "output."+ext)
+		args = append([]string{"-y", "-v", "error", "-i", input}, args...)
+		args = append(args, output)
+
+		_, err := run(f.path, args...)
+		if err != nil {
+			return err
+		}
+
+		data, err = os.ReadFile(output)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(data), nil
+}
+
+// withTempInput writes the reader to a temporary file, as some containers,
+// such as MOV, cannot be read from a pipe.
+func withTempInput(reader io.Reader, fn func(dir, input string) error) error {
+	dir, err := os.MkdirTemp("", "eagle-ffmpeg-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	input := filepath.Join(dir, "input")
+	file, err := os.Create(input)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, reader)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+
+	return fn(dir, input)
+}
+
+func run(name string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ffmpegTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %w: %s", filepath.Base(name), err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
+
+type ffprobeOutput struct {
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+	Streams []struct {
+		CodecType    string            `json:"codec_type"`
+		Width        int               `json:"width"`
+		Height       int               `json:"height"`
+		Tags         map[string]string `json:"tags"`
+		SideDataList []struct {
+			Rotation float64 `json:"rotation"`
+		} `json:"side_data_list"`
+	} `json:"streams"`
+}
+
+func parseProbe(data []byte) (*MediaInfo, error) {
+	var out ffprobeOutput
+	err := json.Unmarshal(data, &out)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &MediaInfo{}
+	if out.Format.Duration != "" {
+		info.Duration, err = strconv.ParseFloat(out.Format.Duration, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration %q: %w", out.Format.Duration, err)
+		}
+	}
+
+	for _, stream := range out.Streams {
+		if stream.CodecType != "video" {
+			continue
+		}
+
+		info.Width = stream.Width
+		info.Height = stream.Height
+
+		// Phones record portrait videos as rotated landscape ones.
+		rotation, _ := strconv.ParseFloat(stream.Tags["rotate"], 64)
+		for _, sideData := range stream.SideDataList {
+			if sideData.Rotation != 0 {
+				rotation = sideData.Rotation
+			}
+		}
+
+		if math.Mod(math.Abs(rotation), 180) == 90 {
+			info.Width, info.Height = info.Height, info.Width
+		}
+
+		break
+	}
+
+	return info, nil
+}
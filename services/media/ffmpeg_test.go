@@ -0,0 +1,176 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.hacdias.com/eagle/core"
+)
+
+func TestParseProbe(t *testing.T) {
+	info, err := parseProbe([]byte(`{
+		"streams": [
+			{"codec_type": "audio"},
+			{"codec_type": "video", "width": 1920, "height": 1080, "side_data_list": [{"rotation": -90}]}
+		],
+		"format": {"duration": "12.480000"}
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, &MediaInfo{Duration: 12.48, Width: 1080, Height: 1920}, info)
+
+	info, err = parseProbe([]byte(`{"streams": [{"codec_type": "audio"}], "format": {"duration": "3.5"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, &MediaInfo{Duration: 3.5}, info)
+}
+
+type fakeTranscoder struct {
+	poster []byte
+}
+
+func (fakeTranscoder) Probe(reader io.Reader) (*MediaInfo, error) {
+	return &MediaInfo{Duration: 2, Width: 400, Height: 200}, nil
+}
+
+func (fakeTranscoder) Transcode(reader io.Reader, format string) (io.Reader, error) {
+	return strings.NewReader("transcoded " + format), nil
+}
+
+func (f fakeTranscoder) Poster(reader io.Reader) (io.Reader, error) {
+	return bytes.NewReader(f.poster), nil
+}
+
+func TestUploadVideoAndAudio(t *testing.T) {
+	storage := newMemoryStorage(t)
+	m := NewMedia(&core.Media{}, nil)
+	m.storage = storage
+
+	upload, err := m.UploadMedia("clip", ".MOV", strings.NewReader("original"))
+	require.NoError(t, err)
+	require.NotNil(t, upload.Video)
+	assert.Equal(t, storage.BaseURL()+"/clip.mov", upload.Video.URL)
+	assert.Zero(t, upload.Video.Duration)
+
+	m.transcoder = fakeTranscoder{poster: testPNG(t, 40, 20)}
+
+	upload, err = m.UploadMedia("clip", ".mov", strings.NewReader("original"))
+	require.NoError(t, err)
+	assert.Equal(t, &core.Video{
+		URL:      storage.BaseURL() + "/video/clip.mp4",
+		MimeType: "video/mp4",
+		Poster:   "image:clip-poster",
+		Width:    400,
+		Height:   200,
+		Duration: 2,
+	}, upload.Video)
+	assert.Equal(t, "transcoded mp4", string(storage.files["video/clip.mp4"]))
+	assert.Contains(t, storage.files, "clip-poster.jpeg")
+
+	upload, err = m.UploadMedia("song", ".mp3", strings.NewReader("original"))
+	require.NoError(t, err)
+	assert.Equal(t, &core.Audio{
+		URL:      storage.BaseURL() + "/audio/song.m4a",
+		MimeType: "audio/mp4",
+		Duration: 2,
+	}, upload.Audio)
+}
+
+func TestTranscodeQueue(t *testing.T) {
+	co := newTestCore(t)
+	ctx := context.Background()
+	storage := newMemoryStorage(t)
+	m := NewMedia(&core.Media{}, co.DB())
+	m.storage = storage
+	m.transcoder = fakeTranscoder{poster: testPNG(t, 40, 20)}
+	m.UseQueue(co.Queue())
+
+	var (
+		original   string
+		transcoded *Upload
+	)
+	m.TranscodeHook = func(o string, upload *Upload) {
+		original = o
+		transcoded = upload
+	}
+
+	// The original is used until the video is transcoded.
+	upload, err := m.UploadMedia("clip", ".mov", strings.NewReader("original"))
+	require.NoError(t, err)
+	assert.True(t, upload.Transcoding)
+	assert.Equal(t, storage.BaseURL()+"/clip.mov", upload.Video.URL)
+	assert.NotContains(t, storage.files, "video/clip.mp4")
+
+	items, err := co.DB().GetActiveQueueItems(ctx)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, TranscodeQueueItemType, items[0].Type)
+	require.NoError(t, m.handleTranscodeQueueItem(ctx, []byte(items[0].Payload)))
+
+	assert.Equal(t, storage.BaseURL()+"/clip.mov", original)
+	require.NotNil(t, transcoded)
+	assert.Equal(t, &core.Video{
+		URL:      storage.BaseURL() + "/video/clip.mp4",
+		MimeType: "video/mp4",
+		Poster:   "image:clip-poster",
+		Width:    400,
+		Height:   200,
+		Duration: 2,
+	}, transcoded.Video)
+
+	// The poster is derived from the video, and not indexed on its own.
+	file, err := co.DB().GetMediaFile(ctx, "clip.mov")
+	require.NoError(t, err)
+	assert.Equal(t, storage.BaseURL()+"/video/clip.mp4", file.Reference)
+	assert.Equal(t, 400, file.Width)
+	assert.Contains(t, file.Derived, "clip-poster.jpeg")
+	assert.Contains(t, file.Derived, manifestFilename("clip-poster"))
+	assert.Contains(t, file.Derived, "video/clip.mp4")
+
+	_, err = co.DB().GetMediaFile(ctx, "clip-poster.jpeg")
+	assert.Error(t, err)
+
+	// Deleting the video deletes all of its files.
+	require.NoError(t, m.DeleteMedia(ctx, "clip.mov"))
+	assert.Empty(t, storage.files)
+}
+
+func TestFFmpeg(t *testing.T) {
+	path, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		t.Skip("ffmpeg is not installed")
+	}
+
+	input := filepath.Join(t.TempDir(), "input.mp4")
+	_, err = run(path, "-v", "error", "-f", "lavfi", "-i", "testsrc=duration=2:size=320x240:rate=10", "-pix_fmt", "yuv420p", input)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(input)
+	require.NoError(t, err)
+
+	f := NewFFmpeg(&core.FFmpeg{})
+
+	info, err := f.Probe(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 320, info.Width)
+	assert.Equal(t, 240, info.Height)
+	assert.InDelta(t, 2, info.Duration, 0.2)
+
+	poster, err := f.Poster(bytes.NewReader(data))
+	require.NoError(t, err)
+	posterData, err := io.ReadAll(poster)
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(posterData, []byte{0xFF, jpegMarkerSOI}))
+
+	transcoded, err := f.Transcode(bytes.NewReader(data), "mp4")
+	require.NoError(t, err)
+	transcodedData, err := io.ReadAll(transcoded)
+	require.NoError(t, err)
+	assert.NotEmpty(t, transcodedData)
+}
@@ -1,7 +1,9 @@
 package media
 
 import (
+	"errors"
 	"io"
+	"os"
 
 	"github.com/spf13/afero"
 	"go.hacdias.com/eagle/core"
@@ -32,3 +34,15 @@ func (fs *FileSystem) BaseURL() string {
 func (fs *FileSystem) UploadMedia(filename string, data io.Reader) (string, error) {
 	return fs.base + "/" + filename, fs.fs.WriteReader(filename, data)
 }
+
+func (fs *FileSystem) MediaExists(filename string) (bool, error) {
+	return fs.fs.Exists(filename)
+}
+
+func (fs *FileSystem) DeleteMedia(filename string) error {
+	err := fs.fs.Remove(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,157 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.hacdias.com/eagle/core"
+)
+
+// DeleteMedia deletes an indexed file from the storage, including all of its
+// renditions and manifest, and removes it from the index.
+func (m *Media) DeleteMedia(ctx context.Context, id string) error {
+	if m.storage == nil || m.db == nil {
+		return errors.New("media is not implemented")
+	}
+
+	file, err := m.db.GetMediaFile(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if file.IsImage() {
+		name, err := imageName(file.Reference)
+		if err != nil {
+			return err
+		}
+
+		for _, filename := range imageFiles(name, file.Renditions) {
+			if filename == file.ID {
+				continue
+			}
+
+			err = m.storage.DeleteMedia(filename)
+			if err != nil {
+				return err
+			}
+		}
+
+		m.renditions.Invalidate(name)
+	}
+
+	for _, derived := range file.Derived {
+		err = m.storage.DeleteMedia(derived)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = m.storage.DeleteMedia(file.ID)
+	if err != nil {
+		return err
+	}
+
+	return m.db.DeleteMediaFile(ctx, id)
+}
+
+// imageFiles returns the files in the storage of the "image:" photo with the
+// given name: the original, the renditions and the manifest.
+func imageFiles(name string, renditions *core.Renditions) []string {
+	files := []string{name + ".jpeg"}
+
+	if renditions != nil {
+		for _, format := range renditions.Formats {
+			for _, width := range renditions.Widths {
+				files = append(files, filepath.Join("image", strconv.Itoa(width), name+"."+format))
+			}
+		}
+	}
+
+	return append(files, manifestFilename(name))
+}
+
+// PreviewURL returns the URL of a small version of the file, if it is a photo,
+// or of the file itself otherwise.
+func (m *Media) PreviewURL(file *core.MediaFile) string {
+	if !file.IsImage() {
+		return file.URL
+	}
+
+	name, err := imageName(file.Reference)
+	if err != nil {
+		return file.URL
+	}
+
+	return m.imageURL(name, file.Renditions, FormatJPEG, Width600)
+}
+
+var referencesReg = regexp.MustCompile(`(?:image:|https?://)[^\s"'<>()\[\]]+`)
+
+// Orphans returns the indexed files that are not referenced by any of the
+// entries, either in their photos, content or other front matter fields.
+func (m *Media) Orphans(ctx context.Context, entries core.Entries) ([]*core.MediaFile, error) {
+	if m.db == nil {
+		return nil, errors.New("media is not implemented")
+	}
+
+	references := map[string]bool{}
+	for _, e := range entries {
+		for _, p := range e.Photos {
+			references[p.URL] = true
+		}
+
+		str, err := e.String()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ref := range referencesReg.FindAllString(str, -1) {
+			references[ref] = true
+			references[m.normalizeReference(ref)] = true
+		}
+	}
+
+	files, err := m.db.GetMediaFiles(ctx, "", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var orphans []*core.MediaFile
+	for _, file := range files {
+		if !references[file.Reference] && !references[file.URL] {
+			orphans = append(orphans, file)
+		}
+	}
+
+	return orphans, nil
+}
+
+// normalizeReference maps direct links to the original or the renditions of
+// a photo to its "image:" URL.
+func (m *Media) normalizeReference(ref string) string {
+	if m.storage == nil {
+		return ref
+	}
+
+	path, ok := strings.CutPrefix(ref, m.storage.BaseURL()+"/")
+	if !ok {
+		return ref
+	}
+
+	// Renditions are stored at image/{width}/{name}.{format}.
+	if rendition, ok := strings.CutPrefix(path, "image/"); ok {
+		if _, filename, ok := strings.Cut(rendition, "/"); ok {
+			return "image:" + strings.TrimSuffix(filename, filepath.Ext(filename))
+		}
+	}
+
+	if name, ok := strings.CutSuffix(path, ".jpeg"); ok {
+		return "image:" + name
+	}
+
+	return ref
+}
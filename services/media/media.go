@@ -2,6 +2,7 @@ package media
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"image"
@@ -12,11 +13,12 @@ import (
 	"net/http"
 	"net/url"
 	"path/filepath"
-	"strconv"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/gabriel-vasile/mimetype"
+	"github.com/maypok86/otter/v2"
 	"github.com/samber/lo"
 	"go.hacdias.com/eagle/core"
 	"go.hacdias.com/eagle/log"
@@ -26,23 +28,50 @@ import (
 type Storage interface {
 	BaseURL() string
 	UploadMedia(filename string, data io.Reader) (string, error)
+	MediaExists(filename string) (bool, error)
+	DeleteMedia(filename string) error
 }
 
 type Transformer interface {
 	Transform(reader io.Reader, format string, width, quality, maxBytes int) (io.Reader, error)
 }
 
+// MediaInfo is the metadata of a video or audio file.
+type MediaInfo struct {
+	Duration float64 // In seconds.
+	Width    int
+	Height   int
+}
+
+type Transcoder interface {
+	Probe(reader io.Reader) (*MediaInfo, error)
+	// Transcode converts the video or audio to mp4 (H.264 and AAC), or to m4a
+	// (AAC), respectively.
+	Transcode(reader io.Reader, format string) (io.Reader, error)
+	// Poster extracts a representative frame of the video as a JPEG.
+	Poster(reader io.Reader) (io.Reader, error)
+}
+
 type Format string
 
 const (
 	FormatWebP Format = "webp"
 	FormatJPEG Format = "jpeg"
+	FormatAVIF Format = "avif"
 )
 
-var formats = []Format{
+// DefaultFormats are the formats of the renditions when none are configured.
+var DefaultFormats = []Format{
 	FormatWebP, FormatJPEG,
 }
 
+// NativeDefaultFormats are the formats of the renditions when none are
+// configured and the images are transformed in-process. WebP is left out, as
+// the [Native] encoder is lossless and its renditions are larger than JPEG.
+var NativeDefaultFormats = []Format{
+	FormatJPEG,
+}
+
 type Width int
 
 const (
@@ -52,7 +81,8 @@ const (
 	Width1800 Width = 1800
 )
 
-var widths = []Width{
+// DefaultWidths are the widths of the renditions when none are configured.
+var DefaultWidths = []Width{
 	Width600, Width900, Width1800,
 }
 
@@ -62,22 +92,61 @@ type Media struct {
 
 	storage     Storage
 	Transformer Transformer
+	transcoder  Transcoder
+	keepGPS     bool
+	formats     []Format
+	widths      []Width
+	renditions  *otter.Cache[string, *core.Renditions]
+	db          *core.Database
+	queue       *core.Queue
+
+	// TranscodeHook is called with the URL of the original once a video or
+	// audio file has been transcoded in the background, such that the entries
+	// referencing the original can be updated.
+	TranscodeHook func(original string, upload *Upload)
 }
 
-func NewMedia(conf *core.Media) *Media {
+// NewMedia creates a new [Media]. If db is not nil, the uploaded files are
+// recorded in the media index.
+func NewMedia(conf *core.Media, db *core.Database) *Media {
 	var (
 		storage     Storage
 		transformer Transformer
+		transcoder  Transcoder
 	)
 
-	if conf.Storage.FileSystem != nil {
+	switch conf.Storage.StorageType() {
+	case core.StorageFileSystem:
 		storage = NewFileSystem(conf.Storage.FileSystem)
-	} else if conf.Storage.Bunny != nil {
+	case core.StorageBunny:
 		storage = NewBunny(conf.Storage.Bunny)
+	case core.StorageS3:
+		storage = NewS3(conf.Storage.S3)
 	}
 
 	if conf.Transformer.ImgProxy != nil {
 		transformer = NewImgProxy(conf.Transformer.ImgProxy)
+	} else {
+		transformer = NewNative()
+	}
+
+	if conf.Transcoder.FFmpeg != nil {
+		transcoder = NewFFmpeg(conf.Transcoder.FFmpeg)
+	}
+
+	formats := DefaultFormats
+	if conf.Transformer.ImgProxy == nil {
+		formats = NativeDefaultFormats
+	}
+	if len(conf.Formats) > 0 {
+		formats = lo.Map(conf.Formats, func(f string, _ int) Format { return Format(f) })
+	}
+
+	widths := DefaultWidths
+	if len(conf.Widths) > 0 {
+		widths = lo.Map(conf.Widths, func(w int, _ int) Width { return Width(w) })
+		slices.Sort(widths)
+		widths = slices.Compact(widths)
 	}
 
 	m := &Media{
@@ -85,41 +154,120 @@ func NewMedia(conf *core.Media) *Media {
 		httpClient:  &http.Client{Timeout: 2 * time.Minute},
 		storage:     storage,
 		Transformer: transformer,
+		transcoder:  transcoder,
+		keepGPS:     conf.KeepGPS,
+		formats:     formats,
+		widths:      widths,
+		renditions: otter.Must(&otter.Options[string, *core.Renditions]{
+			MaximumSize:      10000,
+			ExpiryCalculator: otter.ExpiryWriting[string, *core.Renditions](time.Hour),
+		}),
+		db: db,
 	}
 
 	return m
 }
 
-func (m *Media) UploadMedia(filename, ext string, reader io.Reader) (string, *core.Photo, error) {
+// Upload is the result of uploading a file. Only one of the fields is set,
+// depending on the kind of file.
+type Upload struct {
+	Location string // For files that are not photos, videos or audio.
+	Photo    *core.Photo
+	Video    *core.Video
+	Audio    *core.Audio
+
+	// Transcoding is whether the video or audio is being transcoded in the
+	// background, in which case the original is used until it is done.
+	Transcoding bool
+}
+
+// BaseURL returns the public URL of the media storage.
+func (m *Media) BaseURL() string {
+	return m.storage.BaseURL()
+}
+
+func (m *Media) UploadMedia(filename, ext string, reader io.Reader) (*Upload, error) {
 	data, err := io.ReadAll(reader)
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
 
 	return m.upload(filename, ext, data)
 }
 
-func (m *Media) upload(filename, ext string, data []byte) (string, *core.Photo, error) {
+func (m *Media) upload(filename, ext string, data []byte) (*Upload, error) {
 	if m.storage == nil {
-		return "", nil, errors.New("media is not implemented")
+		return nil, errors.New("media is not implemented")
 	}
 
-	if isImage(ext) {
+	ext = strings.ToLower(ext)
+
+	// Consistency
+	if ext == ".jpg" {
+		ext = ".jpeg"
+	}
+
+	switch {
+	case isImage(ext):
 		p, err := m.uploadImage(filename, data)
 		if err != nil {
 			m.log.Errorf("failed to upload image", "filename", filename, "ext", ext, "err", err)
 		} else {
-			return "", p, nil
+			m.indexPhoto(filename, len(data), p)
+			return &Upload{Photo: p}, nil
 		}
+	case isVideo(ext):
+		return m.uploadVideo(filename, ext, data)
+	case isAudio(ext):
+		return m.uploadAudio(filename, ext, data)
 	}
 
-	// Consistency
-	if ext == ".jpg" {
-		ext = ".jpeg"
+	s, err := m.storage.UploadMedia(filename+ext, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
 	}
 
-	s, err := m.storage.UploadMedia(filename+ext, bytes.NewBuffer(data))
-	return s, nil, err
+	m.index(&core.MediaFile{
+		ID:          filename + ext,
+		Reference:   s,
+		URL:         s,
+		ContentType: mimetype.Detect(data).String(),
+		Size:        len(data),
+	})
+	return &Upload{Location: s}, nil
+}
+
+func (m *Media) indexPhoto(filename string, size int, p *core.Photo) {
+	m.index(m.photoFile(filename, size, p))
+}
+
+func (m *Media) photoFile(filename string, size int, p *core.Photo) *core.MediaFile {
+	return &core.MediaFile{
+		ID:          filename + ".jpeg",
+		Reference:   p.URL,
+		URL:         m.originalURL(filename),
+		ContentType: "image/jpeg",
+		Size:        size,
+		Width:       p.Width,
+		Height:      p.Height,
+		Renditions:  p.Renditions,
+	}
+}
+
+// index records the file in the media index. Failures are only logged, as the
+// file was already uploaded. Files without a creation date are created now.
+func (m *Media) index(file *core.MediaFile) {
+	if m.db == nil {
+		return
+	}
+
+	if file.Created.IsZero() {
+		file.Created = time.Now()
+	}
+	err := m.db.SaveMediaFile(context.Background(), file)
+	if err != nil {
+		m.log.Errorw("failed to index media file", "id", file.ID, "err", err)
+	}
 }
 
 var imageExtensions []string = []string{
@@ -143,6 +291,13 @@ func (m *Media) uploadImage(filename string, data []byte) (*core.Photo, error) {
 		return nil, fmt.Errorf("failed to decode image config: %w", err)
 	}
 
+	exif := decodeExif(data, m.keepGPS)
+	if !m.keepGPS {
+		data = stripGPS(data)
+	}
+
+	renditions := &core.Renditions{}
+
 	if len(data) < 100000 {
 		var reader io.Reader
 		if filepath.Ext(filename) == ".jpeg" || filepath.Ext(filename) == ".jpg" {
@@ -158,35 +313,37 @@ func (m *Media) uploadImage(filename string, data []byte) (*core.Photo, error) {
 		if err != nil {
 			return nil, err
 		}
+
+		err = m.uploadRenditionsManifest(filename, renditions)
+		if err != nil {
+			return nil, err
+		}
 	} else {
 		_, err := m.storage.UploadMedia(filename+".jpeg", bytes.NewReader(data))
 		if err != nil {
 			return nil, err
 		}
 
-		for _, format := range formats {
-			for _, width := range widths {
-				reader, err := m.Transformer.Transform(bytes.NewReader(data), string(format), int(width), 80, 0)
-				if err != nil {
-					return nil, err
-				}
-
-				_, err = m.storage.UploadMedia(filepath.Join("image", strconv.Itoa(int(width)), filename+"."+string(format)), reader)
-				if err != nil {
-					return nil, err
-				}
-			}
+		renditions, err = m.uploadRenditions(filename, data, config.Width)
+		if err != nil {
+			return nil, err
 		}
-
 	}
 
 	return &core.Photo{
 		URL:    "image:" + filename,
 		Width:  config.Width,
 		Height: config.Height,
+		Exif:   exif,
+
+		Renditions: renditions,
 	}, nil
 }
 
+// GetImageURL returns the URL of the rendition of an "image:" photo that best
+// matches the format and the width: the smallest one that is at least as wide,
+// or the widest one. If there is no rendition in the format, the URL of the
+// original is returned. Other URLs are returned as is.
 func (m *Media) GetImageURL(urlStr string, format Format, width Width) (string, error) {
 	u, err := url.Parse(urlStr)
 	if err != nil {
@@ -197,8 +354,56 @@ func (m *Media) GetImageURL(urlStr string, format Format, width Width) (string,
 		return urlStr, nil
 	}
 
-	urlStr = fmt.Sprintf("%s/image/%d/%s.%s", m.storage.BaseURL(), width, u.Opaque, format)
-	return urlStr, nil
+	renditions, err := m.GetRenditions(urlStr)
+	if err != nil {
+		return "", err
+	}
+
+	return m.imageURL(u.Opaque, renditions, format, width), nil
+}
+
+func (m *Media) imageURL(name string, renditions *core.Renditions, format Format, width Width) string {
+	if len(renditions.Widths) == 0 || !lo.Contains(renditions.Formats, string(format)) {
+		return m.originalURL(name)
+	}
+
+	best := renditions.Widths[len(renditions.Widths)-1]
+	for _, w := range renditions.Widths {
+		if w >= int(width) {
+			best = w
+			break
+		}
+	}
+
+	return m.renditionURL(name, format, Width(best))
+}
+
+// GetImageSrcSet returns the srcset attribute value with all the renditions of
+// an "image:" photo in the given format. It is empty if there are none.
+func (m *Media) GetImageSrcSet(urlStr string, format Format) (string, error) {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return "", err
+	}
+
+	if u.Scheme != "image" {
+		return "", nil
+	}
+
+	renditions, err := m.GetRenditions(urlStr)
+	if err != nil {
+		return "", err
+	}
+
+	if !lo.Contains(renditions.Formats, string(format)) {
+		return "", nil
+	}
+
+	srcset := lo.Map(renditions.Widths, func(w int, _ int) string {
+		return fmt.Sprintf("%s %dw", m.renditionURL(u.Opaque, format, Width(w)), w)
+	})
+
+	return strings.Join(srcset, ", "), nil
 }
 
 func (m *Media) GetImage(url string) ([]byte, string, error) {
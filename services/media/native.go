@@ -0,0 +1,176 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/rwcarlsen/goexif/exif"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	_ Transformer = &Native{}
+)
+
+const (
+	// nativeQualityStep is how much the quality is reduced at each iteration
+	// when trying to fit an image within the maximum number of bytes.
+	nativeQualityStep = 10
+	nativeMinQuality  = 10
+)
+
+// Native is an in-process [Transformer] that resizes and encodes images in
+// pure Go. It supports JPEG, PNG and WebP. WebP images are losslessly encoded,
+// therefore the quality and the maximum number of bytes do not apply to them,
+// and WebP renditions are only generated if explicitly configured.
+type Native struct{}
+
+func NewNative() *Native {
+	return &Native{}
+}
+
+func (n *Native) Transform(reader io.Reader, format string, width, quality, maxBytes int) (io.Reader, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	img = orientImage(img, exifOrientation(data))
+	img = resizeImage(img, width)
+
+	switch format {
+	case string(FormatJPEG), "jpg":
+		return encodeJPEG(flattenImage(img), quality, maxBytes)
+	case "png":
+		var buf bytes.Buffer
+		err = png.Encode(&buf, img)
+		return &buf, err
+	case string(FormatWebP):
+		var buf bytes.Buffer
+		err = nativewebp.Encode(&buf, img, nil)
+		return &buf, err
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+// encodeJPEG encodes the image with the given quality. If maxBytes is set, the
+// quality is iteratively reduced until the image fits. If it never fits, the
+// image with the lowest quality is returned.
+func encodeJPEG(img image.Image, quality, maxBytes int) (io.Reader, error) {
+	if quality <= 0 || quality > 100 {
+		quality = jpeg.DefaultQuality
+	}
+
+	for {
+		var buf bytes.Buffer
+		err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+		if err != nil {
+			return nil, err
+		}
+
+		if maxBytes <= 0 || buf.Len() <= maxBytes || quality <= nativeMinQuality {
+			return &buf, nil
+		}
+
+		quality = max(quality-nativeQualityStep, nativeMinQuality)
+	}
+}
+
+// resizeImage scales the image down to the given width, keeping the aspect
+// ratio. Images are never enlarged.
+func resizeImage(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	if width <= 0 || width >= bounds.Dx() {
+		return img
+	}
+
+	height := max(1, bounds.Dy()*width/bounds.Dx())
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// flattenImage draws the image over a white background, as JPEG does not
+// support transparency.
+func flattenImage(img image.Image) image.Image {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		return img
+	}
+
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Over)
+	return dst
+}
+
+// exifOrientation returns the EXIF orientation of the image, or 1 if there
+// is none.
+func exifOrientation(data []byte) int {
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil && (x == nil || exif.IsCriticalError(err)) {
+		return 1
+	}
+
+	if orientation := exifInt(x, exif.Orientation); orientation != 0 {
+		return orientation
+	}
+
+	return 1
+}
+
+// orientImage applies the EXIF orientation to the image, such that it is
+// displayed correctly once the metadata is gone.
+func orientImage(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// Orientations 5 to 8 swap the width and the height.
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := range h {
+		for x := range w {
+			var dx, dy int
+			switch orientation {
+			case 2: // Mirror horizontally.
+				dx, dy = w-1-x, y
+			case 3: // Rotate 180°.
+				dx, dy = w-1-x, h-1-y
+			case 4: // Mirror vertically.
+				dx, dy = x, h-1-y
+			case 5: // Mirror horizontally and rotate 270° clockwise.
+				dx, dy = y, x
+			case 6: // Rotate 90° clockwise.
+				dx, dy = h-1-y, x
+			case 7: // Mirror horizontally and rotate 90° clockwise.
+				dx, dy = h-1-y, w-1-x
+			case 8: // Rotate 270° clockwise.
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+
+	return dst
+}
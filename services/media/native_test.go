@@ -0,0 +1,88 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPNG(t *testing.T, width, height int) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	r := rand.New(rand.NewPCG(1, 2))
+	for y := range height {
+		for x := range width {
+			img.Set(x, y, color.NRGBA{uint8(r.IntN(256)), uint8(r.IntN(256)), uint8(r.IntN(256)), 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestNativeTransform(t *testing.T) {
+	data := testPNG(t, 400, 200)
+	n := NewNative()
+
+	for _, format := range []string{"jpeg", "png", "webp"} {
+		t.Run(format, func(t *testing.T) {
+			reader, err := n.Transform(bytes.NewReader(data), format, 100, 80, 0)
+			require.NoError(t, err)
+
+			out, err := io.ReadAll(reader)
+			require.NoError(t, err)
+
+			config, decoded, err := image.DecodeConfig(bytes.NewReader(out))
+			require.NoError(t, err)
+			assert.Equal(t, format, decoded)
+			assert.Equal(t, 100, config.Width)
+			assert.Equal(t, 50, config.Height)
+		})
+	}
+
+	t.Run("No Enlarge", func(t *testing.T) {
+		reader, err := n.Transform(bytes.NewReader(data), "png", 1000, 80, 0)
+		require.NoError(t, err)
+
+		config, _, err := image.DecodeConfig(reader)
+		require.NoError(t, err)
+		assert.Equal(t, 400, config.Width)
+	})
+
+	t.Run("Max Bytes", func(t *testing.T) {
+		reader, err := n.Transform(bytes.NewReader(data), "jpeg", 400, 100, 0)
+		require.NoError(t, err)
+		full, err := io.ReadAll(reader)
+		require.NoError(t, err)
+
+		maxBytes := len(full) / 2
+		reader, err = n.Transform(bytes.NewReader(data), "jpeg", 400, 100, maxBytes)
+		require.NoError(t, err)
+		compressed, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(compressed), maxBytes)
+	})
+
+	t.Run("Unsupported Format", func(t *testing.T) {
+		_, err := n.Transform(bytes.NewReader(data), "avif", 100, 80, 0)
+		assert.Error(t, err)
+	})
+}
+
+func TestOrientImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(0, 0, color.White)
+
+	rotated := orientImage(img, 6)
+	assert.Equal(t, image.Rect(0, 0, 2, 3), rotated.Bounds())
+	assert.Equal(t, color.RGBAModel.Convert(color.White), rotated.At(1, 0))
+
+	assert.Equal(t, img, orientImage(img, 1))
+}
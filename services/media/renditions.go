@@ -0,0 +1,214 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+
+	"go.hacdias.com/eagle/core"
+)
+
+// legacyRenditions are the renditions of the photos uploaded before the
+// manifests were introduced.
+var legacyRenditions = &core.Renditions{
+	Formats: []string{string(FormatWebP), string(FormatJPEG)},
+	Widths:  []int{int(Width600), int(Width900), int(Width1800)},
+}
+
+func (m *Media) originalURL(name string) string {
+	return fmt.Sprintf("%s/%s.jpeg", m.storage.BaseURL(), name)
+}
+
+func (m *Media) renditionURL(name string, format Format, width Width) string {
+	return fmt.Sprintf("%s/image/%d/%s.%s", m.storage.BaseURL(), width, name, format)
+}
+
+func manifestFilename(name string) string {
+	return filepath.Join("image", name+".json")
+}
+
+// renditionWidths returns the configured widths that do not enlarge an image
+// with the given width. If they all do, the smallest one is returned, such
+// that there is always a rendition.
+func (m *Media) renditionWidths(width int) []Width {
+	var widths []Width
+	for _, w := range m.widths {
+		if int(w) <= width {
+			widths = append(widths, w)
+		}
+	}
+
+	if len(widths) == 0 && len(m.widths) > 0 {
+		widths = append(widths, m.widths[0])
+	}
+
+	return widths
+}
+
+// uploadRenditions uploads the configured renditions of the image, as well as
+// the manifest describing them.
+func (m *Media) uploadRenditions(name string, data []byte, width int) (*core.Renditions, error) {
+	renditions := &core.Renditions{}
+	widths := m.renditionWidths(width)
+
+	for _, format := range m.formats {
+		for _, width := range widths {
+			reader, err := m.Transformer.Transform(bytes.NewReader(data), string(format), int(width), 80, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			_, err = m.storage.UploadMedia(filepath.Join("image", strconv.Itoa(int(width)), name+"."+string(format)), reader)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		renditions.Formats = append(renditions.Formats, string(format))
+	}
+
+	for _, width := range widths {
+		renditions.Widths = append(renditions.Widths, int(width))
+	}
+
+	err := m.uploadRenditionsManifest(name, renditions)
+	if err != nil {
+		return nil, err
+	}
+
+	return renditions, nil
+}
+
+func (m *Media) uploadRenditionsManifest(name string, renditions *core.Renditions) error {
+	data, err := json.Marshal(renditions)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.storage.UploadMedia(manifestFilename(name), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	m.renditions.Set(name, renditions)
+	return nil
+}
+
+// GetRenditions returns the manifest of the renditions of an "image:" photo.
+// Photos without a manifest are assumed to have the legacy renditions.
+func (m *Media) GetRenditions(urlStr string) (*core.Renditions, error) {
+	name, err := imageName(urlStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if renditions, ok := m.renditions.GetIfPresent(name); ok {
+		return renditions, nil
+	}
+
+	data, err := m.fetch(fmt.Sprintf("%s/%s", m.storage.BaseURL(), filepath.ToSlash(manifestFilename(name))))
+	if errors.Is(err, errNotFound) {
+		m.renditions.Set(name, legacyRenditions)
+		return legacyRenditions, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var renditions *core.Renditions
+	err = json.Unmarshal(data, &renditions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode renditions manifest of %s: %w", urlStr, err)
+	}
+
+	m.renditions.Set(name, renditions)
+	return renditions, nil
+}
+
+// RegenerateRenditions uploads the currently configured renditions of an
+// "image:" photo from its original, replacing the manifest.
+func (m *Media) RegenerateRenditions(urlStr string) (*core.Renditions, error) {
+	if m.storage == nil || m.Transformer == nil {
+		return nil, errors.New("media is not implemented")
+	}
+
+	name, err := imageName(urlStr)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := m.fetch(m.originalURL(name))
+	if err != nil {
+		return nil, err
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image config: %w", err)
+	}
+
+	renditions, err := m.uploadRenditions(name, data, config.Width)
+	if err != nil {
+		return nil, err
+	}
+
+	file := m.photoFile(name, len(data), &core.Photo{
+		URL:        urlStr,
+		Width:      config.Width,
+		Height:     config.Height,
+		Renditions: renditions,
+	})
+
+	// The photo keeps the date on which it was first uploaded.
+	if m.db != nil {
+		if existing, err := m.db.GetMediaFile(context.Background(), file.ID); err == nil {
+			file.Created = existing.Created
+		}
+	}
+
+	m.index(file)
+	return renditions, nil
+}
+
+func imageName(urlStr string) (string, error) {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return "", err
+	}
+
+	if u.Scheme != "image" {
+		return "", fmt.Errorf("%s is not an image: URL", urlStr)
+	}
+
+	return u.Opaque, nil
+}
+
+var errNotFound = errors.New("not found")
+
+func (m *Media) fetch(urlStr string) ([]byte, error) {
+	res, err := m.httpClient.Get(urlStr)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, res.Body)
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("failed to fetch %s: %w", urlStr, errNotFound)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: status %d", urlStr, res.StatusCode)
+	}
+
+	return io.ReadAll(res.Body)
+}
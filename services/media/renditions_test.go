@@ -0,0 +1,182 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.hacdias.com/eagle/core"
+)
+
+type memoryStorage struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	srv   *httptest.Server
+}
+
+func newMemoryStorage(t *testing.T) *memoryStorage {
+	s := &memoryStorage{files: map[string][]byte{}}
+	s.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		data, ok := s.files[r.URL.Path[1:]]
+		s.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(s.srv.Close)
+	return s
+}
+
+func (s *memoryStorage) BaseURL() string {
+	return s.srv.URL
+}
+
+func (s *memoryStorage) UploadMedia(filename string, data io.Reader) (string, error) {
+	b, err := io.ReadAll(data)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	s.files[filepath.ToSlash(filename)] = b
+	s.mu.Unlock()
+	return s.BaseURL() + "/" + filename, nil
+}
+
+func (s *memoryStorage) MediaExists(filename string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.files[filepath.ToSlash(filename)]
+	return ok, nil
+}
+
+func (s *memoryStorage) DeleteMedia(filename string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.files, filepath.ToSlash(filename))
+	return nil
+}
+
+// newTestCore returns a core on temporary directories, for its database and
+// queue.
+func newTestCore(t *testing.T) *core.Core {
+	co, err := core.NewCore(&core.Config{
+		ServerConfig: core.ServerConfig{
+			Development:     true,
+			SourceDirectory: t.TempDir(),
+			PublicDirectory: t.TempDir(),
+			DataDirectory:   t.TempDir(),
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = co.Close()
+	})
+	return co
+}
+
+func TestRenditions(t *testing.T) {
+	storage := newMemoryStorage(t)
+	m := NewMedia(&core.Media{
+		Formats: []string{"jpeg"},
+		Widths:  []int{900, 100, 300},
+	}, nil)
+	m.storage = storage
+
+	upload, err := m.UploadMedia("photo", ".png", bytes.NewReader(testPNG(t, 400, 200)))
+	require.NoError(t, err)
+	p := upload.Photo
+	require.NotNil(t, p)
+	assert.Equal(t, &core.Renditions{Formats: []string{"jpeg"}, Widths: []int{100, 300}}, p.Renditions)
+	assert.Contains(t, storage.files, "image/100/photo.jpeg")
+	assert.Contains(t, storage.files, "image/300/photo.jpeg")
+	assert.NotContains(t, storage.files, "image/900/photo.jpeg")
+
+	// Manifests are read from the storage when not cached.
+	m.renditions.InvalidateAll()
+
+	u, err := m.GetImageURL("image:photo", FormatJPEG, 200)
+	require.NoError(t, err)
+	assert.Equal(t, storage.BaseURL()+"/image/300/photo.jpeg", u)
+
+	u, err = m.GetImageURL("image:photo", FormatJPEG, 1800)
+	require.NoError(t, err)
+	assert.Equal(t, storage.BaseURL()+"/image/300/photo.jpeg", u)
+
+	u, err = m.GetImageURL("image:photo", FormatWebP, 600)
+	require.NoError(t, err)
+	assert.Equal(t, storage.BaseURL()+"/photo.jpeg", u)
+
+	srcset, err := m.GetImageSrcSet("image:photo", FormatJPEG)
+	require.NoError(t, err)
+	assert.Equal(t, storage.BaseURL()+"/image/100/photo.jpeg 100w, "+storage.BaseURL()+"/image/300/photo.jpeg 300w", srcset)
+
+	// Photos without a manifest have the legacy renditions.
+	u, err = m.GetImageURL("image:legacy", FormatWebP, 600)
+	require.NoError(t, err)
+	assert.Equal(t, storage.BaseURL()+"/image/600/legacy.webp", u)
+
+	u, err = m.GetImageURL("https://example.com/photo.jpeg", FormatWebP, 600)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/photo.jpeg", u)
+}
+
+func TestRegenerateRenditions(t *testing.T) {
+	co := newTestCore(t)
+	storage := newMemoryStorage(t)
+	m := NewMedia(&core.Media{Widths: []int{100}}, co.DB())
+	m.storage = storage
+
+	upload, err := m.UploadMedia("photo", ".png", bytes.NewReader(testPNG(t, 400, 200)))
+	require.NoError(t, err)
+
+	file, err := co.DB().GetMediaFile(context.Background(), "photo.jpeg")
+	require.NoError(t, err)
+	created := file.Created
+
+	m.widths = []Width{100, 300}
+	renditions, err := m.RegenerateRenditions(upload.Photo.URL)
+	require.NoError(t, err)
+	assert.Equal(t, []int{100, 300}, renditions.Widths)
+
+	file, err = co.DB().GetMediaFile(context.Background(), "photo.jpeg")
+	require.NoError(t, err)
+	assert.Equal(t, []int{100, 300}, file.Renditions.Widths)
+	assert.True(t, created.Equal(file.Created), "%s != %s", created, file.Created)
+}
+
+func TestDefaultFormats(t *testing.T) {
+	m := NewMedia(&core.Media{}, nil)
+	assert.Equal(t, NativeDefaultFormats, m.formats)
+
+	conf := &core.Media{}
+	conf.Transformer.ImgProxy = &core.ImgProxy{}
+	m = NewMedia(conf, nil)
+	assert.Equal(t, DefaultFormats, m.formats)
+
+	conf = &core.Media{Formats: []string{"webp"}}
+	m = NewMedia(conf, nil)
+	assert.Equal(t, []Format{FormatWebP}, m.formats)
+}
+
+func TestNormalizeReference(t *testing.T) {
+	storage := newMemoryStorage(t)
+	m := NewMedia(&core.Media{}, nil)
+	m.storage = storage
+
+	base := storage.BaseURL()
+	assert.Equal(t, "image:photo", m.normalizeReference(base+"/photo.jpeg"))
+	assert.Equal(t, "image:photo", m.normalizeReference(base+"/image/600/photo.webp"))
+	assert.Equal(t, base+"/notes.pdf", m.normalizeReference(base+"/notes.pdf"))
+	assert.Equal(t, "https://example.com/photo.jpeg", m.normalizeReference("https://example.com/photo.jpeg"))
+}
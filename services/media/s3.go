@@ -0,0 +1,251 @@
+package media
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"go.hacdias.com/eagle/core"
+)
+
+var (
+	_ Storage = &S3{}
+)
+
+const (
+	s3DefaultRegion = "us-east-1"
+	s3DateFormat    = "20060102T150405Z"
+)
+
+// S3 is a [Storage] for S3-compatible object storages, such as AWS S3, MinIO,
+// Cloudflare R2 or Backblaze B2. Requests are signed with AWS Signature V4.
+type S3 struct {
+	httpClient *http.Client
+	conf       *core.S3
+	endpoint   *url.URL
+	region     string
+	base       string
+}
+
+func NewS3(conf *core.S3) *S3 {
+	endpoint, _ := url.Parse(strings.TrimSuffix(conf.Endpoint, "/"))
+
+	region := conf.Region
+	if region == "" {
+		region = s3DefaultRegion
+	}
+
+	s := &S3{
+		conf:     conf,
+		endpoint: endpoint,
+		region:   region,
+		httpClient: &http.Client{
+			Timeout: time.Minute * 10,
+		},
+	}
+
+	s.base = strings.TrimSuffix(conf.Base, "/")
+	if s.base == "" {
+		s.base = strings.TrimSuffix(s.objectURL("").String(), "/")
+	}
+
+	return s
+}
+
+func (s *S3) BaseURL() string {
+	return s.base
+}
+
+// objectURL returns the URL of the object with the given key, either with the
+// bucket in the path or in the host name.
+func (s *S3) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	key = strings.TrimPrefix(path.Clean("/"+key), "/")
+
+	if s.conf.PathStyle {
+		u.Path = "/" + s.conf.Bucket + "/" + key
+	} else {
+		u.Host = s.conf.Bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+
+	u.RawPath = s3EscapePath(u.Path)
+	return &u
+}
+
+func (s *S3) do(method, key string, body []byte) (*http.Response, error) {
+	u := s.objectURL(key)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	if method == http.MethodPut {
+		contentType := mime.TypeByExtension(path.Ext(key))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	s.sign(req, body, time.Now())
+	return s.httpClient.Do(req)
+}
+
+func (s *S3) UploadMedia(filename string, data io.Reader) (string, error) {
+	body, err := io.ReadAll(data)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := s.do(http.MethodPut, filename, body)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, res.Body)
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return "", s3Error(res)
+	}
+
+	return s.base + "/" + strings.TrimPrefix(filename, "/"), nil
+}
+
+func (s *S3) MediaExists(filename string) (bool, error) {
+	res, err := s.do(http.MethodHead, filename, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, s3Error(res)
+	}
+}
+
+func (s *S3) DeleteMedia(filename string) error {
+	res, err := s.do(http.MethodDelete, filename, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, res.Body)
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK {
+		return s3Error(res)
+	}
+
+	return nil
+}
+
+// sign adds the AWS Signature V4 authorization to the request. The host and
+// all the headers set on the request are signed.
+func (s *S3) sign(req *http.Request, body []byte, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format(s3DateFormat)
+	date := amzDate[:8]
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.conf.SecretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.conf.AccessKey, scope, signedHeaders, signature,
+	))
+}
+
+// s3EscapePath escapes the path as required by AWS Signature V4: everything
+// but the unreserved characters and the slashes is percent-encoded.
+func s3EscapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func s3Error(res *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	return fmt.Errorf("s3: unexpected status code %d: %s", res.StatusCode, strings.TrimSpace(string(data)))
+}
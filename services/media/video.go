@@ -0,0 +1,292 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/samber/lo"
+	"go.hacdias.com/eagle/core"
+)
+
+var videoExtensions = []string{
+	".mp4",
+	".m4v",
+	".webm",
+	".mov",
+}
+
+var audioExtensions = []string{
+	".mp3",
+	".m4a",
+	".aac",
+	".ogg",
+	".oga",
+	".opus",
+	".wav",
+	".flac",
+}
+
+func isVideo(ext string) bool {
+	return lo.Contains(videoExtensions, strings.ToLower(ext))
+}
+
+func isAudio(ext string) bool {
+	return lo.Contains(audioExtensions, strings.ToLower(ext))
+}
+
+// TranscodeQueueItemType is the type of the queue items that transcode the
+// uploaded videos and audio in the background.
+const TranscodeQueueItemType = "media-transcode"
+
+type transcodeQueuePayload struct {
+	ID       string `json:"id"`       // The ID of the indexed original.
+	Filename string `json:"filename"` // The filename, without extension.
+}
+
+// UseQueue transcodes the videos and audio in the background, through the
+// queue, instead of during the upload. Once transcoded, [Media.TranscodeHook]
+// is called.
+func (m *Media) UseQueue(q *core.Queue) {
+	m.queue = q
+	q.Register(TranscodeQueueItemType, m.handleTranscodeQueueItem)
+}
+
+// transcodeLater indexes the file and adds it to the queue to be transcoded in
+// the background. It returns false if there is no queue, in which case the file
+// must be transcoded right away.
+func (m *Media) transcodeLater(filename string, file *core.MediaFile) bool {
+	if m.queue == nil || m.db == nil {
+		return false
+	}
+
+	m.index(file)
+
+	err := m.queue.Enqueue(context.Background(), TranscodeQueueItemType, &transcodeQueuePayload{
+		ID:       file.ID,
+		Filename: filename,
+	})
+	if err != nil {
+		m.log.Errorw("failed to enqueue transcoding", "filename", filename, "err", err)
+	}
+
+	return true
+}
+
+func (m *Media) handleTranscodeQueueItem(ctx context.Context, data []byte) error {
+	var payload transcodeQueuePayload
+	err := json.Unmarshal(data, &payload)
+	if err != nil {
+		return err
+	}
+
+	file, err := m.db.GetMediaFile(ctx, payload.ID)
+	if err != nil {
+		return err
+	}
+
+	original, err := m.fetch(file.URL)
+	if err != nil {
+		return err
+	}
+
+	upload := &Upload{}
+	switch ext := filepath.Ext(file.ID); {
+	case isVideo(ext):
+		upload.Video = &core.Video{URL: file.URL, MimeType: file.ContentType}
+		err = m.transcodeVideo(payload.Filename, original, upload.Video, file)
+		file.Width = upload.Video.Width
+		file.Height = upload.Video.Height
+	case isAudio(ext):
+		upload.Audio = &core.Audio{URL: file.URL, MimeType: file.ContentType}
+		err = m.transcodeAudio(payload.Filename, original, upload.Audio, file)
+	default:
+		return fmt.Errorf("%s is neither a video nor an audio file", file.ID)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = m.db.SaveMediaFile(ctx, file)
+	if err != nil {
+		return err
+	}
+
+	if m.TranscodeHook != nil {
+		m.TranscodeHook(file.URL, upload)
+	}
+
+	return nil
+}
+
+// uploadVideo uploads the original video and, if there is a transcoder, a
+// web-friendly rendition and a poster, either right away or through the queue.
+// Transcoding failures are logged, and the original is used instead.
+func (m *Media) uploadVideo(filename, ext string, data []byte) (*Upload, error) {
+	location, err := m.storage.UploadMedia(filename+ext, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	video := &core.Video{
+		URL:      location,
+		MimeType: mimetype.Detect(data).String(),
+	}
+
+	file := &core.MediaFile{
+		ID:          filename + ext,
+		Reference:   location,
+		URL:         location,
+		ContentType: video.MimeType,
+		Size:        len(data),
+	}
+
+	upload := &Upload{Video: video}
+
+	switch {
+	case m.transcoder == nil:
+		m.index(file)
+	case m.transcodeLater(filename, file):
+		upload.Transcoding = true
+	default:
+		err = m.transcodeVideo(filename, data, video, file)
+		if err != nil {
+			m.log.Errorw("failed to transcode video", "filename", filename, "err", err)
+		}
+
+		file.Width = video.Width
+		file.Height = video.Height
+		m.index(file)
+	}
+
+	return upload, nil
+}
+
+// transcodeVideo uploads the web-friendly rendition and the poster of the
+// video, which are recorded as derived from the original file.
+func (m *Media) transcodeVideo(filename string, data []byte, video *core.Video, file *core.MediaFile) error {
+	info, err := m.transcoder.Probe(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	video.Width = info.Width
+	video.Height = info.Height
+	video.Duration = info.Duration
+
+	poster, err := m.transcoder.Poster(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	posterData, err := io.ReadAll(poster)
+	if err != nil {
+		return err
+	}
+
+	photo, err := m.uploadImage(filename+"-poster", posterData)
+	if err != nil {
+		return err
+	}
+	video.Poster = photo.URL
+	file.Derived = append(file.Derived, imageFiles(filename+"-poster", photo.Renditions)...)
+
+	reader, err := m.transcoder.Transcode(bytes.NewReader(data), "mp4")
+	if err != nil {
+		return err
+	}
+
+	rendition := filepath.Join("video", filename+".mp4")
+	location, err := m.storage.UploadMedia(rendition, reader)
+	if err != nil {
+		return err
+	}
+
+	video.URL = location
+	video.MimeType = "video/mp4"
+	file.Reference = location
+	file.Derived = append(file.Derived, rendition)
+	return nil
+}
+
+// uploadAudio uploads the original audio and, if there is a transcoder, a
+// web-friendly rendition, either right away or through the queue. Transcoding
+// failures are logged, and the original is used instead.
+func (m *Media) uploadAudio(filename, ext string, data []byte) (*Upload, error) {
+	location, err := m.storage.UploadMedia(filename+ext, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	audio := &core.Audio{
+		URL:      location,
+		MimeType: mimetype.Detect(data).String(),
+	}
+
+	file := &core.MediaFile{
+		ID:          filename + ext,
+		Reference:   location,
+		URL:         location,
+		ContentType: audio.MimeType,
+		Size:        len(data),
+	}
+
+	upload := &Upload{Audio: audio}
+
+	switch {
+	case m.transcoder == nil:
+		m.index(file)
+	case m.transcodeLater(filename, file):
+		upload.Transcoding = true
+	default:
+		err = m.transcodeAudio(filename, data, audio, file)
+		if err != nil {
+			m.log.Errorw("failed to transcode audio", "filename", filename, "err", err)
+		}
+
+		m.index(file)
+	}
+
+	return upload, nil
+}
+
+func (m *Media) transcodeAudio(filename string, data []byte, audio *core.Audio, file *core.MediaFile) error {
+	info, err := m.transcoder.Probe(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	audio.Duration = info.Duration
+
+	reader, err := m.transcoder.Transcode(bytes.NewReader(data), "m4a")
+	if err != nil {
+		return err
+	}
+
+	rendition := filepath.Join("audio", filename+".m4a")
+	location, err := m.storage.UploadMedia(rendition, reader)
+	if err != nil {
+		return err
+	}
+
+	audio.URL = location
+	audio.MimeType = "audio/mp4"
+	file.Reference = location
+	file.Derived = append(file.Derived, rendition)
+	return nil
+}
+
+// GetMedia fetches a video or audio file from its URL.
+func (m *Media) GetMedia(url string) ([]byte, string, error) {
+	data, err := m.fetch(url)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return data, mimetype.Detect(data).String(), nil
+}
@@ -2,19 +2,38 @@ package meilisearch
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/meilisearch/meilisearch-go"
+	"github.com/samber/lo"
 	"go.hacdias.com/eagle/core"
 )
 
 const (
-	searchIndex = "eagle-v1"
-	searchKey   = "idx"
+	// searchVersion is the version of the attributes of the index, which is
+	// part of its name. Bump it whenever the searchable, filterable or
+	// sortable attributes change, such that the index is rebuilt.
+	searchVersion     = 2
+	searchIndexPrefix = "eagle-v"
+	searchKey         = "idx"
+	taskInterval      = 100 * time.Millisecond
+	pageSize          = 1000
 )
 
 var (
+	_ core.SearchIndex = &Meilisearch{}
+)
+
+var (
+	searchIndex = searchIndexPrefix + strconv.Itoa(searchVersion)
+
+	// The order of the attributes defines their importance in the ranking.
 	searcheableAttributes = []string{
 		"title",
 		"tags",
@@ -22,104 +41,253 @@ var (
 	}
 )
 
-type Pagination struct {
-	Page  int
-	Limit int
-}
-
 type Meilisearch struct {
 	client meilisearch.ServiceManager
 	core   *core.Core
+
+	// live is the index serving searches. Until the current version is built,
+	// it is the latest previous version, if any.
+	mu   sync.RWMutex
+	live string
 }
 
 func NewMeilisearch(host, key string, co *core.Core) (*Meilisearch, error) {
 	client := meilisearch.New(host, meilisearch.WithAPIKey(key))
 
-	indexes, err := client.ListIndexes(nil)
+	indexes, err := listIndexes(client)
 	if err != nil {
 		return nil, err
 	}
 
-	found := false
-	for _, idx := range indexes.Results {
-		if idx.UID == searchIndex {
-			found = true
+	ms := &Meilisearch{
+		client: client,
+		core:   co,
+	}
+
+	latest := 0
+	for _, uid := range indexes {
+		version, err := strconv.Atoi(strings.TrimPrefix(uid, searchIndexPrefix))
+		if err == nil && strings.HasPrefix(uid, searchIndexPrefix) && version > latest && version <= searchVersion {
+			latest = version
+			ms.live = uid
 		}
 	}
 
-	if !found {
-		_, err := client.CreateIndex(&meilisearch.IndexConfig{
-			Uid:        searchIndex,
-			PrimaryKey: searchKey,
-		})
+	return ms, nil
+}
+
+func (ms *Meilisearch) index() meilisearch.IndexManager {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	if ms.live == "" {
+		return nil
+	}
+	return ms.client.Index(ms.live)
+}
+
+func (ms *Meilisearch) Outdated() (bool, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.live != searchIndex, nil
+}
+
+func (ms *Meilisearch) Rebuild(ee ...*core.Entry) error {
+	next := searchIndex + "-next"
 
+	indexes, err := listIndexes(ms.client)
+	if err != nil {
+		return err
+	}
+
+	// Leftover from an interrupted rebuild.
+	if lo.Contains(indexes, next) {
+		err = ms.wait(ms.client.DeleteIndex(next))
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
 
-	_, err = client.Index(searchIndex).UpdateSearchableAttributes(&searcheableAttributes)
+	err = ms.createIndex(next)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return &Meilisearch{
-		client: client,
-		core:   co,
-	}, nil
+	if docs := documents(ee); len(docs) > 0 {
+		err = ms.wait(ms.client.Index(next).UpdateDocuments(docs, nil))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Swapping requires both indexes to exist.
+	if !lo.Contains(indexes, searchIndex) {
+		err = ms.createIndex(searchIndex)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = ms.wait(ms.client.SwapIndexes([]*meilisearch.SwapIndexesParams{
+		{Indexes: []string{searchIndex, next}},
+	}))
+	if err != nil {
+		return err
+	}
+
+	ms.mu.Lock()
+	ms.live = searchIndex
+	ms.mu.Unlock()
+
+	// The next index now holds the previous contents, which are no longer
+	// needed, just as the previous versions.
+	for _, uid := range append(indexes, next) {
+		if uid != searchIndex && strings.HasPrefix(uid, searchIndexPrefix) {
+			_, err = ms.client.DeleteIndex(uid)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
 }
 
-func (ms *Meilisearch) ResetIndex() error {
-	_, err := ms.client.Index(searchIndex).DeleteAllDocuments(nil)
-	return err
+func (ms *Meilisearch) createIndex(uid string) error {
+	err := ms.wait(ms.client.CreateIndex(&meilisearch.IndexConfig{
+		Uid:        uid,
+		PrimaryKey: searchKey,
+	}))
+	if err != nil {
+		return err
+	}
+
+	return ms.wait(ms.client.Index(uid).UpdateSettings(&meilisearch.Settings{
+		SearchableAttributes: searcheableAttributes,
+		FilterableAttributes: append([]string{"date"}, core.SearchFacets...),
+		SortableAttributes:   []string{"date"},
+	}))
 }
 
-func (ms *Meilisearch) Add(ee ...*core.Entry) error {
-	docs := []any{}
+func (ms *Meilisearch) Hashes() (map[string]string, error) {
+	hashes := map[string]string{}
+	index := ms.index()
+	if index == nil {
+		return hashes, nil
+	}
 
-	for _, e := range ee {
-		if e.Deleted() || e.Draft || e.NoIndex {
-			continue
+	for offset := int64(0); ; offset += pageSize {
+		var res meilisearch.DocumentsResult
+		err := index.GetDocuments(&meilisearch.DocumentsQuery{
+			Offset: offset,
+			Limit:  pageSize,
+			Fields: []string{"id", "hash"},
+		}, &res)
+		if err != nil {
+			return nil, err
 		}
 
-		docs = append(docs, map[string]any{
-			searchKey: hex.EncodeToString([]byte(e.ID)),
-			"id":      e.ID,
-			"title":   e.Title,
-			"tags":    e.Tags,
-			"content": e.TextContent(),
-		})
+		for _, hit := range res.Results {
+			m := struct {
+				ID   string `json:"id"`
+				Hash string `json:"hash"`
+			}{}
+			if err := hit.DecodeInto(&m); err != nil {
+				return nil, fmt.Errorf("cannot convert document in map[string]any: %q", hit)
+			}
+			hashes[m.ID] = m.Hash
+		}
+
+		if offset+pageSize >= res.Total {
+			return hashes, nil
+		}
+	}
+}
+
+func (ms *Meilisearch) Add(ee ...*core.Entry) error {
+	docs := documents(ee)
+	index := ms.index()
+	if index == nil || len(docs) == 0 {
+		return nil
 	}
 
-	_, err := ms.client.Index(searchIndex).UpdateDocuments(docs, nil)
+	_, err := index.UpdateDocuments(docs, nil)
 	return err
 }
 
 func (ms *Meilisearch) Remove(ids ...string) error {
-	_, err := ms.client.Index(searchIndex).DeleteDocuments(ids, nil)
+	index := ms.index()
+	if index == nil || len(ids) == 0 {
+		return nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = hex.EncodeToString([]byte(id))
+	}
+
+	_, err := index.DeleteDocuments(keys, nil)
 	return err
 }
 
-func (ms *Meilisearch) Search(page, limit int64, query string) (core.Entries, error) {
+// searchRequest returns the request of the query. Paginating by page, instead
+// of by offset, makes Meilisearch count the exact total of hits.
+func searchRequest(q *core.SearchQuery) *meilisearch.SearchRequest {
+	// The pages of Meilisearch start at 1.
 	req := &meilisearch.SearchRequest{
-		CropLength: 200,
-		Limit:      limit,
+		HitsPerPage:           int64(q.Limit),
+		Page:                  int64(q.Page + 1),
+		AttributesToCrop:      []string{"content"},
+		CropLength:            32,
+		CropMarker:            "…",
+		AttributesToHighlight: []string{"content"},
+		HighlightPreTag:       core.SnippetMarkStart,
+		HighlightPostTag:      core.SnippetMarkEnd,
+		Facets:                core.SearchFacets,
 	}
 
-	if page != -1 {
-		req.Offset = page * limit
+	if filter := filter(q); filter != "" {
+		req.Filter = filter
 	}
 
-	res, err := ms.client.Index(searchIndex).Search(query, req)
+	switch {
+	case q.Sort == core.SearchSortOldest:
+		req.Sort = []string{"date:asc"}
+	case q.Sort == core.SearchSortNewest || q.Query == "":
+		req.Sort = []string{"date:desc"}
+	}
 
+	return req
+}
+
+func (ms *Meilisearch) Search(q *core.SearchQuery) (*core.SearchResults, error) {
+	index := ms.index()
+	if index == nil || (q.Query == "" && !q.Filtered()) {
+		return &core.SearchResults{}, nil
+	}
+
+	res, err := index.Search(q.Query, searchRequest(q))
 	if err != nil {
 		return nil, err
 	}
 
-	entries := core.Entries{}
+	counts := map[string]map[string]int{}
+	if len(res.FacetDistribution) != 0 {
+		err = json.Unmarshal(res.FacetDistribution, &counts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	results := &core.SearchResults{
+		Total:  int(res.TotalHits),
+		Facets: core.NewSearchFacets(counts),
+	}
 	for _, hit := range res.Hits {
 		m := struct {
-			ID string `json:"id"`
+			ID        string `json:"id"`
+			Formatted struct {
+				Content string `json:"content"`
+			} `json:"_formatted"`
 		}{}
 		if err := hit.DecodeInto(&m); err != nil {
 			return nil, fmt.Errorf("cannot convert hit in map[string]any: %q", hit)
@@ -133,9 +301,102 @@ func (ms *Meilisearch) Search(page, limit int64, query string) (core.Entries, er
 				return nil, err
 			}
 		} else {
-			entries = append(entries, entry)
+			results.Hits = append(results.Hits, &core.SearchResult{
+				Entry:   entry,
+				Snippet: core.SnippetHTML(m.Formatted.Content),
+			})
+		}
+	}
+
+	return results, nil
+}
+
+// filter returns the Meilisearch filter expression for the filters of q.
+func filter(q *core.SearchQuery) string {
+	var conditions []string
+	filters := q.Filters()
+	for _, facet := range core.SearchFacets {
+		if value, ok := filters[facet]; ok {
+			conditions = append(conditions, facet+" = "+strconv.Quote(value))
 		}
 	}
 
-	return entries, nil
+	if !q.From.IsZero() {
+		conditions = append(conditions, "date >= "+strconv.FormatInt(q.From.Unix(), 10))
+	}
+
+	if !q.To.IsZero() {
+		conditions = append(conditions, "date <= "+strconv.FormatInt(q.To.Unix(), 10))
+	}
+
+	return strings.Join(conditions, " AND ")
+}
+
+func documents(ee []*core.Entry) []any {
+	docs := []any{}
+	for _, e := range ee {
+		if !e.Searchable() {
+			continue
+		}
+
+		d := core.NewSearchDocument(e)
+		doc := map[string]any{
+			searchKey:                  hex.EncodeToString([]byte(e.ID)),
+			"id":                       d.ID,
+			"hash":                     d.Hash(),
+			"title":                    d.Title,
+			"content":                  d.Content,
+			core.SearchFacetTags:       d.Tags,
+			core.SearchFacetCategories: d.Categories,
+			core.SearchFacetSection:    d.Section,
+			core.SearchFacetKind:       d.Kind,
+			core.SearchFacetLocation:   d.Location,
+		}
+		if !d.Date.IsZero() {
+			// Filtering by ranges requires numbers.
+			doc["date"] = d.Date.Unix()
+		}
+
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+func listIndexes(client meilisearch.ServiceManager) ([]string, error) {
+	var uids []string
+	for offset := int64(0); ; offset += pageSize {
+		res, err := client.ListIndexes(&meilisearch.IndexesQuery{
+			Offset: offset,
+			Limit:  pageSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, idx := range res.Results {
+			uids = append(uids, idx.UID)
+		}
+
+		if offset+pageSize >= res.Total {
+			return uids, nil
+		}
+	}
+}
+
+// wait waits for the task to be processed, returning its error, if any.
+func (ms *Meilisearch) wait(info *meilisearch.TaskInfo, err error) error {
+	if err != nil {
+		return err
+	}
+
+	task, err := ms.client.WaitForTask(info.TaskUID, taskInterval)
+	if err != nil {
+		return err
+	}
+
+	if task.Status != meilisearch.TaskStatusSucceeded {
+		return fmt.Errorf("meilisearch task %d %s: %s", info.TaskUID, task.Status, task.Error.Message)
+	}
+
+	return nil
 }
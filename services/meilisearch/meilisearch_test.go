@@ -0,0 +1,33 @@
+package meilisearch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.hacdias.com/eagle/core"
+)
+
+func TestFilter(t *testing.T) {
+	assert.Equal(t, "", filter(&core.SearchQuery{Query: "cats"}))
+	assert.Equal(t, `tags = "say \"hi\"" AND section = "posts" AND date >= 1704067200 AND date <= 1706745600`, filter(&core.SearchQuery{
+		Tag:     `say "hi"`,
+		Section: "posts",
+		From:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:      time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+	}))
+}
+
+func TestSearchRequest(t *testing.T) {
+	req := searchRequest(&core.SearchQuery{Query: "cats", Page: 2, Limit: 10})
+	assert.EqualValues(t, 3, req.Page)
+	assert.EqualValues(t, 10, req.HitsPerPage)
+	assert.Zero(t, req.Offset)
+	assert.Zero(t, req.Limit)
+	assert.Empty(t, req.Sort)
+
+	req = searchRequest(&core.SearchQuery{Tag: "cats", Limit: 10})
+	assert.EqualValues(t, 1, req.Page)
+	assert.Equal(t, []string{"date:desc"}, req.Sort)
+	assert.Equal(t, `tags = "cats"`, req.Filter)
+}
@@ -0,0 +1,124 @@
+package smtp
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.hacdias.com/eagle/core"
+)
+
+var (
+	_ core.Mailer = &SMTP{}
+)
+
+// implicitTLSPort is the submission port that uses TLS from the start, instead
+// of upgrading the connection with STARTTLS.
+const implicitTLSPort = 465
+
+type SMTP struct {
+	conf *core.SMTP
+	addr string
+}
+
+func NewSMTP(conf *core.SMTP) *SMTP {
+	return &SMTP{
+		conf: conf,
+		addr: net.JoinHostPort(conf.Host, strconv.Itoa(conf.Port)),
+	}
+}
+
+func (s *SMTP) Mail(to, subject, body string) error {
+	from, err := mail.ParseAddress(s.conf.From)
+	if err != nil {
+		return err
+	}
+
+	msg := message(from, to, subject, body, time.Now())
+
+	var auth smtp.Auth
+	if s.conf.Username != "" {
+		auth = smtp.PlainAuth("", s.conf.Username, s.conf.Password, s.conf.Host)
+	}
+
+	if s.conf.Port != implicitTLSPort {
+		// Upgrades to TLS with STARTTLS, if supported by the server.
+		return smtp.SendMail(s.addr, auth, from.Address, []string{to}, msg)
+	}
+
+	conn, err := tls.Dial("tcp", s.addr, &tls.Config{ServerName: s.conf.Host})
+	if err != nil {
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, s.conf.Host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if auth != nil {
+		err = c.Auth(auth)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = c.Mail(from.Address)
+	if err != nil {
+		return err
+	}
+
+	err = c.Rcpt(to)
+	if err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(msg)
+	if err != nil {
+		return err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+func message(from *mail.Address, to, subject, body string, date time.Time) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", to)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", uuid.New().String(), domain(from.Address))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(body)
+	return buf.Bytes()
+}
+
+func domain(address string) string {
+	if i := strings.LastIndex(address, "@"); i != -1 {
+		return address[i+1:]
+	}
+	return "localhost"
+}
@@ -0,0 +1,24 @@
+package smtp
+
+import (
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessage(t *testing.T) {
+	msg := string(message(
+		&mail.Address{Name: "Eagle", Address: "eagle@example.com"},
+		"jane@example.org",
+		"Réponse",
+		"Hello!",
+		time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	))
+
+	assert.True(t, strings.HasPrefix(msg, "From: \"Eagle\" <eagle@example.com>\r\nTo: jane@example.org\r\nSubject: =?utf-8?q?R=C3=A9ponse?=\r\nDate: Tue, 02 Jan 2024 03:04:05 +0000\r\nMessage-ID: <"))
+	assert.Contains(t, msg, "@example.com>\r\n")
+	assert.True(t, strings.HasSuffix(msg, "\r\n\r\nHello!"))
+}
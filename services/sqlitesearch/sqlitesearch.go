@@ -0,0 +1,116 @@
+package sqlitesearch
+
+import (
+	"context"
+	"os"
+	"strings"
+	"unicode"
+
+	"go.hacdias.com/eagle/core"
+)
+
+var (
+	_ core.SearchIndex = &SQLiteSearch{}
+)
+
+// SQLiteSearch is a [core.SearchIndex] backed by an FTS5 table in Eagle's
+// own database, such that no external service is needed.
+type SQLiteSearch struct {
+	core *core.Core
+}
+
+func NewSQLiteSearch(co *core.Core) (*SQLiteSearch, error) {
+	err := co.DB().SearchSupported(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQLiteSearch{
+		core: co,
+	}, nil
+}
+
+func (s *SQLiteSearch) Outdated() (bool, error) {
+	return s.core.DB().SearchIndexOutdated(context.Background())
+}
+
+func (s *SQLiteSearch) Rebuild(ee ...*core.Entry) error {
+	return s.core.DB().RebuildSearchIndex(context.Background(), searchDocuments(ee)...)
+}
+
+func (s *SQLiteSearch) Hashes() (map[string]string, error) {
+	return s.core.DB().GetSearchHashes(context.Background())
+}
+
+func (s *SQLiteSearch) Add(ee ...*core.Entry) error {
+	return s.core.DB().SaveSearchDocuments(context.Background(), searchDocuments(ee)...)
+}
+
+func (s *SQLiteSearch) Remove(ids ...string) error {
+	return s.core.DB().DeleteSearchDocuments(context.Background(), ids...)
+}
+
+func (s *SQLiteSearch) Search(q *core.SearchQuery) (*core.SearchResults, error) {
+	match := ftsQuery(q.Query)
+	if match == "" && !q.Filtered() {
+		return &core.SearchResults{}, nil
+	}
+
+	ctx := context.Background()
+	hits, total, err := s.core.DB().SearchDocuments(ctx, match, q)
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := s.core.DB().SearchFacetCounts(ctx, match, q)
+	if err != nil {
+		return nil, err
+	}
+
+	results := &core.SearchResults{
+		Total:  total,
+		Facets: core.NewSearchFacets(counts),
+	}
+	for _, hit := range hits {
+		entry, err := s.core.GetEntry(hit.ID)
+		if err != nil {
+			if os.IsNotExist(err) {
+				_ = s.Remove(hit.ID)
+				continue
+			}
+			return nil, err
+		}
+
+		results.Hits = append(results.Hits, &core.SearchResult{
+			Entry:   entry,
+			Snippet: core.SnippetHTML(hit.Snippet),
+		})
+	}
+
+	return results, nil
+}
+
+func searchDocuments(ee []*core.Entry) []*core.SearchDocument {
+	docs := []*core.SearchDocument{}
+	for _, e := range ee {
+		if e.Searchable() {
+			docs = append(docs, core.NewSearchDocument(e))
+		}
+	}
+	return docs
+}
+
+// ftsQuery converts free text into an FTS5 query that matches the documents
+// containing all the words, or words starting with them. Each word is quoted,
+// such that the FTS5 syntax characters in the input are not interpreted.
+func ftsQuery(query string) string {
+	words := strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	for i, word := range words {
+		words[i] = `"` + word + `"*`
+	}
+
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,14 @@
+package sqlitesearch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFTSQuery(t *testing.T) {
+	assert.Equal(t, `"hello"* "world"*`, ftsQuery("hello world"))
+	assert.Equal(t, `"c"* "est"* "déjà"* "vu"*`, ftsQuery(`c'est "déjà-vu"`))
+	assert.Equal(t, `"NOT"* "a"*`, ftsQuery("NOT a*"))
+	assert.Equal(t, "", ftsQuery(`"*()`))
+}